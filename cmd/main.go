@@ -1,16 +1,99 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"time"
 
+	"github.com/aml-709/game-store/internal/auth"
 	"github.com/aml-709/game-store/internal/handlers"
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/payment"
+	"github.com/aml-709/game-store/internal/session"
 	"github.com/aml-709/game-store/internal/storage"
 )
 
+const usage = `usage: %s [-db games.db] [-addr :8080] [-order-ttl 24h] [-restore-cart] [-refund-window 336h] [-price-watch 15m] [command]
+
+commands:
+  serve                          run the web server (default)
+  migrate up|down [n]|status     manage schema migrations
+  role <username> <role>         set customer role (customer, moderator, admin)
+
+environment:
+  PAYMENT_WEBHOOK_SECRET         key for signing payment provider events (random if unset)
+  PAYMENT_WEBHOOK_URL            where the provider delivers events
+                                 (default http://127.0.0.1<addr port>/webhooks/payments)
+`
+
 func main() {
-	db := storage.InitDB()
-	h := &handlers.Handler{DB: db}
+	dbPath := flag.String("db", "games.db", "path to the SQLite database")
+	addr := flag.String("addr", ":8080", "HTTP listen address")
+	orderTTL := flag.Duration("order-ttl", 24*time.Hour, "expire orders left unpaid this long (0 disables)")
+	restoreCart := flag.Bool("restore-cart", true, "put items of expired orders back into the cart")
+	refundWindow := flag.Duration("refund-window", handlers.DefaultRefundWindow, "how long after payment customers may request a refund")
+	priceWatch := flag.Duration("price-watch", 15*time.Minute, "check wishlisted games for price drops this often (0 disables)")
+	flag.Usage = func() { fmt.Fprintf(flag.CommandLine.Output(), usage, os.Args[0]); flag.PrintDefaults() }
+	flag.Parse()
+
+	cmd, args := "serve", flag.Args()
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "serve":
+		serve(storage.InitDB(*dbPath), *addr, *orderTTL, *restoreCart, *refundWindow, *priceWatch)
+	case "migrate":
+		db, err := storage.Open(*dbPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+		if err := migrate(db, args); err != nil {
+			log.Fatal(err)
+		}
+	case "role":
+		if err := setRole(storage.InitDB(*dbPath), args); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func serve(db *sql.DB, addr string, orderTTL time.Duration, restoreCart bool, refundWindow, priceWatch time.Duration) {
+	sessions := session.NewStore(db, 7*24*time.Hour)
+	stopSweeper := sessions.StartSweeper(time.Hour)
+	defer stopSweeper()
+
+	// пока есть только тестовый провайдер; ключ подписи событий — из окружения
+	gateway := payment.NewFake(os.Getenv("PAYMENT_WEBHOOK_SECRET"))
+
+	h := &handlers.Handler{
+		Repos:        storage.NewRepos(db),
+		Sessions:     sessions,
+		Hasher:       auth.NewArgon2idHasher(auth.DefaultArgon2idParams),
+		Gateway:      gateway,
+		RefundWindow: refundWindow,
+	}
+	if orderTTL > 0 {
+		stopExpiry := storage.StartOrderExpiry(h.Orders, orderTTL, restoreCart, h.VoidPayments)
+		defer stopExpiry()
+	}
+	if priceWatch > 0 {
+		stopWatch := storage.StartPriceWatch(h.Wishlists, priceWatch)
+		defer stopWatch()
+	}
+	// события тестового провайдера приходят на наш же вебхук, как от настоящего
+	gateway.SetNotifier(payment.HTTPNotifier(webhookURL(addr)))
 
 	// Auth routes
 	http.HandleFunc("/register", h.Register)
@@ -18,27 +101,125 @@ func main() {
 	http.HandleFunc("/logout", h.Logout)
 
 	// Protected routes
+	// (маршруты без scopes доступны только по cookie-сессии, со scopes — ещё и по токену)
 	http.HandleFunc("/account", h.AuthMiddleware(h.Account))
-	http.HandleFunc("/cart", h.AuthMiddleware(h.Cart))
-	http.HandleFunc("/checkout", h.AuthMiddleware(h.Checkout))
-	http.HandleFunc("/library", h.AuthMiddleware(h.Library))
-	http.HandleFunc("/purchases", h.AuthMiddleware(h.Purchases))
-	http.HandleFunc("/add-to-cart", h.AuthMiddleware(h.AddToCart))
-	http.HandleFunc("/remove-from-cart", h.AuthMiddleware(h.RemoveFromCart))
-	http.HandleFunc("/game/comment", h.AuthMiddleware(h.AddComment))
-	http.HandleFunc("/comment/delete", h.AuthMiddleware(h.DeleteComment))
-	http.HandleFunc("/comment/edit", h.AuthMiddleware(h.EditComment))
-	http.HandleFunc("/comment/update", h.AuthMiddleware(h.UpdateComment))
-	http.HandleFunc("/pay", h.AuthMiddleware(h.Pay))
+	http.HandleFunc("/account/currency", h.AuthMiddleware(h.SetCurrency))
+	http.HandleFunc("/account/email", h.AuthMiddleware(h.SetEmail))
+	http.HandleFunc("/account/tokens", h.AuthMiddleware(h.CreateToken))
+	http.HandleFunc("/account/tokens/revoke", h.AuthMiddleware(h.RevokeToken))
+	http.HandleFunc("/cart", h.AuthMiddleware(h.Cart, models.ScopeCartWrite))
+	http.HandleFunc("/checkout", h.AuthMiddleware(h.Checkout, models.ScopePurchase))
+	http.HandleFunc("/library", h.AuthMiddleware(h.Library, models.ScopePurchase))
+	http.HandleFunc("/purchases", h.AuthMiddleware(h.Purchases, models.ScopePurchase))
+	http.HandleFunc("/purchases/cancel", h.AuthMiddleware(h.CancelOrder, models.ScopePurchase))
+	http.HandleFunc("/purchases/refund", h.AuthMiddleware(h.RequestRefund, models.ScopePurchase))
+	http.HandleFunc("/gifts", h.AuthMiddleware(h.GiftInbox, models.ScopePurchase))
+	http.HandleFunc("/gifts/answer", h.AuthMiddleware(h.AnswerGift, models.ScopePurchase))
+	http.HandleFunc("/redeem", h.AuthMiddleware(h.RedeemKey, models.ScopePurchase))
+	http.HandleFunc("/wishlist", h.AuthMiddleware(h.Wishlist))
+	http.HandleFunc("/wishlist/add", h.AuthMiddleware(h.AddToWishlist))
+	http.HandleFunc("/wishlist/remove", h.AuthMiddleware(h.RemoveFromWishlist))
+	http.HandleFunc("/add-to-cart", h.AuthMiddleware(h.AddToCart, models.ScopeCartWrite))
+	http.HandleFunc("/add-bundle-to-cart", h.AuthMiddleware(h.AddBundleToCart, models.ScopeCartWrite))
+	http.HandleFunc("/remove-from-cart", h.AuthMiddleware(h.RemoveFromCart, models.ScopeCartWrite))
+	http.HandleFunc("/game/comment", h.AuthMiddleware(h.AddComment, models.ScopeReviewsWrite))
+	http.HandleFunc("/comment/delete", h.AuthMiddleware(h.DeleteComment, models.ScopeReviewsWrite))
+	http.HandleFunc("/comment/edit", h.AuthMiddleware(h.EditComment, models.ScopeReviewsWrite))
+	http.HandleFunc("/comment/update", h.AuthMiddleware(h.UpdateComment, models.ScopeReviewsWrite))
+	http.HandleFunc("/pay", h.AuthMiddleware(h.Pay, models.ScopePurchase))
+
+	// Payments
+	http.HandleFunc(payment.FakeCheckoutPath+"{id}", h.FakeCheckout)
+	http.HandleFunc("POST /webhooks/payments", h.PaymentWebhook)
+
+	// Admin routes
+	http.HandleFunc("/admin", h.AdminMiddleware(h.Admin))
+	http.HandleFunc("/add-game", h.AdminMiddleware(h.AddGame))
+	http.HandleFunc("/admin/games/edit", h.AdminMiddleware(h.EditGame))
+	http.HandleFunc("/admin/games/publish", h.AdminMiddleware(h.SetGamePublished))
+	http.HandleFunc("/admin/games/delete", h.AdminMiddleware(h.DeleteGame))
+	http.HandleFunc("/admin/users", h.AdminMiddleware(h.AdminUsers))
+	http.HandleFunc("/admin/terms", h.AdminMiddleware(h.AdminTerms))
+	http.HandleFunc("/admin/terms/delete", h.AdminMiddleware(h.DeleteTerm))
+	http.HandleFunc("/admin/refunds", h.AdminMiddleware(h.AdminRefunds))
+	http.HandleFunc("/admin/refunds/decide", h.AdminMiddleware(h.DecideRefund))
+	http.HandleFunc("/admin/promotions", h.AdminMiddleware(h.AdminPromotions))
+	http.HandleFunc("/admin/promotions/active", h.AdminMiddleware(h.SetPromotionActive))
+	http.HandleFunc("/admin/prices", h.AdminMiddleware(h.AdminPrices))
+	http.HandleFunc("/admin/prices/delete", h.AdminMiddleware(h.DeletePriceChange))
+	http.HandleFunc("/admin/prices/preview", h.AdminMiddleware(h.PricePreview))
+	http.HandleFunc("/admin/bundles", h.AdminMiddleware(h.AdminBundles))
+	http.HandleFunc("/admin/bundles/edit", h.AdminMiddleware(h.EditBundle))
+	http.HandleFunc("/admin/bundles/publish", h.AdminMiddleware(h.SetBundlePublished))
+	http.HandleFunc("/admin/bundles/delete", h.AdminMiddleware(h.DeleteBundle))
+	http.HandleFunc("/admin/keys", h.AdminMiddleware(h.AdminKeys))
+	http.HandleFunc("/admin/keys/export", h.AdminMiddleware(h.ExportKeys))
+
+	// JSON API v1
+	http.HandleFunc("/api/v1/", h.APINotFound)
+	http.HandleFunc("GET /api/v1/games", h.APIPublic(h.APIListGames, models.ScopeCatalogRead))
+	http.HandleFunc("GET /api/v1/facets", h.APIPublic(h.APIFacets, models.ScopeCatalogRead))
+	http.HandleFunc("GET /api/v1/search", h.APIPublic(h.APISearch, models.ScopeCatalogRead))
+	http.HandleFunc("GET /api/v1/games/{id}", h.APIPublic(h.APIGetGame, models.ScopeCatalogRead))
+	http.HandleFunc("GET /api/v1/games/{id}/reviews", h.APIPublic(h.APIListReviews, models.ScopeCatalogRead))
+	http.HandleFunc("POST /api/v1/games/{id}/reviews", h.APIAuth(h.APICreateReview, models.ScopeReviewsWrite))
+	http.HandleFunc("PUT /api/v1/reviews/{id}", h.APIAuth(h.APIUpdateReview, models.ScopeReviewsWrite))
+	http.HandleFunc("DELETE /api/v1/reviews/{id}", h.APIAuth(h.APIDeleteReview, models.ScopeReviewsWrite))
+	http.HandleFunc("GET /api/v1/cart", h.APIAuth(h.APIGetCart, models.ScopeCartWrite))
+	http.HandleFunc("POST /api/v1/cart/items", h.APIAuth(h.APIAddCartItem, models.ScopeCartWrite))
+	http.HandleFunc("DELETE /api/v1/cart/items/{id}", h.APIAuth(h.APIRemoveCartItem, models.ScopeCartWrite))
+	http.HandleFunc("POST /api/v1/checkout", h.APIAuth(h.APICheckout, models.ScopePurchase))
+	http.HandleFunc("GET /api/v1/orders", h.APIAuth(h.APIListOrders, models.ScopePurchase))
+	http.HandleFunc("GET /api/v1/orders/{id}", h.APIAuth(h.APIGetOrder, models.ScopePurchase))
+	http.HandleFunc("POST /api/v1/orders/{id}/pay", h.APIAuth(h.APIPayOrder, models.ScopePurchase))
+	http.HandleFunc("POST /api/v1/orders/{id}/cancel", h.APIAuth(h.APICancelOrder, models.ScopePurchase))
+	http.HandleFunc("GET /api/v1/library", h.APIAuth(h.APILibrary, models.ScopePurchase))
+	http.HandleFunc("POST /api/v1/library/redeem", h.APIAuth(h.APIRedeemKey, models.ScopePurchase))
 
 	// Public routes
 	http.HandleFunc("/", h.Home)
 	http.HandleFunc("/game", h.GameDetail)
+	http.HandleFunc("/bundles", h.ListBundles)
+	http.HandleFunc("/bundle", h.BundleDetail)
+	http.HandleFunc("/search", h.Search)
 
 	// Static files (single registration)
 	fs := http.FileServer(http.Dir("static"))
 	http.Handle("/static/", http.StripPrefix("/static/", fs))
 
-	log.Println("Server running on http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	log.Printf("Server running on %s", addr)
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
+
+// webhookURL — адрес вебхука платежей: PAYMENT_WEBHOOK_URL или этот же сервер.
+func webhookURL(addr string) string {
+	if u := os.Getenv("PAYMENT_WEBHOOK_URL"); u != "" {
+		return u
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/webhooks/payments"
+}
+
+func setRole(db *sql.DB, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s role <username> <customer|moderator|admin>", os.Args[0])
+	}
+	role := models.Role(args[1])
+	if !role.Valid() {
+		return fmt.Errorf("unknown role %q", args[1])
+	}
+	customers := storage.NewCustomerRepo(db)
+	ctx := context.Background()
+	c, err := customers.GetByUsername(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("user %q: %w", args[0], err)
+	}
+	if err := customers.SetRole(ctx, c.ID, role); err != nil {
+		return err
+	}
+	log.Printf("user %s is now %s", args[0], role)
+	return nil
 }
@@ -2,7 +2,10 @@ module github.com/aml-709/game-store
 
 go 1.25.1
 
-require modernc.org/sqlite v1.39.1
+require (
+	golang.org/x/crypto v0.42.0
+	modernc.org/sqlite v1.39.1
+)
 
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+	"github.com/aml-709/game-store/internal/storage"
+)
+
+const maxTitleLen = 200
+
+// parseGameForm читает и валидирует поля формы игры из admin.html.
+func parseGameForm(r *http.Request) (models.Game, []string) {
+	_ = r.ParseForm()
+	g := models.Game{
+		Title:       strings.TrimSpace(r.FormValue("title")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		ImageURL:    strings.TrimSpace(r.FormValue("image_url")),
+	}
+	// чекбокс идёт после скрытого published=0, поэтому смотрим все значения
+	for _, v := range r.Form["published"] {
+		if v == "1" {
+			g.Published = true
+		}
+	}
+	g.Genres = termIDs(r.Form["genre"])
+	g.Tags = termIDs(r.Form["tag"])
+	var errs []string
+
+	if g.Title == "" {
+		errs = append(errs, "Название обязательно")
+	} else if utf8.RuneCountInString(g.Title) > maxTitleLen {
+		errs = append(errs, "Название не длиннее 200 символов")
+	}
+	if g.Description == "" {
+		errs = append(errs, "Описание обязательно")
+	}
+
+	priceStr := strings.TrimSpace(r.FormValue("price"))
+	price, err := money.Parse(priceStr, money.Default)
+	switch {
+	case priceStr == "":
+		errs = append(errs, "Цена обязательна")
+	case err != nil:
+		errs = append(errs, "Цена должна быть числом не более чем с двумя знаками после запятой")
+	case price.IsNegative():
+		errs = append(errs, "Цена не может быть отрицательной")
+	default:
+		g.Price = price
+	}
+
+	// региональные цены: необязательны, без них игра в этой валюте не продаётся
+	for _, c := range money.Currencies {
+		if c == money.Default {
+			continue
+		}
+		v := strings.TrimSpace(r.FormValue("price_" + string(c)))
+		if v == "" {
+			continue
+		}
+		p, err := money.Parse(v, c)
+		if err != nil || p.IsNegative() {
+			errs = append(errs, "Цена в "+string(c)+" должна быть неотрицательным числом не более чем с двумя знаками после запятой")
+			continue
+		}
+		g.Prices = append(g.Prices, p)
+	}
+
+	if g.ImageURL != "" && !strings.HasPrefix(g.ImageURL, "/static/") {
+		u, err := url.Parse(g.ImageURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, "Ссылка на изображение должна быть http(s)-адресом или путём /static/...")
+		}
+	}
+	return g, errs
+}
+
+// termIDs — отмеченные в форме жанры или теги (в Term важен только ID).
+func termIDs(values []string) []models.Term {
+	var out []models.Term
+	for _, v := range values {
+		if id, err := strconv.Atoi(v); err == nil && id > 0 {
+			out = append(out, models.Term{ID: id})
+		}
+	}
+	return out
+}
+
+// gameFormData — PageData для форм игры: значения формы и справочники жанров и тегов.
+func (h *Handler) gameFormData(r *http.Request, form models.Game, errs []string) PageData {
+	uid, _ := h.getCurrentUser(r)
+	genres, err := h.Genres.List(r.Context())
+	if err != nil {
+		log.Printf("gameFormData: genres error %v", err)
+	}
+	tags, err := h.Tags.List(r.Context())
+	if err != nil {
+		log.Printf("gameFormData: tags error %v", err)
+	}
+	return PageData{
+		UserID:   uid,
+		Username: h.getUsernameByID(r.Context(), uid),
+		Form:     form,
+		Errors:   errs,
+		Genres:   genres,
+		Tags:     tags,
+	}
+}
+
+func (h *Handler) renderAdmin(w http.ResponseWriter, r *http.Request, status int, form models.Game, errs []string) {
+	games, err := h.Games.ListAll(r.Context())
+	if err != nil {
+		log.Printf("renderAdmin: db error %v", err)
+	}
+	data := h.gameFormData(r, form, errs)
+	data.Games = games
+	h.renderTemplateStatus(w, status, "admin.html", data)
+}
+
+// Admin — список всех игр (включая снятые с публикации) и форма добавления
+func (h *Handler) Admin(w http.ResponseWriter, r *http.Request) {
+	h.renderAdmin(w, r, http.StatusOK, models.Game{Published: true}, nil)
+}
+
+// AddGame — POST из admin.html: создаёт игру
+func (h *Handler) AddGame(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	g, errs := parseGameForm(r)
+	if len(errs) > 0 {
+		h.renderAdmin(w, r, http.StatusUnprocessableEntity, g, errs)
+		return
+	}
+	if err := h.Games.Create(r.Context(), &g); err != nil {
+		log.Printf("AddGame: insert error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// EditGame — GET показывает форму редактирования, POST сохраняет изменения
+func (h *Handler) EditGame(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id == 0 {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		g, errs := parseGameForm(r)
+		g.ID = id
+		if len(errs) > 0 {
+			h.renderTemplateStatus(w, http.StatusUnprocessableEntity, "admin_game_edit.html", h.gameFormData(r, g, errs))
+			return
+		}
+		err := h.Games.Update(r.Context(), g)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("EditGame: update error %v", err)
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	g, err := h.Games.Get(r.Context(), id, "")
+	if errors.Is(err, storage.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("EditGame: select error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	h.renderTemplate(w, "admin_game_edit.html", h.gameFormData(r, g, nil))
+}
+
+// SetGamePublished — POST: снимает игру с публикации или возвращает её в каталог
+func (h *Handler) SetGamePublished(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id == 0 {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	published := r.FormValue("published") == "1"
+	if err := h.Games.SetPublished(r.Context(), id, published); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("SetGamePublished: update error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// DeleteGame — POST: удаляет игру, если её ещё никто не покупал.
+// Купленные игры удалять нельзя (сломается история заказов) — их снимают с публикации.
+func (h *Handler) DeleteGame(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id == 0 {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	err = h.Games.Delete(r.Context(), id)
+	if errors.Is(err, storage.ErrGameSold) {
+		h.renderAdmin(w, r, http.StatusConflict, models.Game{Published: true}, []string{"Игру уже покупали — её можно только снять с публикации"})
+		return
+	}
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("DeleteGame: delete error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// AdminUsers — GET список пользователей, POST меняет роль
+func (h *Handler) AdminUsers(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+
+	if r.Method == http.MethodPost {
+		id, err := strconv.Atoi(r.FormValue("id"))
+		role := models.Role(r.FormValue("role"))
+		if err != nil || id == 0 || !role.Valid() {
+			http.Error(w, "Invalid role", http.StatusBadRequest)
+			return
+		}
+		// не даём админу случайно лишить прав самого себя
+		if id == uid && role != models.RoleAdmin {
+			http.Error(w, "Cannot demote yourself", http.StatusBadRequest)
+			return
+		}
+		if err := h.Customers.SetRole(r.Context(), id, role); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("AdminUsers: update error %v", err)
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	users, err := h.Customers.List(r.Context())
+	if err != nil {
+		log.Printf("AdminUsers: db error %v", err)
+	}
+	data := PageData{
+		UserID:   uid,
+		Username: h.getUsernameByID(r.Context(), uid),
+		Users:    users,
+		Form:     models.Roles,
+	}
+	h.renderTemplate(w, "admin_users.html", data)
+}
+
+// termRepo — справочник жанров или тегов по виду из формы.
+func (h *Handler) termRepo(kind models.TermKind) storage.TermRepo {
+	if kind == models.TermTag {
+		return h.Tags
+	}
+	return h.Genres
+}
+
+func (h *Handler) renderAdminTerms(w http.ResponseWriter, r *http.Request, status int, errs []string) {
+	data := h.gameFormData(r, models.Game{}, errs)
+	data.Form = r.PostForm
+	h.renderTemplateStatus(w, status, "admin_terms.html", data)
+}
+
+// AdminTerms — GET справочники жанров и тегов, POST (kind, name) добавляет запись
+func (h *Handler) AdminTerms(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.renderAdminTerms(w, r, http.StatusOK, nil)
+		return
+	}
+	_ = r.ParseForm()
+	kind := models.TermKind(r.PostForm.Get("kind"))
+	name := strings.TrimSpace(r.PostForm.Get("name"))
+	var errs []string
+	switch {
+	case !kind.Valid():
+		errs = append(errs, "Неизвестный справочник")
+	case name == "":
+		errs = append(errs, "Название обязательно")
+	case utf8.RuneCountInString(name) > 50:
+		errs = append(errs, "Название не длиннее 50 символов")
+	case models.Slugify(name) == "":
+		errs = append(errs, "Название должно содержать буквы или цифры")
+	}
+	if len(errs) > 0 {
+		h.renderAdminTerms(w, r, http.StatusUnprocessableEntity, errs)
+		return
+	}
+	_, err := h.termRepo(kind).Create(r.Context(), name)
+	if errors.Is(err, storage.ErrTermExists) {
+		h.renderAdminTerms(w, r, http.StatusConflict, []string{"«" + name + "» уже есть в справочнике"})
+		return
+	}
+	if err != nil {
+		log.Printf("AdminTerms: insert error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/terms", http.StatusSeeOther)
+}
+
+// DeleteTerm — POST (kind, id): удаляет жанр или тег и снимает его со всех игр
+func (h *Handler) DeleteTerm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/terms", http.StatusSeeOther)
+		return
+	}
+	kind := models.TermKind(r.FormValue("kind"))
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id == 0 || !kind.Valid() {
+		http.Redirect(w, r, "/admin/terms", http.StatusSeeOther)
+		return
+	}
+	if err := h.termRepo(kind).Delete(r.Context(), id); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("DeleteTerm: delete error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/terms", http.StatusSeeOther)
+}
@@ -0,0 +1,730 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+	"github.com/aml-709/game-store/internal/payment"
+	"github.com/aml-709/game-store/internal/storage"
+)
+
+// JSON API /api/v1. Успешный ответ — {"data": ...}, ошибка —
+// {"error": {"code": "...", "message": "..."}} с соответствующим HTTP-статусом.
+
+const maxAPIBody = 1 << 20
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("writeJSON: encode error %v", err)
+	}
+}
+
+func apiData(w http.ResponseWriter, status int, data interface{}) {
+	writeJSON(w, status, map[string]interface{}{"data": data})
+}
+
+func apiFail(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]apiError{"error": {Code: code, Message: message}})
+}
+
+// apiInternal логирует ошибку и отвечает 500 без подробностей.
+func apiInternal(w http.ResponseWriter, where string, err error) {
+	log.Printf("%s: %v", where, err)
+	apiFail(w, http.StatusInternalServerError, "internal", "internal server error")
+}
+
+// decodeJSON читает тело запроса в v; неизвестные поля считаются ошибкой.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		msg := "invalid JSON body"
+		if !errors.Is(err, io.EOF) {
+			msg += ": " + err.Error()
+		}
+		apiFail(w, http.StatusBadRequest, "bad_request", msg)
+		return false
+	}
+	return true
+}
+
+// pathID читает числовой параметр пути ({id}).
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil || id <= 0 {
+		apiFail(w, http.StatusBadRequest, "bad_request", "invalid "+name)
+		return 0, false
+	}
+	return id, true
+}
+
+// APIAuth — как AuthMiddleware, но вместо редиректа на /login отвечает 401 в JSON.
+func (h *Handler) APIAuth(next http.HandlerFunc, scopes ...models.Scope) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := h.currentPrincipal(r)
+		if err != nil || p.UserID == 0 {
+			apiUnauthorized(w, err)
+			return
+		}
+		if !p.allows(scopes) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+			apiFail(w, http.StatusForbidden, "insufficient_scope", "token lacks required scope")
+			return
+		}
+		next(w, withPrincipal(r, p))
+	}
+}
+
+// APIPublic — для открытых эндпоинтов: аноним проходит как есть, но если учётные
+// данные переданы, они должны быть верными, а токен — иметь нужные права.
+func (h *Handler) APIPublic(next http.HandlerFunc, scopes ...models.Scope) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := h.currentPrincipal(r)
+		if errors.Is(err, errInvalidToken) {
+			apiUnauthorized(w, err)
+			return
+		}
+		if err != nil || p.UserID == 0 {
+			next(w, r)
+			return
+		}
+		if !p.allows(scopes) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+			apiFail(w, http.StatusForbidden, "insufficient_scope", "token lacks required scope")
+			return
+		}
+		next(w, withPrincipal(r, p))
+	}
+}
+
+func apiUnauthorized(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidToken) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		apiFail(w, http.StatusUnauthorized, "invalid_token", "access token is invalid or revoked")
+		return
+	}
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	apiFail(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+}
+
+// APINotFound — ответ для неизвестных путей под /api/v1/.
+func (h *Handler) APINotFound(w http.ResponseWriter, r *http.Request) {
+	apiFail(w, http.StatusNotFound, "not_found", "no such endpoint")
+}
+
+// --- Каталог ---
+
+// apiCurrency — валюта цен в ответах каталога: ?currency= или настройка покупателя; неизвестная — 400.
+func (h *Handler) apiCurrency(w http.ResponseWriter, r *http.Request) (money.Currency, bool) {
+	uid, _ := h.getCurrentUser(r)
+	cur, err := h.catalogCurrency(r, uid)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, "bad_request", err.Error())
+		return cur, false
+	}
+	return cur, true
+}
+
+// APIListGames — GET /api/v1/games?genre=&tag=&min_price=&max_price=&min_rating=&sort=&page=&per_page=&currency=
+// Кроме data отдаёт meta с номером страницы и общим числом игр.
+func (h *Handler) APIListGames(w http.ResponseWriter, r *http.Request) {
+	cur, ok := h.apiCurrency(w, r)
+	if !ok {
+		return
+	}
+	gq, err := parseGameQuery(r.URL.Query(), cur)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	games, total, err := h.Games.Browse(r.Context(), gq)
+	if err != nil {
+		apiInternal(w, "APIListGames", err)
+		return
+	}
+	if games == nil {
+		games = []models.Game{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": games,
+		"meta": apiPageMeta{Page: gq.Page, PerPage: gq.PerPage, Total: total, Pages: (total + gq.PerPage - 1) / gq.PerPage, Sort: string(gq.Sort)},
+	})
+}
+
+// apiPageMeta — сведения о странице в ответах со списками.
+type apiPageMeta struct {
+	Page    int    `json:"page"`
+	PerPage int    `json:"per_page"`
+	Total   int    `json:"total"`
+	Pages   int    `json:"pages"`
+	Sort    string `json:"sort,omitempty"`
+}
+
+// APIFacets — GET /api/v1/facets: счётчики фасетов для тех же фильтров, что у /api/v1/games
+func (h *Handler) APIFacets(w http.ResponseWriter, r *http.Request) {
+	cur, ok := h.apiCurrency(w, r)
+	if !ok {
+		return
+	}
+	f, err := parseGameFilter(r.URL.Query(), cur)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	facets, err := h.Games.Facets(r.Context(), f)
+	if err != nil {
+		apiInternal(w, "APIFacets", err)
+		return
+	}
+	apiData(w, http.StatusOK, facets)
+}
+
+// publishedGame возвращает опубликованную игру с ценой в валюте cur или пишет 404.
+func (h *Handler) publishedGame(w http.ResponseWriter, r *http.Request, id int, cur money.Currency) (models.Game, bool) {
+	g, err := h.Games.Get(r.Context(), id, cur)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && !g.Published) {
+		apiFail(w, http.StatusNotFound, "not_found", "game not found")
+		return g, false
+	}
+	if err != nil {
+		apiInternal(w, "publishedGame", err)
+		return g, false
+	}
+	return g, true
+}
+
+// APIGetGame — GET /api/v1/games/{id}?currency=
+func (h *Handler) APIGetGame(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	cur, ok := h.apiCurrency(w, r)
+	if !ok {
+		return
+	}
+	if g, ok := h.publishedGame(w, r, id, cur); ok {
+		apiData(w, http.StatusOK, g)
+	}
+}
+
+// --- Отзывы ---
+
+type reviewRequest struct {
+	Rating int    `json:"rating"`
+	Text   string `json:"text"`
+}
+
+func (req reviewRequest) validate() string {
+	if req.Rating < 1 || req.Rating > 5 {
+		return "rating must be between 1 and 5"
+	}
+	if utf8.RuneCountInString(req.Text) > 1000 {
+		return "text must be at most 1000 characters"
+	}
+	return ""
+}
+
+// APIListReviews — GET /api/v1/games/{id}/reviews
+func (h *Handler) APIListReviews(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if _, ok := h.publishedGame(w, r, id, ""); !ok {
+		return
+	}
+	reviews, err := h.Reviews.ListByGame(r.Context(), id)
+	if err != nil {
+		apiInternal(w, "APIListReviews", err)
+		return
+	}
+	if reviews == nil {
+		reviews = []models.Review{}
+	}
+	apiData(w, http.StatusOK, reviews)
+}
+
+// APICreateReview — POST /api/v1/games/{id}/reviews
+func (h *Handler) APICreateReview(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req reviewRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		apiFail(w, http.StatusUnprocessableEntity, "validation_failed", msg)
+		return
+	}
+	if _, ok := h.publishedGame(w, r, id, ""); !ok {
+		return
+	}
+	rv := models.Review{GameID: id, UserID: uid, Rating: req.Rating, Text: strings.TrimSpace(req.Text), CreatedAt: time.Now()}
+	if err := h.Reviews.Create(r.Context(), &rv); err != nil {
+		apiInternal(w, "APICreateReview", err)
+		return
+	}
+	rv.Author = h.getUsernameByID(r.Context(), uid)
+	apiData(w, http.StatusCreated, rv)
+}
+
+// ownReview загружает отзыв и проверяет право на изменение (автор; удалять может и модератор).
+func (h *Handler) ownReview(w http.ResponseWriter, r *http.Request, allowModerator bool) (models.Review, bool) {
+	uid, _ := h.getCurrentUser(r)
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return models.Review{}, false
+	}
+	rv, err := h.Reviews.Get(r.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		apiFail(w, http.StatusNotFound, "not_found", "review not found")
+		return rv, false
+	}
+	if err != nil {
+		apiInternal(w, "ownReview", err)
+		return rv, false
+	}
+	if rv.UserID != uid && !(allowModerator && h.getRoleByID(r.Context(), uid).AtLeast(models.RoleModerator)) {
+		apiFail(w, http.StatusForbidden, "forbidden", "not your review")
+		return rv, false
+	}
+	return rv, true
+}
+
+// APIUpdateReview — PUT /api/v1/reviews/{id}
+func (h *Handler) APIUpdateReview(w http.ResponseWriter, r *http.Request) {
+	rv, ok := h.ownReview(w, r, false)
+	if !ok {
+		return
+	}
+	var req reviewRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		apiFail(w, http.StatusUnprocessableEntity, "validation_failed", msg)
+		return
+	}
+	rv.Rating, rv.Text, rv.CreatedAt = req.Rating, strings.TrimSpace(req.Text), time.Now()
+	if err := h.Reviews.Update(r.Context(), rv); err != nil {
+		apiInternal(w, "APIUpdateReview", err)
+		return
+	}
+	apiData(w, http.StatusOK, rv)
+}
+
+// APIDeleteReview — DELETE /api/v1/reviews/{id}
+func (h *Handler) APIDeleteReview(w http.ResponseWriter, r *http.Request) {
+	rv, ok := h.ownReview(w, r, true)
+	if !ok {
+		return
+	}
+	if err := h.Reviews.Delete(r.Context(), rv.ID); err != nil {
+		apiInternal(w, "APIDeleteReview", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// --- Корзина ---
+
+// writeCart отвечает корзиной со скидками; ?coupon= — с купоном (так его можно проверить до оформления).
+func (h *Handler) writeCart(w http.ResponseWriter, r *http.Request, status int) {
+	uid, _ := h.getCurrentUser(r)
+	items, applied, err := h.Carts.Quote(r.Context(), uid, h.preferredCurrency(r.Context(), uid), r.URL.Query().Get("coupon"))
+	if apiCouponError(w, err) {
+		return
+	}
+	if err != nil {
+		apiInternal(w, "writeCart", err)
+		return
+	}
+	if items == nil {
+		items = []models.CartItem{}
+	}
+	if applied == nil {
+		applied = []models.AppliedPromotion{}
+	}
+	total, err := models.CartTotal(items)
+	if err != nil {
+		apiInternal(w, "writeCart", err)
+		return
+	}
+	apiData(w, status, map[string]interface{}{"items": items, "promotions": applied, "total": total})
+}
+
+// APIGetCart — GET /api/v1/cart[?coupon=CODE]
+func (h *Handler) APIGetCart(w http.ResponseWriter, r *http.Request) {
+	h.writeCart(w, r, http.StatusOK)
+}
+
+// APIAddCartItem — POST /api/v1/cart/items {"game_id": 1, "quantity": 1, "gift": false}
+// Личная копия — одна (quantity 1) и только если игры нет в библиотеке; копий в подарок
+// (gift: true) можно несколько, они складываются до models.MaxGiftCopies.
+// {"bundle_id": 2} кладёт в корзину набор.
+func (h *Handler) APIAddCartItem(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	var req struct {
+		GameID   int  `json:"game_id"`
+		BundleID int  `json:"bundle_id"`
+		Quantity int  `json:"quantity"`
+		Gift     bool `json:"gift"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.BundleID != 0 {
+		h.apiAddBundle(w, r, uid, req.BundleID, req.GameID != 0 || req.Gift || req.Quantity > 1)
+		return
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	if req.Quantity < 0 {
+		apiFail(w, http.StatusUnprocessableEntity, "validation_failed", "quantity must be positive")
+		return
+	}
+	if !req.Gift && req.Quantity > 1 {
+		apiFail(w, http.StatusUnprocessableEntity, "validation_failed", "a personal copy has quantity 1; add extra copies with gift: true")
+		return
+	}
+	if req.Quantity > models.MaxGiftCopies {
+		apiFail(w, http.StatusUnprocessableEntity, "validation_failed", fmt.Sprintf("at most %d gift copies per game", models.MaxGiftCopies))
+		return
+	}
+	g, ok := h.publishedGame(w, r, req.GameID, h.preferredCurrency(r.Context(), uid))
+	if !ok {
+		return
+	}
+	if g.Unavailable {
+		apiFail(w, http.StatusUnprocessableEntity, "price_unavailable", "game is not sold in your currency")
+		return
+	}
+	err := h.Carts.Add(r.Context(), uid, req.GameID, req.Quantity, req.Gift)
+	if errors.Is(err, storage.ErrAlreadyOwned) {
+		apiFail(w, http.StatusConflict, "already_owned", "game is already in your library; add it with gift: true to buy a copy for someone else")
+		return
+	}
+	if err != nil {
+		apiInternal(w, "APIAddCartItem", err)
+		return
+	}
+	h.writeCart(w, r, http.StatusCreated)
+}
+
+// apiAddBundle — POST /api/v1/cart/items с bundle_id: набор — одна личная строка корзины.
+func (h *Handler) apiAddBundle(w http.ResponseWriter, r *http.Request, uid, bundleID int, extra bool) {
+	if extra {
+		apiFail(w, http.StatusUnprocessableEntity, "validation_failed", "a bundle is added alone, once, for yourself: pass only bundle_id")
+		return
+	}
+	b, err := h.Bundles.Get(r.Context(), bundleID, uid)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && !b.Published) {
+		apiFail(w, http.StatusNotFound, "not_found", "bundle not found")
+		return
+	}
+	if err != nil {
+		apiInternal(w, "APIAddCartItem", err)
+		return
+	}
+	if b.Price.Currency != h.preferredCurrency(r.Context(), uid) {
+		apiFail(w, http.StatusUnprocessableEntity, "price_unavailable", "bundle is not sold in your currency")
+		return
+	}
+	err = h.Carts.AddBundle(r.Context(), uid, bundleID)
+	if errors.Is(err, storage.ErrAlreadyOwned) {
+		apiFail(w, http.StatusConflict, "already_owned", "all games of the bundle are already in your library")
+		return
+	}
+	if err != nil {
+		apiInternal(w, "APIAddCartItem", err)
+		return
+	}
+	h.writeCart(w, r, http.StatusCreated)
+}
+
+// APIRemoveCartItem — DELETE /api/v1/cart/items/{id} (id строки корзины)
+func (h *Handler) APIRemoveCartItem(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.Carts.Remove(r.Context(), uid, id); err != nil {
+		apiInternal(w, "APIRemoveCartItem", err)
+		return
+	}
+	h.writeCart(w, r, http.StatusOK)
+}
+
+// --- Заказы ---
+
+// APICheckout — POST /api/v1/checkout [{"coupon": "CODE"}]: корзина превращается в неоплаченный заказ.
+// "gifts": [{"cart_item_id": 3, "recipient": "имя или email", "message": "..."}] — получатели
+// строк с одной копией в подарок; при оплате игра попадает в их библиотеку.
+func (h *Handler) APICheckout(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	key, ok := apiIdempotencyKey(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Coupon string        `json:"coupon"`
+		Gifts  []giftRequest `json:"gifts"`
+	}
+	if r.ContentLength != 0 && !decodeJSON(w, r, &req) {
+		return
+	}
+	cur := h.preferredCurrency(r.Context(), uid)
+	var gifts map[int]models.Gift
+	if len(req.Gifts) > 0 {
+		items, err := h.Carts.Items(r.Context(), uid, cur)
+		if err != nil {
+			apiInternal(w, "APICheckout", err)
+			return
+		}
+		var giftErrs []*giftError
+		gifts, giftErrs, err = h.resolveGifts(r.Context(), uid, items, req.Gifts)
+		if err != nil {
+			apiInternal(w, "APICheckout", err)
+			return
+		}
+		if len(giftErrs) > 0 {
+			apiFail(w, http.StatusUnprocessableEntity, "invalid_gift", giftErrs[0].Error())
+			return
+		}
+	}
+	order, err := h.Orders.CreateFromCart(r.Context(), uid, cur, req.Coupon, key, gifts)
+	if errors.Is(err, storage.ErrIdempotentReplay) {
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		err = nil
+	}
+	if errors.Is(err, storage.ErrEmptyCart) {
+		apiFail(w, http.StatusUnprocessableEntity, "empty_cart", "cart is empty")
+		return
+	}
+	if errors.Is(err, storage.ErrPriceUnavailable) {
+		apiFail(w, http.StatusUnprocessableEntity, "price_unavailable", "some games in the cart are not sold in your currency")
+		return
+	}
+	if errors.Is(err, storage.ErrAlreadyOwned) {
+		apiFail(w, http.StatusConflict, "already_owned", "some games in the cart are already in your library")
+		return
+	}
+	if errors.Is(err, storage.ErrInvalidGift) {
+		apiFail(w, http.StatusConflict, "invalid_gift", "a gift recipient refers to a cart item that is not a single gift copy")
+		return
+	}
+	if apiCouponError(w, err) {
+		return
+	}
+	if err != nil {
+		apiInternal(w, "APICheckout", err)
+		return
+	}
+	apiData(w, http.StatusCreated, order)
+}
+
+// ownOrder загружает заказ текущего пользователя (чужой заказ — 404, чтобы не раскрывать id).
+func (h *Handler) ownOrder(w http.ResponseWriter, r *http.Request) (models.Order, bool) {
+	uid, _ := h.getCurrentUser(r)
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return models.Order{}, false
+	}
+	order, err := h.Orders.Get(r.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && order.UserID != uid) {
+		apiFail(w, http.StatusNotFound, "not_found", "order not found")
+		return order, false
+	}
+	if err != nil {
+		apiInternal(w, "ownOrder", err)
+		return order, false
+	}
+	return order, true
+}
+
+// APIListOrders — GET /api/v1/orders
+func (h *Handler) APIListOrders(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	orders, err := h.Orders.ListByUser(r.Context(), uid)
+	if err != nil {
+		apiInternal(w, "APIListOrders", err)
+		return
+	}
+	if orders == nil {
+		orders = []models.Order{}
+	}
+	apiData(w, http.StatusOK, orders)
+}
+
+// APIGetOrder — GET /api/v1/orders/{id}
+func (h *Handler) APIGetOrder(w http.ResponseWriter, r *http.Request) {
+	if order, ok := h.ownOrder(w, r); ok {
+		apiData(w, http.StatusOK, order)
+	}
+}
+
+// APIPayOrder — POST /api/v1/orders/{id}/pay: начинает оплату у провайдера. В ответе платёж
+// и redirect_url страницы оплаты; заказ станет оплаченным по событию провайдера.
+func (h *Handler) APIPayOrder(w http.ResponseWriter, r *http.Request) {
+	order, ok := h.ownOrder(w, r)
+	if !ok {
+		return
+	}
+	key, ok := apiIdempotencyKey(w, r)
+	if !ok {
+		return
+	}
+	// повтор отвечает как в первый раз, даже если заказ с тех пор оплатили
+	if p, in, found, err := h.replayedPayment(r.Context(), order, key); found || err != nil {
+		if err == nil {
+			err = storage.ErrIdempotentReplay
+		}
+		apiPaymentStarted(w, p, in, err)
+		return
+	}
+	if order.Paid {
+		apiFail(w, http.StatusConflict, "already_paid", "order is already paid")
+		return
+	}
+	if !order.Status.Payable() {
+		apiFail(w, http.StatusConflict, "invalid_status", "order is "+string(order.Status))
+		return
+	}
+	p, in, err := h.startPayment(r.Context(), order, key)
+	if errors.Is(err, storage.ErrInvalidTransition) {
+		apiFail(w, http.StatusConflict, "invalid_status", "order can no longer be paid")
+		return
+	}
+	apiPaymentStarted(w, p, in, err)
+}
+
+// apiPaymentStarted — ответ на начало оплаты; storage.ErrIdempotentReplay — повтор с тем же
+// результатом, что и в первый раз.
+func apiPaymentStarted(w http.ResponseWriter, p models.Payment, in payment.Intent, err error) {
+	if errors.Is(err, errIdempotencyKeyReused) {
+		apiFail(w, http.StatusUnprocessableEntity, "idempotency_key_reused", err.Error())
+		return
+	}
+	if errors.Is(err, storage.ErrIdempotentReplay) {
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		err = nil
+	}
+	if err != nil {
+		apiInternal(w, "APIPayOrder", err)
+		return
+	}
+	apiData(w, http.StatusCreated, map[string]interface{}{"payment": p, "redirect_url": in.RedirectURL})
+}
+
+// apiIdempotencyKey — ключ из заголовка Idempotency-Key; недопустимый — 400.
+func apiIdempotencyKey(w http.ResponseWriter, r *http.Request) (string, bool) {
+	key, err := requestIdempotencyKey(r)
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, "invalid_idempotency_key", err.Error())
+		return "", false
+	}
+	return key, true
+}
+
+// APICancelOrder — POST /api/v1/orders/{id}/cancel: отмена неоплаченного заказа и начатых попыток оплаты.
+func (h *Handler) APICancelOrder(w http.ResponseWriter, r *http.Request) {
+	order, ok := h.ownOrder(w, r)
+	if !ok {
+		return
+	}
+	err := h.cancelOrder(r.Context(), order)
+	if errors.Is(err, storage.ErrInvalidTransition) {
+		apiFail(w, http.StatusConflict, "invalid_status", "order is "+string(order.Status))
+		return
+	}
+	if errors.Is(err, errPaymentInFlight) {
+		apiFail(w, http.StatusConflict, "payment_in_progress", "order payment has already gone through and will be marked paid shortly")
+		return
+	}
+	if err != nil {
+		apiInternal(w, "APICancelOrder", err)
+		return
+	}
+	if order, ok = h.ownOrder(w, r); ok {
+		apiData(w, http.StatusOK, order)
+	}
+}
+
+// APILibrary — GET /api/v1/library
+func (h *Handler) APILibrary(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	games, err := h.Libraries.List(r.Context(), uid)
+	if err != nil {
+		apiInternal(w, "APILibrary", err)
+		return
+	}
+	if games == nil {
+		games = []models.Game{}
+	}
+	apiData(w, http.StatusOK, games)
+}
+
+// APIRedeemKey — POST /api/v1/library/redeem {"code": "XXXXX-XXXXX-XXXXX"}: активирует ключ
+// и возвращает игру, добавленную в библиотеку.
+func (h *Handler) APIRedeemKey(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	var req struct {
+		Code string `json:"code"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	code := models.NormalizeKey(req.Code)
+	if !models.ValidKeyCode(code) {
+		apiFail(w, http.StatusNotFound, "not_found", "activation key not found")
+		return
+	}
+	k, err := h.Keys.Redeem(r.Context(), uid, code)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		apiFail(w, http.StatusNotFound, "not_found", "activation key not found")
+		return
+	case errors.Is(err, storage.ErrKeyRedeemed):
+		apiFail(w, http.StatusConflict, "key_redeemed", "activation key has already been redeemed")
+		return
+	case errors.Is(err, storage.ErrKeyRevoked):
+		apiFail(w, http.StatusConflict, "key_revoked", "activation key has been revoked")
+		return
+	case errors.Is(err, storage.ErrAlreadyOwned):
+		apiFail(w, http.StatusConflict, "already_owned", "game is already in your library; the key was not redeemed")
+		return
+	case err != nil:
+		apiInternal(w, "APIRedeemKey", err)
+		return
+	}
+	log.Printf("APIRedeemKey: key %d for game %d redeemed by user %d", k.ID, k.GameID, uid)
+	g, err := h.Games.Get(r.Context(), k.GameID, h.preferredCurrency(r.Context(), uid))
+	if err != nil {
+		apiInternal(w, "APIRedeemKey", err)
+		return
+	}
+	apiData(w, http.StatusCreated, g)
+}
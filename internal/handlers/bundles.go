@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+	"github.com/aml-709/game-store/internal/storage"
+)
+
+// minBundleGames — в наборе должно быть хотя бы столько игр.
+const minBundleGames = 2
+
+// ListBundles — GET /bundles: опубликованные наборы.
+func (h *Handler) ListBundles(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	bundles, err := h.Bundles.List(r.Context(), false)
+	if err != nil {
+		log.Printf("Bundles: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	cur, _ := h.catalogCurrency(r, uid)
+	data := PageData{
+		UserID:   uid,
+		Username: h.getUsernameByID(r.Context(), uid),
+		Bundles:  bundles,
+		Currency: cur,
+	}
+	h.renderTemplate(w, "bundles.html", data)
+}
+
+// BundleDetail — GET /bundle?id=: игры набора и его цена для покупателя (без игр, которые у него уже есть).
+func (h *Handler) BundleDetail(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	b, err := h.Bundles.Get(r.Context(), id, uid)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && !b.Published && !h.getRoleByID(r.Context(), uid).AtLeast(models.RoleAdmin)) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("BundleDetail: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	cur, _ := h.catalogCurrency(r, uid)
+	data := PageData{
+		UserID:   uid,
+		Username: h.getUsernameByID(r.Context(), uid),
+		Bundle:   b,
+		Currency: cur,
+	}
+	h.renderTemplate(w, "bundle.html", data)
+}
+
+// AddBundleToCart — POST /add-bundle-to-cart (id): кладёт набор в корзину одной строкой.
+func (h *Handler) AddBundleToCart(w http.ResponseWriter, r *http.Request) {
+	uid, err := h.getCurrentUser(r)
+	if err != nil || uid == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/bundles", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, "/bundles", http.StatusSeeOther)
+		return
+	}
+	back := "/bundle?id=" + strconv.Itoa(id)
+	b, err := h.Bundles.Get(r.Context(), id, uid)
+	if err != nil || !b.Published {
+		http.Redirect(w, r, "/bundles", http.StatusSeeOther)
+		return
+	}
+	if b.Price.Currency != h.preferredCurrency(r.Context(), uid) {
+		// в валюте покупателя набор не продаётся — на странице набора это видно
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	err = h.Carts.AddBundle(r.Context(), uid, id)
+	if errors.Is(err, storage.ErrAlreadyOwned) {
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("AddBundleToCart: insert error %v", err)
+	}
+	http.Redirect(w, r, "/cart", http.StatusSeeOther)
+}
+
+// parseBundleForm читает и валидирует форму набора из bundle_form.html.
+func parseBundleForm(r *http.Request) (models.Bundle, []string) {
+	_ = r.ParseForm()
+	b := models.Bundle{
+		Title:       strings.TrimSpace(r.FormValue("title")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		ImageURL:    strings.TrimSpace(r.FormValue("image_url")),
+	}
+	for _, v := range r.Form["published"] {
+		if v == "1" {
+			b.Published = true
+		}
+	}
+	for _, v := range uniqueValues(r.Form["game"]) {
+		if id, err := strconv.Atoi(v); err == nil && id > 0 {
+			b.Games = append(b.Games, models.BundleGame{ID: id})
+		}
+	}
+	var errs []string
+	if b.Title == "" {
+		errs = append(errs, "Название обязательно")
+	} else if utf8.RuneCountInString(b.Title) > maxTitleLen {
+		errs = append(errs, "Название не длиннее 200 символов")
+	}
+	cur := money.Currency(r.FormValue("currency"))
+	price, err := money.Parse(strings.TrimSpace(r.FormValue("price")), cur)
+	if !cur.Valid() || err != nil || price.IsNegative() {
+		errs = append(errs, "Цена — неотрицательное число в одной из валют магазина")
+	}
+	b.Price = price
+	if len(b.Games) < minBundleGames {
+		errs = append(errs, "В наборе должно быть хотя бы две игры")
+	}
+	if b.ImageURL != "" && !strings.HasPrefix(b.ImageURL, "/static/") {
+		u, err := url.Parse(b.ImageURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, "Ссылка на изображение должна быть http(s)-адресом или путём /static/...")
+		}
+	}
+	return b, errs
+}
+
+// bundleFormData — PageData для форм набора: значения формы и все игры для выбора состава.
+func (h *Handler) bundleFormData(r *http.Request, form models.Bundle, errs []string) PageData {
+	uid, _ := h.getCurrentUser(r)
+	games, err := h.Games.ListAll(r.Context())
+	if err != nil {
+		log.Printf("bundleFormData: games error %v", err)
+	}
+	return PageData{
+		UserID:   uid,
+		Username: h.getUsernameByID(r.Context(), uid),
+		Games:    games,
+		Form:     form,
+		Errors:   errs,
+	}
+}
+
+func (h *Handler) renderAdminBundles(w http.ResponseWriter, r *http.Request, status int, form models.Bundle, errs []string) {
+	bundles, err := h.Bundles.List(r.Context(), true)
+	if err != nil {
+		log.Printf("AdminBundles: db error %v", err)
+	}
+	data := h.bundleFormData(r, form, errs)
+	data.Bundles = bundles
+	h.renderTemplateStatus(w, status, "admin_bundles.html", data)
+}
+
+// AdminBundles — GET /admin/bundles: все наборы и форма нового, POST — создаёт набор.
+func (h *Handler) AdminBundles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.renderAdminBundles(w, r, http.StatusOK, models.Bundle{Published: true, Price: money.New(0, money.Default)}, nil)
+		return
+	}
+	b, errs := parseBundleForm(r)
+	if len(errs) > 0 {
+		h.renderAdminBundles(w, r, http.StatusUnprocessableEntity, b, errs)
+		return
+	}
+	if err := h.Bundles.Create(r.Context(), &b); err != nil {
+		log.Printf("AdminBundles: insert error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("AdminBundles: bundle %d %q created with %d games", b.ID, b.Title, len(b.Games))
+	http.Redirect(w, r, "/admin/bundles", http.StatusSeeOther)
+}
+
+// EditBundle — GET /admin/bundles/edit?id= показывает форму набора, POST сохраняет изменения.
+func (h *Handler) EditBundle(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id == 0 {
+		http.Redirect(w, r, "/admin/bundles", http.StatusSeeOther)
+		return
+	}
+	if r.Method == http.MethodPost {
+		b, errs := parseBundleForm(r)
+		b.ID = id
+		if len(errs) > 0 {
+			h.renderTemplateStatus(w, http.StatusUnprocessableEntity, "admin_bundle_edit.html", h.bundleFormData(r, b, errs))
+			return
+		}
+		err := h.Bundles.Update(r.Context(), b)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("EditBundle: update error %v", err)
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/admin/bundles", http.StatusSeeOther)
+		return
+	}
+
+	b, err := h.Bundles.Get(r.Context(), id, 0)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("EditBundle: select error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	h.renderTemplate(w, "admin_bundle_edit.html", h.bundleFormData(r, b, nil))
+}
+
+// SetBundlePublished — POST /admin/bundles/publish (id, published=0|1): снимает набор с продажи
+// (и убирает из корзин) или возвращает его.
+func (h *Handler) SetBundlePublished(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/bundles", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id == 0 {
+		http.Redirect(w, r, "/admin/bundles", http.StatusSeeOther)
+		return
+	}
+	if err := h.Bundles.SetPublished(r.Context(), id, r.FormValue("published") == "1"); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("SetBundlePublished: update error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/bundles", http.StatusSeeOther)
+}
+
+// DeleteBundle — POST /admin/bundles/delete (id): удаляет набор, если его ещё никто не покупал.
+func (h *Handler) DeleteBundle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/bundles", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id == 0 {
+		http.Redirect(w, r, "/admin/bundles", http.StatusSeeOther)
+		return
+	}
+	err = h.Bundles.Delete(r.Context(), id)
+	if errors.Is(err, storage.ErrBundleSold) {
+		h.renderAdminBundles(w, r, http.StatusConflict, models.Bundle{Published: true, Price: money.New(0, money.Default)},
+			[]string{"Набор уже покупали — его можно только снять с продажи"})
+		return
+	}
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("DeleteBundle: delete error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/bundles", http.StatusSeeOther)
+}
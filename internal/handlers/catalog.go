@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+	"github.com/aml-709/game-store/internal/storage"
+)
+
+// Параметры фильтров каталога в адресной строке: /?genre=rpg&tag=coop&min_price=10&max_price=29.99&min_rating=4
+const (
+	paramGenre     = "genre"
+	paramTag       = "tag"
+	paramMinPrice  = "min_price"
+	paramMaxPrice  = "max_price"
+	paramMinRating = "min_rating"
+	paramSort      = "sort"
+	paramPage      = "page"
+	paramPerPage   = "per_page"
+)
+
+// parseGameFilter читает фильтры каталога из query; цены — в валюте cur. Ошибочные значения
+// пропускаются, а первая ошибка возвращается — HTML-страница её игнорирует, API отвечает 400.
+func parseGameFilter(q url.Values, cur money.Currency) (storage.GameFilter, error) {
+	f := storage.GameFilter{Currency: cur}
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	f.Genres = uniqueValues(q[paramGenre])
+	f.Tags = uniqueValues(q[paramTag])
+
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{{paramMinPrice, &f.MinPrice}, {paramMaxPrice, &f.MaxPrice}} {
+		v := strings.TrimSpace(q.Get(p.name))
+		if v == "" {
+			continue
+		}
+		a, err := money.Parse(v, cur)
+		if err != nil || a.IsNegative() {
+			fail(fmt.Errorf("%s must be a non-negative amount", p.name))
+			continue
+		}
+		*p.dst = a.Minor
+	}
+	if v := q.Get(paramMinRating); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 5 {
+			fail(fmt.Errorf("%s must be between 1 and 5", paramMinRating))
+		} else {
+			f.MinRating = n
+		}
+	}
+	return f, firstErr
+}
+
+// parseGameQuery — фильтры плюс сортировка и страница (?sort=price_asc&page=2&per_page=24).
+func parseGameQuery(q url.Values, cur money.Currency) (storage.GameQuery, error) {
+	f, firstErr := parseGameFilter(q, cur)
+	gq := storage.GameQuery{GameFilter: f, Sort: storage.SortNewest, Page: 1, PerPage: storage.DefaultPerPage}
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if v := q.Get(paramSort); v != "" {
+		if s := storage.GameSort(v); s.Valid() {
+			gq.Sort = s
+		} else {
+			fail(fmt.Errorf("unknown %s %q", paramSort, v))
+		}
+	}
+	if v := q.Get(paramPage); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 1 {
+			gq.Page = n
+		} else {
+			fail(fmt.Errorf("%s must be a positive integer", paramPage))
+		}
+	}
+	if v := q.Get(paramPerPage); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 1 && n <= storage.MaxPerPage {
+			gq.PerPage = n
+		} else {
+			fail(fmt.Errorf("%s must be between 1 and %d", paramPerPage, storage.MaxPerPage))
+		}
+	}
+	return gq, firstErr
+}
+
+func uniqueValues(vs []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, v := range vs {
+		v = strings.TrimSpace(v)
+		if v != "" && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// facetLink — значение фасета на главной: ссылка включает или выключает фильтр.
+type facetLink struct {
+	Label    string
+	Count    int
+	Selected bool
+	Href     string
+}
+
+// catalogFacets — фасеты главной страницы и состояние формы диапазона цен.
+type catalogFacets struct {
+	Genres, Tags, Prices, Ratings []facetLink
+	MinPrice, MaxPrice            string
+	Hidden                        url.Values // остальные фильтры для формы цены
+	Active                        bool
+}
+
+// catalogHref — ссылка на главную с параметрами q.
+func catalogHref(q url.Values) string {
+	if len(q) == 0 {
+		return "/"
+	}
+	return "/?" + q.Encode()
+}
+
+// withParam копирует q и даёт fn его изменить.
+func withParam(q url.Values, fn func(url.Values)) url.Values {
+	c := url.Values{}
+	for k, vs := range q {
+		c[k] = append([]string(nil), vs...)
+	}
+	fn(c)
+	return c
+}
+
+// toggleValue добавляет value в многозначный параметр key или убирает его оттуда.
+func toggleValue(q url.Values, key, value string) (url.Values, bool) {
+	selected := false
+	for _, v := range q[key] {
+		if v == value {
+			selected = true
+		}
+	}
+	return withParam(q, func(c url.Values) {
+		if !selected {
+			c.Add(key, value)
+			return
+		}
+		var rest []string
+		for _, v := range c[key] {
+			if v != value {
+				rest = append(rest, v)
+			}
+		}
+		c[key] = rest
+		if len(rest) == 0 {
+			c.Del(key)
+		}
+	}), selected
+}
+
+// priceParam — цена из минорных единиц валюты c для query (?max_price=9.99).
+func priceParam(minor int64, c money.Currency) string {
+	return money.New(minor, c).Short()
+}
+
+// priceLabel — подпись диапазона. Верхняя граница включительная, поэтому 9.99
+// показываем как «до 10».
+func priceLabel(b models.PriceFacet) string {
+	symbol := b.Min.Currency.Symbol()
+	upper := money.New(b.Max.Minor+1, b.Max.Currency)
+	switch {
+	case b.Max.IsZero():
+		return fmt.Sprintf("от %s %s", b.Min.Short(), symbol)
+	case b.Min.IsZero():
+		return fmt.Sprintf("до %s %s", upper.Short(), symbol)
+	}
+	return fmt.Sprintf("%s–%s %s", b.Min.Short(), upper.Short(), symbol)
+}
+
+// buildCatalogFacets строит ссылки фасетов; смена фильтра возвращает на первую страницу,
+// сортировка и размер страницы сохраняются.
+func buildCatalogFacets(q url.Values, f storage.GameFilter, fc models.Facets) catalogFacets {
+	q = withParam(q, func(c url.Values) { c.Del(paramPage) })
+	out := catalogFacets{
+		Hidden: withParam(q, func(c url.Values) { c.Del(paramMinPrice); c.Del(paramMaxPrice) }),
+		Active: len(f.Genres) > 0 || len(f.Tags) > 0 || f.MinPrice > 0 || f.MaxPrice > 0 || f.MinRating > 0,
+	}
+	if f.MinPrice > 0 {
+		out.MinPrice = priceParam(f.MinPrice, f.Currency)
+	}
+	if f.MaxPrice > 0 {
+		out.MaxPrice = priceParam(f.MaxPrice, f.Currency)
+	}
+	for _, t := range fc.Genres {
+		next, selected := toggleValue(q, paramGenre, t.Slug)
+		out.Genres = append(out.Genres, facetLink{Label: t.Name, Count: t.Count, Selected: selected, Href: catalogHref(next)})
+	}
+	for _, t := range fc.Tags {
+		next, selected := toggleValue(q, paramTag, t.Slug)
+		out.Tags = append(out.Tags, facetLink{Label: t.Name, Count: t.Count, Selected: selected, Href: catalogHref(next)})
+	}
+	for _, b := range fc.Prices {
+		selected := f.MinPrice == b.Min.Minor && f.MaxPrice == b.Max.Minor
+		next := withParam(q, func(c url.Values) {
+			c.Del(paramMinPrice)
+			c.Del(paramMaxPrice)
+			if selected {
+				return
+			}
+			if !b.Min.IsZero() {
+				c.Set(paramMinPrice, priceParam(b.Min.Minor, b.Min.Currency))
+			}
+			if !b.Max.IsZero() {
+				c.Set(paramMaxPrice, priceParam(b.Max.Minor, b.Max.Currency))
+			}
+		})
+		out.Prices = append(out.Prices, facetLink{Label: priceLabel(b), Count: b.Count, Selected: selected, Href: catalogHref(next)})
+	}
+	for _, rt := range fc.Ratings {
+		selected := f.MinRating == rt.Min
+		next := withParam(q, func(c url.Values) {
+			c.Del(paramMinRating)
+			if !selected {
+				c.Set(paramMinRating, strconv.Itoa(rt.Min))
+			}
+		})
+		out.Ratings = append(out.Ratings, facetLink{Label: fmt.Sprintf("от %d ★", rt.Min), Count: rt.Count, Selected: selected, Href: catalogHref(next)})
+	}
+	return out
+}
+
+var sortLabels = map[storage.GameSort]string{
+	storage.SortNewest:      "Новые",
+	storage.SortPriceAsc:    "Дешевле",
+	storage.SortPriceDesc:   "Дороже",
+	storage.SortTitle:       "По названию",
+	storage.SortRating:      "По оценке",
+	storage.SortBestselling: "Популярные",
+}
+
+// buildSortLinks — переключатель сортировки; смена сортировки возвращает на первую страницу.
+func buildSortLinks(q url.Values, current storage.GameSort) []facetLink {
+	var out []facetLink
+	for _, s := range storage.GameSorts {
+		next := withParam(q, func(c url.Values) {
+			c.Del(paramPage)
+			c.Del(paramSort)
+			if s != storage.SortNewest {
+				c.Set(paramSort, string(s))
+			}
+		})
+		out = append(out, facetLink{Label: sortLabels[s], Selected: s == current, Href: catalogHref(next)})
+	}
+	return out
+}
+
+// pager — навигация по страницам каталога.
+type pager struct {
+	Page, Pages, Total int
+	Prev, Next         string // пустая строка — ссылки нет
+	Links              []pageLink
+}
+
+type pageLink struct {
+	Number  int // 0 — многоточие
+	Href    string
+	Current bool
+}
+
+// pagerWindow — сколько соседних страниц показывать вокруг текущей.
+const pagerWindow = 2
+
+func buildPager(q url.Values, page, perPage, total int) pager {
+	p := pager{Page: page, Total: total, Pages: (total + perPage - 1) / perPage}
+	href := func(n int) string {
+		return catalogHref(withParam(q, func(c url.Values) {
+			c.Del(paramPage)
+			if n > 1 {
+				c.Set(paramPage, strconv.Itoa(n))
+			}
+		}))
+	}
+	if page > 1 {
+		p.Prev = href(min(page-1, max(p.Pages, 1)))
+	}
+	if page < p.Pages {
+		p.Next = href(page + 1)
+	}
+	for n := 1; n <= p.Pages; n++ {
+		switch {
+		case n == 1 || n == p.Pages || (n >= page-pagerWindow && n <= page+pagerWindow):
+			p.Links = append(p.Links, pageLink{Number: n, Href: href(n), Current: n == page})
+		case len(p.Links) > 0 && p.Links[len(p.Links)-1].Number != 0:
+			p.Links = append(p.Links, pageLink{})
+		}
+	}
+	return p
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/aml-709/game-store/internal/money"
+	"github.com/aml-709/game-store/internal/storage"
+)
+
+// paramCurrency — ?currency=EUR: посмотреть каталог в другой валюте, не меняя настройку.
+// Корзина и заказы всегда считаются в валюте из настроек покупателя.
+const paramCurrency = "currency"
+
+// preferredCurrency — валюта покупателя из настроек; для анонима и при ошибке — валюта по умолчанию.
+func (h *Handler) preferredCurrency(ctx context.Context, uid int) money.Currency {
+	if uid == 0 || h == nil || h.Customers == nil {
+		return money.Default
+	}
+	c, err := h.Customers.Get(ctx, uid)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("preferredCurrency: db error for id=%d: %v", uid, err)
+		}
+		return money.Default
+	}
+	if !c.Currency.Valid() {
+		return money.Default
+	}
+	return c.Currency
+}
+
+// catalogCurrency — валюта цен каталога: ?currency=, иначе настройка покупателя.
+// Неизвестная валюта в параметре — ошибка (HTML её игнорирует, API отвечает 400).
+func (h *Handler) catalogCurrency(r *http.Request, uid int) (money.Currency, error) {
+	if v := strings.TrimSpace(r.URL.Query().Get(paramCurrency)); v != "" {
+		if c := money.Currency(strings.ToUpper(v)); c.Valid() {
+			return c, nil
+		}
+		return h.preferredCurrency(r.Context(), uid), fmt.Errorf("unknown %s %q", paramCurrency, v)
+	}
+	return h.preferredCurrency(r.Context(), uid), nil
+}
+
+// SetCurrency — POST /account/currency: выбор валюты (и региона) покупателя.
+func (h *Handler) SetCurrency(w http.ResponseWriter, r *http.Request) {
+	uid, err := h.getCurrentUser(r)
+	if err != nil || uid == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+	cur := money.Currency(r.FormValue("currency"))
+	if !cur.Valid() {
+		h.renderAccount(w, r, http.StatusUnprocessableEntity, uid, "", []string{"Неизвестная валюта"})
+		return
+	}
+	if err := h.Customers.SetCurrency(r.Context(), uid, cur); err != nil {
+		log.Printf("SetCurrency: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/storage"
+)
+
+// giftRequest — получатель подарка для строки корзины (по имени или email) и поздравление.
+type giftRequest struct {
+	CartItemID int    `json:"cart_item_id"`
+	Recipient  string `json:"recipient"`
+	Message    string `json:"message"`
+}
+
+var (
+	errGiftLine      = errors.New("a recipient can be set only for a single gift copy of a game")
+	errGiftRecipient = errors.New("recipient not found")
+	errGiftToSelf    = errors.New("a gift can't be sent to yourself; buy a personal copy instead")
+	errGiftOwned     = errors.New("recipient already owns the game")
+	errGiftMessage   = fmt.Errorf("gift message is longer than %d characters", models.MaxGiftMessage)
+)
+
+// giftError — почему подарок из строки корзины не оформить.
+type giftError struct {
+	Item      models.CartItem
+	Recipient string
+	Err       error
+}
+
+func (e *giftError) Error() string { return fmt.Sprintf("cart item %d: %v", e.Item.ID, e.Err) }
+func (e *giftError) Unwrap() error { return e.Err }
+
+// Message — текст ошибки для формы оформления.
+func (e *giftError) Message() string {
+	switch {
+	case errors.Is(e.Err, errGiftLine):
+		return fmt.Sprintf("%s: подарить получателю можно одну копию — оставьте в корзине одну копию в подарок", e.Item.Title)
+	case errors.Is(e.Err, errGiftRecipient):
+		return fmt.Sprintf("%s: покупатель «%s» не найден", e.Item.Title, e.Recipient)
+	case errors.Is(e.Err, errGiftToSelf):
+		return fmt.Sprintf("%s: себе подарок не отправить — положите игру в корзину как личную копию", e.Item.Title)
+	case errors.Is(e.Err, errGiftOwned):
+		return fmt.Sprintf("%s: у %s эта игра уже есть", e.Item.Title, e.Recipient)
+	case errors.Is(e.Err, errGiftMessage):
+		return fmt.Sprintf("%s: поздравление — не больше %d символов", e.Item.Title, models.MaxGiftMessage)
+	}
+	return e.Err.Error()
+}
+
+// findCustomer ищет покупателя по имени или, если в строке есть @, по email.
+func (h *Handler) findCustomer(ctx context.Context, who string) (models.Customer, error) {
+	if strings.Contains(who, "@") {
+		return h.Customers.GetByEmail(ctx, who)
+	}
+	return h.Customers.GetByUsername(ctx, who)
+}
+
+// resolveGifts проверяет получателей подарков для корзины items покупателя uid и возвращает их
+// по id строк корзины (для OrderRepo.CreateFromCart) и ошибки по строкам. Строки, которой уже
+// нет в корзине, проверяет CreateFromCart: повтор оформления с тем же ключом корзину не читает.
+func (h *Handler) resolveGifts(ctx context.Context, uid int, items []models.CartItem, reqs []giftRequest) (map[int]models.Gift, []*giftError, error) {
+	gifts := map[int]models.Gift{}
+	var errs []*giftError
+	for _, req := range reqs {
+		who := strings.TrimSpace(req.Recipient)
+		item := models.CartItem{ID: req.CartItemID, Title: fmt.Sprintf("Строка %d", req.CartItemID)}
+		inCart := false
+		for _, it := range items {
+			if it.ID == req.CartItemID {
+				item, inCart = it, true
+				break
+			}
+		}
+		fail := func(err error) { errs = append(errs, &giftError{Item: item, Recipient: who, Err: err}) }
+		if inCart && (!item.Gift || item.GameID == 0 || item.Quantity != 1) {
+			fail(errGiftLine)
+			continue
+		}
+		message := strings.TrimSpace(req.Message)
+		if utf8.RuneCountInString(message) > models.MaxGiftMessage {
+			fail(errGiftMessage)
+			continue
+		}
+		if who == "" {
+			fail(errGiftRecipient)
+			continue
+		}
+		c, err := h.findCustomer(ctx, who)
+		if errors.Is(err, storage.ErrNotFound) {
+			fail(errGiftRecipient)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if c.ID == uid {
+			fail(errGiftToSelf)
+			continue
+		}
+		if inCart {
+			owned, err := h.Libraries.Owns(ctx, c.ID, item.GameID)
+			if err != nil {
+				return nil, nil, err
+			}
+			if owned {
+				who = c.Username
+				fail(errGiftOwned)
+				continue
+			}
+		}
+		gifts[req.CartItemID] = models.Gift{RecipientID: c.ID, Recipient: c.Username, Message: message}
+	}
+	return gifts, errs, nil
+}
+
+// checkoutGiftRequests — получатели из формы оформления: поля recipient_<id> и message_<id>
+// у строк с подарком; строки без получателя остаются копиями в подарок без адресата — на них
+// при оплате выпускаются ключи активации.
+func checkoutGiftRequests(r *http.Request, items []models.CartItem) []giftRequest {
+	var reqs []giftRequest
+	for _, it := range items {
+		if !it.Gift {
+			continue
+		}
+		id := strconv.Itoa(it.ID)
+		who := strings.TrimSpace(r.PostFormValue("recipient_" + id))
+		if who == "" {
+			continue
+		}
+		reqs = append(reqs, giftRequest{CartItemID: it.ID, Recipient: who, Message: r.PostFormValue("message_" + id)})
+	}
+	return reqs
+}
+
+// GiftInbox — GET /gifts: подарки покупателю (принять или отклонить) и подарки, которые он отправил.
+func (h *Handler) GiftInbox(w http.ResponseWriter, r *http.Request) {
+	h.renderGifts(w, r, http.StatusOK, nil)
+}
+
+func (h *Handler) renderGifts(w http.ResponseWriter, r *http.Request, status int, errs []string) {
+	uid, _ := h.getCurrentUser(r)
+	inbox, err := h.Gifts.Inbox(r.Context(), uid)
+	if err != nil {
+		log.Printf("GiftInbox: inbox query error %v", err)
+	}
+	sent, err := h.Gifts.Sent(r.Context(), uid)
+	if err != nil {
+		log.Printf("GiftInbox: sent query error %v", err)
+	}
+	data := PageData{
+		UserID:    uid,
+		Username:  h.getUsernameByID(r.Context(), uid),
+		Games:     inbox,
+		Purchases: sent,
+		Errors:    errs,
+	}
+	h.renderTemplateStatus(w, status, "gifts.html", data)
+}
+
+// AnswerGift — POST /gifts/answer (id, action=accept|decline): ответ получателя на подарок.
+// Отклонённый подарок забирается из библиотеки, покупатель может вернуть за него деньги.
+func (h *Handler) AnswerGift(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/gifts", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, "/gifts", http.StatusSeeOther)
+		return
+	}
+	switch r.FormValue("action") {
+	case "accept":
+		err = h.Gifts.Accept(r.Context(), id, uid)
+	case "decline":
+		err = h.Gifts.Decline(r.Context(), id, uid)
+	default:
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, storage.ErrInvalidTransition) {
+		h.renderGifts(w, r, http.StatusConflict, []string{"На этот подарок уже ответили или его отозвали"})
+		return
+	}
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("AnswerGift: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		log.Printf("AnswerGift: gift %d %s by user %d", id, r.FormValue("action"), uid)
+	}
+	http.Redirect(w, r, "/gifts", http.StatusSeeOther)
+}
+
+// SetEmail — POST /account/email: email, по которому покупателя можно найти как получателя
+// подарка. Пустое значение убирает email.
+func (h *Handler) SetEmail(w http.ResponseWriter, r *http.Request) {
+	uid, err := h.getCurrentUser(r)
+	if err != nil || uid == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+	email := strings.TrimSpace(r.FormValue("email"))
+	if email != "" {
+		if a, err := mail.ParseAddress(email); err != nil || a.Address != email {
+			h.renderAccount(w, r, http.StatusUnprocessableEntity, uid, "", []string{"Некорректный email"})
+			return
+		}
+	}
+	err = h.Customers.SetEmail(r.Context(), uid, email)
+	if errors.Is(err, storage.ErrEmailTaken) {
+		h.renderAccount(w, r, http.StatusConflict, uid, "", []string{"Этот email уже указан у другого покупателя"})
+		return
+	}
+	if err != nil {
+		log.Printf("SetEmail: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
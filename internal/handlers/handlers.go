@@ -2,20 +2,37 @@ package handlers
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"database/sql"
-	"encoding/hex"
+	"context"
+	"errors"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
+
+	"github.com/aml-709/game-store/internal/auth"
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+	"github.com/aml-709/game-store/internal/payment"
+	"github.com/aml-709/game-store/internal/session"
+	"github.com/aml-709/game-store/internal/storage"
 )
 
+// Handler зависит только от интерфейсов репозиториев — в тестах их можно подменить.
 type Handler struct {
-	DB *sql.DB
+	storage.Repos
+	Sessions *session.Store
+	Hasher   auth.PasswordHasher
+	Gateway  payment.Provider // платёжный провайдер
+	// RefundWindow — сколько после оплаты можно попросить возврат (0 — DefaultRefundWindow).
+	RefundWindow time.Duration
 }
 
+type ctxKey int
+
+const principalCtxKey ctxKey = iota
+
 // PageData — универсальная структура, передаваемая в шаблоны.
 // Заполняйте нужные поля в обработчиках (Games, Game, Purchases, Recommended и т.д.)
 type PageData struct {
@@ -23,58 +40,119 @@ type PageData struct {
 	Username    string
 	Games       interface{}
 	Game        interface{}
+	Bundle      interface{} // набор (страница набора)
+	Bundles     interface{} // наборы (список, страница игры, админка)
 	Purchases   interface{}
 	Recommended interface{}
 	PurchaseID  int
 	Comments    interface{}
 	EditComment interface{} // <--- new: data for edit form
+	Role        models.Role // заполняется в renderTemplate по UserID
+	Users       interface{}
+	Form        interface{}    // значения формы для повторного показа
+	Errors      []string       // ошибки валидации формы
+	Tokens      interface{}    // персональные токены доступа (страница аккаунта)
+	NewToken    string         // только что выпущенный токен — показывается один раз
+	Query       string         // строка поиска (в шапке и на странице поиска)
+	Facets      interface{}    // фильтры каталога на главной
+	Sorts       interface{}    // переключатель сортировки каталога
+	Pager       interface{}    // навигация по страницам каталога
+	Total       money.Amount   // итог корзины
+	Genres      interface{}    // справочник жанров (админка)
+	Tags        interface{}    // справочник тегов (админка)
+	Currency    money.Currency // валюта, в которой показаны цены
+	Order       interface{}    // заказ (страница оплаты)
+	Payment     interface{}    // платёж или платёжное намерение (страницы оплаты)
+	Refunds     interface{}    // заявки на возврат (админка)
+	Promotions  interface{}    // применённые скидки (оформление) или все скидки (админка)
+	Coupon      string         // введённый купон (оформление)
+	Prices      interface{}    // календарь цен (админка)
+	PriceTime   time.Time      // предпросмотр администратора: цены показаны на эту дату; нулевое — текущие
+	Owned       bool           // игра уже в библиотеке (страница игры): личную копию не купить, только в подарок
+	Email       string         // email покупателя (страница аккаунта)
+	Keys        interface{}    // ключи активации (админка) или только что активированный ключ (/redeem)
+	KeyStock    interface{}    // запас ключей по играм (админка)
+	Redemptions interface{}    // последние активации ключей (админка)
+	// Wishlisted — игры из списка желаемого покупателя (кнопки каталога и страницы игры)
+	Wishlisted    map[int]bool
+	Notifications interface{} // уведомления о снижении цен (список желаемого)
+	// PendingGifts — сколько подарков ждут ответа (ссылка в шапке); заполняется в renderTemplate по UserID
+	PendingGifts int
+	// UnreadNotifications — сколько уведомлений о снижении цен не прочитано (ссылка в шапке);
+	// тоже заполняется в renderTemplate
+	UnreadNotifications int
+	// IdempotencyKey — скрытое поле форм оформления и оплаты: повторная отправка формы не создаёт второй заказ
+	IdempotencyKey string
 	// можно добавлять поля по мере необходимости
 }
 
-func hashPassword(p string) string {
-	h := sha256.Sum256([]byte(p))
-	return hex.EncodeToString(h[:])
-}
+// IsAdmin / CanModerate — проверки роли для шаблонов.
+func (d PageData) IsAdmin() bool     { return d.Role.AtLeast(models.RoleAdmin) }
+func (d PageData) CanModerate() bool { return d.Role.AtLeast(models.RoleModerator) }
+
+// TokenScopes — права, которые можно выдать персональному токену.
+func (d PageData) TokenScopes() []models.Scope { return models.Scopes }
+
+// Currencies — валюты витрины (выбор на странице аккаунта, региональные цены в админке).
+func (d PageData) Currencies() []money.Currency { return money.Currencies }
+
+// BaseCurrency — валюта базовой цены игры; цены в остальных валютах — региональные.
+func (d PageData) BaseCurrency() money.Currency { return money.Default }
+
+// MaxGiftCopies — сколько копий игры можно положить в корзину в подарок.
+func (d PageData) MaxGiftCopies() int { return models.MaxGiftCopies }
 
 func (h *Handler) getCurrentUser(r *http.Request) (int, error) {
-	c, err := r.Cookie("user_id")
+	p, err := h.currentPrincipal(r)
 	if err != nil {
 		return 0, err
 	}
-	id, err := strconv.Atoi(c.Value)
+	return p.UserID, nil
+}
+
+// clientIP — адрес клиента без порта.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		return 0, err
+		return r.RemoteAddr
 	}
-	return id, nil
+	return host
 }
 
 func (h *Handler) renderTemplate(w http.ResponseWriter, tmplFile string, data PageData) {
-	// template helper: умножение (поддерживает разные типы)
-	mul := func(a, b interface{}) float64 {
-		toFloat := func(v interface{}) float64 {
-			switch t := v.(type) {
-			case float64:
-				return t
-			case float32:
-				return float64(t)
-			case int:
-				return float64(t)
-			case int64:
-				return float64(t)
-			case uint:
-				return float64(t)
-			case string:
-				if f, err := strconv.ParseFloat(t, 64); err == nil {
-					return f
-				}
-			}
-			return 0
+	h.renderTemplateStatus(w, http.StatusOK, tmplFile, data)
+}
+
+// renderTemplateStatus — как renderTemplate, но с произвольным HTTP-статусом (например, 422 при ошибках формы).
+func (h *Handler) renderTemplateStatus(w http.ResponseWriter, status int, tmplFile string, data PageData) {
+	if data.Role == "" {
+		data.Role = h.getRoleByID(context.Background(), data.UserID)
+	}
+	if data.UserID != 0 && h.Gifts != nil {
+		n, err := h.Gifts.PendingCount(context.Background(), data.UserID)
+		if err != nil {
+			log.Printf("renderTemplate: pending gifts error %v", err)
 		}
-		return toFloat(a) * toFloat(b)
+		data.PendingGifts = n
+	}
+	if data.UserID != 0 && h.Wishlists != nil {
+		n, err := h.Wishlists.UnreadCount(context.Background(), data.UserID)
+		if err != nil {
+			log.Printf("renderTemplate: unread notifications error %v", err)
+		}
+		data.UnreadNotifications = n
 	}
 
 	funcs := template.FuncMap{
-		"mul": mul,
+		// mul: стоимость строки — цена, умноженная на количество, без плавающей точки
+		"mul": func(a money.Amount, qty int) money.Amount { return a.Mul(qty) },
+		// date: дата из базы в локальном формате; нулевая дата — пустая строка
+		"date": func(t time.Time) string {
+			if t.IsZero() {
+				return ""
+			}
+			return t.Local().Format("02.01.2006 15:04")
+		},
 	}
 
 	tmpl, err := template.New("").Funcs(funcs).ParseGlob("templates/*.html")
@@ -92,234 +170,50 @@ func (h *Handler) renderTemplate(w http.ResponseWriter, tmplFile string, data Pa
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 	_, _ = w.Write(buf.Bytes())
 }
 
-// Ensure DB tables for cart/purchases/library exist
-func (h *Handler) ensureSchema() {
-	if h == nil || h.DB == nil {
-		return
-	}
-
-	// helper: does table exist?
-	tableExists := func(name string) bool {
-		var cnt int
-		err := h.DB.QueryRow("SELECT count(name) FROM sqlite_master WHERE type='table' AND name = ?", name).Scan(&cnt)
-		if err != nil {
-			log.Printf("ensureSchema: tableExists %s check error: %v", name, err)
-			return false
-		}
-		return cnt > 0
-	}
-
-	// helper: does column exist in table?
-	hasColumn := func(table, col string) bool {
-		rows, err := h.DB.Query("PRAGMA table_info(" + table + ")")
-		if err != nil {
-			return false
-		}
-		defer rows.Close()
-		for rows.Next() {
-			var cid int
-			var name, ctype string
-			var notnull, pk int
-			var dflt sql.NullString
-			if err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk); err == nil {
-				if name == col {
-					return true
-				}
-			}
-		}
-		return false
-	}
-
-	// create or migrate purchases table
-	if !tableExists("purchases") {
-		_, err := h.DB.Exec(`
-            CREATE TABLE IF NOT EXISTS purchases (
-                id INTEGER PRIMARY KEY AUTOINCREMENT,
-                user_id INTEGER,
-                total REAL,
-                created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-                paid INTEGER DEFAULT 0
-            );
-        `)
-		if err != nil {
-			log.Printf("ensureSchema: create purchases error: %v", err)
-		}
-	} else {
-		// add missing columns to purchases
-		if !hasColumn("purchases", "user_id") {
-			if _, err := h.DB.Exec("ALTER TABLE purchases ADD COLUMN user_id INTEGER;"); err != nil {
-				log.Printf("ensureSchema: add column user_id error: %v", err)
-			}
-		}
-		if !hasColumn("purchases", "total") {
-			if _, err := h.DB.Exec("ALTER TABLE purchases ADD COLUMN total REAL;"); err != nil {
-				log.Printf("ensureSchema: add column total error: %v", err)
-			}
-		}
-		if !hasColumn("purchases", "created_at") {
-			if _, err := h.DB.Exec("ALTER TABLE purchases ADD COLUMN created_at DATETIME DEFAULT CURRENT_TIMESTAMP;"); err != nil {
-				log.Printf("ensureSchema: add column created_at error: %v", err)
-			}
-		}
-		if !hasColumn("purchases", "paid") {
-			if _, err := h.DB.Exec("ALTER TABLE purchases ADD COLUMN paid INTEGER DEFAULT 0;"); err != nil {
-				log.Printf("ensureSchema: add column paid error: %v", err)
-			}
-		}
-	}
-
-	// ensure cart_items
-	if !tableExists("cart_items") {
-		_, err := h.DB.Exec(`
-            CREATE TABLE IF NOT EXISTS cart_items (
-                id INTEGER PRIMARY KEY AUTOINCREMENT,
-                user_id INTEGER,
-                game_id INTEGER,
-                quantity INTEGER DEFAULT 1
-            );
-        `)
-		if err != nil {
-			log.Printf("ensureSchema: create cart_items error: %v", err)
-		}
-	} else {
-		if !hasColumn("cart_items", "user_id") {
-			if _, err := h.DB.Exec("ALTER TABLE cart_items ADD COLUMN user_id INTEGER;"); err != nil {
-				log.Printf("ensureSchema: add column cart_items.user_id error: %v", err)
-			}
-		}
-		if !hasColumn("cart_items", "game_id") {
-			if _, err := h.DB.Exec("ALTER TABLE cart_items ADD COLUMN game_id INTEGER;"); err != nil {
-				log.Printf("ensureSchema: add column cart_items.game_id error: %v", err)
-			}
-		}
-		if !hasColumn("cart_items", "quantity") {
-			if _, err := h.DB.Exec("ALTER TABLE cart_items ADD COLUMN quantity INTEGER DEFAULT 1;"); err != nil {
-				log.Printf("ensureSchema: add column cart_items.quantity error: %v", err)
-			}
-		}
-	}
-
-	// ensure purchase_items and required columns
-	if !tableExists("purchase_items") {
-		_, err := h.DB.Exec(`
-            CREATE TABLE IF NOT EXISTS purchase_items (
-                id INTEGER PRIMARY KEY AUTOINCREMENT,
-                purchase_id INTEGER,
-                game_id INTEGER,
-                price REAL,
-                quantity INTEGER
-            );
-        `)
-		if err != nil {
-			log.Printf("ensureSchema: create purchase_items error: %v", err)
-		}
-	} else {
-		if !hasColumn("purchase_items", "purchase_id") {
-			if _, err := h.DB.Exec("ALTER TABLE purchase_items ADD COLUMN purchase_id INTEGER;"); err != nil {
-				log.Printf("ensureSchema: add column purchase_items.purchase_id error: %v", err)
-			}
-		}
-		if !hasColumn("purchase_items", "game_id") {
-			if _, err := h.DB.Exec("ALTER TABLE purchase_items ADD COLUMN game_id INTEGER;"); err != nil {
-				log.Printf("ensureSchema: add column purchase_items.game_id error: %v", err)
-			}
-		}
-		if !hasColumn("purchase_items", "price") {
-			if _, err := h.DB.Exec("ALTER TABLE purchase_items ADD COLUMN price REAL;"); err != nil {
-				log.Printf("ensureSchema: add column purchase_items.price error: %v", err)
-			}
-		}
-		if !hasColumn("purchase_items", "quantity") {
-			if _, err := h.DB.Exec("ALTER TABLE purchase_items ADD COLUMN quantity INTEGER;"); err != nil {
-				log.Printf("ensureSchema: add column purchase_items.quantity error: %v", err)
-			}
-		}
-	}
-
-	// ensure comments table
-	if !tableExists("comments") {
-		_, err := h.DB.Exec(`
-            CREATE TABLE IF NOT EXISTS comments (
-                id INTEGER PRIMARY KEY AUTOINCREMENT,
-                game_id INTEGER,
-                user_id INTEGER,
-                rating INTEGER,
-                text TEXT,
-                created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-            );
-        `)
-		if err != nil {
-			log.Printf("ensureSchema: create comments error: %v", err)
-		}
-	} else {
-		if !hasColumn("comments", "game_id") {
-			if _, err := h.DB.Exec("ALTER TABLE comments ADD COLUMN game_id INTEGER;"); err != nil {
-				log.Printf("ensureSchema: add column comments.game_id error: %v", err)
-			}
-		}
-		if !hasColumn("comments", "user_id") {
-			if _, err := h.DB.Exec("ALTER TABLE comments ADD COLUMN user_id INTEGER;"); err != nil {
-				log.Printf("ensureSchema: add column comments.user_id error: %v", err)
-			}
-		}
-		if !hasColumn("comments", "rating") {
-			if _, err := h.DB.Exec("ALTER TABLE comments ADD COLUMN rating INTEGER;"); err != nil {
-				log.Printf("ensureSchema: add column comments.rating error: %v", err)
-			}
-		}
-		if !hasColumn("comments", "text") {
-			if _, err := h.DB.Exec("ALTER TABLE comments ADD COLUMN text TEXT;"); err != nil {
-				log.Printf("ensureSchema: add column comments.text error: %v", err)
-			}
-		}
-		if !hasColumn("comments", "created_at") {
-			if _, err := h.DB.Exec("ALTER TABLE comments ADD COLUMN created_at DATETIME DEFAULT CURRENT_TIMESTAMP;"); err != nil {
-				log.Printf("ensureSchema: add column comments.created_at error: %v", err)
-			}
-		}
-	}
-
-	// ensure user_games
-	if !tableExists("user_games") {
-		_, err := h.DB.Exec(`
-            CREATE TABLE IF NOT EXISTS user_games (
-                id INTEGER PRIMARY KEY AUTOINCREMENT,
-                user_id INTEGER,
-                game_id INTEGER,
-                UNIQUE(user_id, game_id)
-            );
-        `)
-		if err != nil {
-			log.Printf("ensureSchema: create user_games error: %v", err)
+// AuthMiddleware пускает вошедших пользователей. Без scopes маршрут доступен только
+// по cookie-сессии; со scopes — ещё и по персональному токену с этими правами.
+func (h *Handler) AuthMiddleware(next http.HandlerFunc, scopes ...models.Scope) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := h.currentPrincipal(r)
+		if errors.Is(err, errInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "Invalid access token", http.StatusUnauthorized)
+			return
 		}
-	} else {
-		if !hasColumn("user_games", "user_id") {
-			if _, err := h.DB.Exec("ALTER TABLE user_games ADD COLUMN user_id INTEGER;"); err != nil {
-				log.Printf("ensureSchema: add column user_games.user_id error: %v", err)
-			}
+		if err != nil || p.UserID == 0 {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
 		}
-		if !hasColumn("user_games", "game_id") {
-			if _, err := h.DB.Exec("ALTER TABLE user_games ADD COLUMN game_id INTEGER;"); err != nil {
-				log.Printf("ensureSchema: add column user_games.game_id error: %v", err)
-			}
+		if !p.allows(scopes) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
 		}
+		// user is authenticated — call next handler with the principal in context
+		next(w, withPrincipal(r, p))
 	}
 }
 
-func (h *Handler) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		uid, err := h.getCurrentUser(r)
-		if err != nil || uid == 0 {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+// RoleMiddleware пускает только пользователей с ролью не ниже min.
+// Анонимов отправляет на /login, остальным отвечает 403.
+func (h *Handler) RoleMiddleware(min models.Role, next http.HandlerFunc) http.HandlerFunc {
+	return h.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		uid, _ := h.getCurrentUser(r)
+		if !h.getRoleByID(r.Context(), uid).AtLeast(min) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
-		// user is authenticated — call next handler
 		next(w, r)
-	}
+	})
+}
+
+// AdminMiddleware — доступ только для администраторов.
+func (h *Handler) AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return h.RoleMiddleware(models.RoleAdmin, next)
 }
 
 // Register handler
@@ -331,13 +225,17 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Missing fields", http.StatusBadRequest)
 			return
 		}
-		var exists bool
-		_ = h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM customers WHERE username = ?)", username).Scan(&exists)
-		if exists {
+		hash, err := h.Hasher.Hash(password)
+		if err != nil {
+			log.Printf("Register: hash error %v", err)
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		_, err = h.Customers.Create(r.Context(), username, hash)
+		if errors.Is(err, storage.ErrUsernameTaken) {
 			http.Error(w, "Username taken", http.StatusBadRequest)
 			return
 		}
-		_, err := h.DB.Exec("INSERT INTO customers (username, password) VALUES (?, ?)", username, hashPassword(password))
 		if err != nil {
 			log.Printf("Register: insert error %v", err)
 			http.Error(w, "DB error", http.StatusInternalServerError)
@@ -357,26 +255,52 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		username := r.FormValue("username")
 		password := r.FormValue("password")
-		var id int
-		err := h.DB.QueryRow("SELECT id FROM customers WHERE username = ? AND password = ?", username, hashPassword(password)).Scan(&id)
-		if err != nil {
+		c, err := h.Customers.GetByUsername(r.Context(), username)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Login: db error for username=%q err=%v", username, err)
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		ok, needsRehash := false, false
+		if err == nil {
+			ok, needsRehash, err = h.Hasher.Verify(password, c.PasswordHash)
+		}
+		if !ok {
 			log.Printf("Login: failed for username=%q err=%v", username, err)
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 			return
 		}
 
-		// Set cookie explicitly (persist 7 days, HttpOnly, Lax same-site)
+		// старые sha256-хеши и хеши с устаревшими параметрами тихо перехешируем
+		if needsRehash {
+			if hash, err := h.Hasher.Hash(password); err != nil {
+				log.Printf("Login: rehash error for user %d: %v", c.ID, err)
+			} else if err := h.Customers.UpdatePassword(r.Context(), c.ID, hash); err != nil {
+				log.Printf("Login: rehash update error for user %d: %v", c.ID, err)
+			} else {
+				log.Printf("Login: password hash for user %d upgraded", c.ID)
+			}
+		}
+
+		sess, err := h.Sessions.Create(c.ID, r.UserAgent(), clientIP(r))
+		if err != nil {
+			log.Printf("Login: create session error %v", err)
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+
+		// Set cookie explicitly (lives as long as the session, HttpOnly, Lax same-site)
 		http.SetCookie(w, &http.Cookie{
-			Name:     "user_id",
-			Value:    strconv.Itoa(id),
+			Name:     session.CookieName,
+			Value:    sess.Token,
 			Path:     "/",
-			MaxAge:   7 * 24 * 60 * 60,
+			Expires:  sess.ExpiresAt,
 			HttpOnly: true,
 			SameSite: http.SameSiteLaxMode,
 			// Secure: true, // uncomment when using HTTPS
 		})
 
-		log.Printf("Login: user %d logged in, cookie set", id)
+		log.Printf("Login: user %d logged in, session created", c.ID)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
@@ -387,8 +311,13 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 
 // Logout handler
 func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(session.CookieName); err == nil {
+		if err := h.Sessions.Revoke(c.Value); err != nil {
+			log.Printf("Logout: revoke session error %v", err)
+		}
+	}
 	http.SetCookie(w, &http.Cookie{
-		Name:   "user_id",
+		Name:   session.CookieName,
 		Value:  "",
 		Path:   "/",
 		MaxAge: -1,
@@ -396,41 +325,41 @@ func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-// Home handler — пример: загружает список игр и передаёт UserID/Username
+// Home handler — каталог с фасетными фильтрами (жанр, тег, цена, оценка), сортировкой и страницами
 func (h *Handler) Home(w http.ResponseWriter, r *http.Request) {
 	uid, _ := h.getCurrentUser(r)
-	rows, err := h.DB.Query("SELECT id, title, price, image_url FROM games ORDER BY id DESC")
+	q := r.URL.Query()
+	cur, _ := h.catalogCurrency(r, uid)
+	gq, _ := parseGameQuery(q, cur) // некорректные параметры просто игнорируем
+	ctx, previewAt := h.priceContext(r, uid)
+
+	games, total, err := h.Games.Browse(ctx, gq)
 	if err != nil {
 		log.Printf("Home: db error %v", err)
 		http.Error(w, "DB error", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	type G struct {
-		ID       int
-		Title    string
-		Price    float64
-		ImageURL string
-	}
-	var games []G
-	for rows.Next() {
-		var g G
-		_ = rows.Scan(&g.ID, &g.Title, &g.Price, &g.ImageURL)
-		games = append(games, g)
+	facets, err := h.Games.Facets(ctx, gq.GameFilter)
+	if err != nil {
+		log.Printf("Home: facets error %v", err)
 	}
 
 	data := PageData{
-		UserID:   uid,
-		Username: h.getUsernameByID(uid),
-		Games:    games,
+		UserID:     uid,
+		Username:   h.getUsernameByID(r.Context(), uid),
+		Games:      games,
+		Facets:     buildCatalogFacets(q, gq.GameFilter, facets),
+		Sorts:      buildSortLinks(q, gq.Sort),
+		Pager:      buildPager(q, gq.Page, gq.PerPage, total),
+		Currency:   cur,
+		PriceTime:  previewAt,
+		Wishlisted: h.wishlisted(r.Context(), uid),
 	}
 	h.renderTemplate(w, "index.html", data)
 }
 
 // GameDetail handler (добавлен сбор комментариев)
 func (h *Handler) GameDetail(w http.ResponseWriter, r *http.Request) {
-	h.ensureSchema()
 	uid, _ := h.getCurrentUser(r)
 
 	idStr := r.URL.Query().Get("id")
@@ -444,17 +373,10 @@ func (h *Handler) GameDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var g struct {
-		ID          int
-		Title       string
-		Description string
-		Price       float64
-		ImageURL    string
-	}
-
-	err = h.DB.QueryRow("SELECT id, title, description, price, image_url FROM games WHERE id = ?", id).
-		Scan(&g.ID, &g.Title, &g.Description, &g.Price, &g.ImageURL)
-	if err == sql.ErrNoRows {
+	cur, _ := h.catalogCurrency(r, uid)
+	ctx, previewAt := h.priceContext(r, uid)
+	g, err := h.Games.Get(ctx, id, cur)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && !g.Published && !h.getRoleByID(r.Context(), uid).AtLeast(models.RoleAdmin)) {
 		http.NotFound(w, r)
 		return
 	}
@@ -464,47 +386,38 @@ func (h *Handler) GameDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// load comments (join with customers to get username). include user_id to check ownership
-	type C struct {
-		ID        int
-		Rating    int
-		Text      string
-		AuthorID  int
-		Author    string
-		CreatedAt string
-	}
-	var comments []C
-	cRows, err := h.DB.Query(`
-        SELECT c.id, c.rating, c.text, c.user_id, co.username, c.created_at
-        FROM comments c
-        LEFT JOIN customers co ON co.id = c.user_id
-        WHERE c.game_id = ?
-        ORDER BY c.created_at DESC
-    `, id)
-	if err == nil {
-		defer cRows.Close()
-		for cRows.Next() {
-			var cm C
-			if err := cRows.Scan(&cm.ID, &cm.Rating, &cm.Text, &cm.AuthorID, &cm.Author, &cm.CreatedAt); err == nil {
-				comments = append(comments, cm)
-			}
-		}
-	} else {
+	// load comments (with author name). UserID is used to check ownership
+	comments, err := h.Reviews.ListByGame(r.Context(), id)
+	if err != nil {
 		log.Printf("GameDetail: comments query error: %v", err)
 	}
+	var owned bool
+	if uid != 0 {
+		if owned, err = h.Libraries.Owns(r.Context(), uid, id); err != nil {
+			log.Printf("GameDetail: library query error: %v", err)
+		}
+	}
+	bundles, err := h.Bundles.ByGame(r.Context(), id)
+	if err != nil {
+		log.Printf("GameDetail: bundles query error: %v", err)
+	}
 
 	data := PageData{
-		UserID:   uid,
-		Username: h.getUsernameByID(uid),
-		Game:     g,
-		Comments: comments,
+		UserID:     uid,
+		Username:   h.getUsernameByID(r.Context(), uid),
+		Game:       g,
+		Comments:   comments,
+		Currency:   cur,
+		Owned:      owned,
+		Bundles:    bundles,
+		PriceTime:  previewAt,
+		Wishlisted: h.wishlisted(r.Context(), uid),
 	}
 	h.renderTemplate(w, "game.html", data)
 }
 
 // AddComment — принимает POST с полями id (game_id), rating (1..5), text
 func (h *Handler) AddComment(w http.ResponseWriter, r *http.Request) {
-	h.ensureSchema()
 	uid, err := h.getCurrentUser(r)
 	if err != nil || uid == 0 {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
@@ -529,18 +442,21 @@ func (h *Handler) AddComment(w http.ResponseWriter, r *http.Request) {
 	if rating < 1 || rating > 5 {
 		rating = 3 // default нормально
 	}
-	text := r.FormValue("text")
-	_, err = h.DB.Exec("INSERT INTO comments (game_id, user_id, rating, text, created_at) VALUES (?, ?, ?, ?, ?)",
-		gameID, uid, rating, text, time.Now().Format(time.RFC3339))
-	if err != nil {
+	rv := models.Review{
+		GameID:    gameID,
+		UserID:    uid,
+		Rating:    rating,
+		Text:      r.FormValue("text"),
+		CreatedAt: time.Now(),
+	}
+	if err := h.Reviews.Create(r.Context(), &rv); err != nil {
 		log.Printf("AddComment: insert error: %v", err)
 	}
 	http.Redirect(w, r, "/game?id="+strconv.Itoa(gameID), http.StatusSeeOther)
 }
 
-// DeleteComment — удаляет комментарий (только владелец)
+// DeleteComment — удаляет комментарий (владелец либо модератор)
 func (h *Handler) DeleteComment(w http.ResponseWriter, r *http.Request) {
-	h.ensureSchema()
 	uid, err := h.getCurrentUser(r)
 	if err != nil || uid == 0 {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
@@ -563,18 +479,18 @@ func (h *Handler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// verify owner
-	var owner int
-	if err := h.DB.QueryRow("SELECT user_id FROM comments WHERE id = ?", cid).Scan(&owner); err != nil {
+	rv, err := h.Reviews.Get(r.Context(), cid)
+	if err != nil {
 		log.Printf("DeleteComment: select owner error: %v", err)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	if owner != uid {
+	if rv.UserID != uid && !h.getRoleByID(r.Context(), uid).AtLeast(models.RoleModerator) {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	if _, err := h.DB.Exec("DELETE FROM comments WHERE id = ?", cid); err != nil {
+	if err := h.Reviews.Delete(r.Context(), cid); err != nil {
 		log.Printf("DeleteComment: delete error: %v", err)
 	}
 
@@ -588,7 +504,6 @@ func (h *Handler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 
 // EditComment — показывает форму редактирования (только владелец)
 func (h *Handler) EditComment(w http.ResponseWriter, r *http.Request) {
-	h.ensureSchema()
 	uid, err := h.getCurrentUser(r)
 	if err != nil || uid == 0 {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
@@ -605,15 +520,8 @@ func (h *Handler) EditComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var comment struct {
-		ID     int
-		GameID int
-		Rating int
-		Text   string
-		UserID int
-	}
-	if err := h.DB.QueryRow("SELECT id, game_id, rating, text, user_id FROM comments WHERE id = ?", cid).
-		Scan(&comment.ID, &comment.GameID, &comment.Rating, &comment.Text, &comment.UserID); err != nil {
+	comment, err := h.Reviews.Get(r.Context(), cid)
+	if err != nil {
 		log.Printf("EditComment: select error: %v", err)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -624,21 +532,15 @@ func (h *Handler) EditComment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := PageData{
-		UserID:   uid,
-		Username: h.getUsernameByID(uid),
-		EditComment: map[string]interface{}{
-			"ID":     comment.ID,
-			"GameID": comment.GameID,
-			"Rating": comment.Rating,
-			"Text":   comment.Text,
-		},
+		UserID:      uid,
+		Username:    h.getUsernameByID(r.Context(), uid),
+		EditComment: comment,
 	}
 	h.renderTemplate(w, "comment_edit.html", data)
 }
 
 // UpdateComment — обрабатывает POST редактирования
 func (h *Handler) UpdateComment(w http.ResponseWriter, r *http.Request) {
-	h.ensureSchema()
 	uid, err := h.getCurrentUser(r)
 	if err != nil || uid == 0 {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
@@ -666,35 +568,27 @@ func (h *Handler) UpdateComment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// verify owner and get game_id for redirect
-	var owner, gameID int
-	if err := h.DB.QueryRow("SELECT user_id, game_id FROM comments WHERE id = ?", cid).Scan(&owner, &gameID); err != nil {
+	rv, err := h.Reviews.Get(r.Context(), cid)
+	if err != nil {
 		log.Printf("UpdateComment: select error: %v", err)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	if owner != uid {
+	if rv.UserID != uid {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	if _, err := h.DB.Exec("UPDATE comments SET rating = ?, text = ?, created_at = ? WHERE id = ?", rating, text, time.Now().Format(time.RFC3339), cid); err != nil {
+	rv.Rating, rv.Text, rv.CreatedAt = rating, text, time.Now()
+	if err := h.Reviews.Update(r.Context(), rv); err != nil {
 		log.Printf("UpdateComment: update error: %v", err)
 	}
 
-	http.Redirect(w, r, "/game?id="+strconv.Itoa(gameID), http.StatusSeeOther)
-}
-
-// Stubs for other handlers (you can expand them as needed)
-func (h *Handler) Admin(w http.ResponseWriter, r *http.Request) {
-	http.Redirect(w, r, "/", http.StatusSeeOther)
-}
-func (h *Handler) AddGame(w http.ResponseWriter, r *http.Request) {
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	http.Redirect(w, r, "/game?id="+strconv.Itoa(rv.GameID), http.StatusSeeOther)
 }
 
 // AddToCart — добавляет игру в корзину (увеличивает количество, если уже есть)
 func (h *Handler) AddToCart(w http.ResponseWriter, r *http.Request) {
-	h.ensureSchema()
 	uid, err := h.getCurrentUser(r)
 	if err != nil || uid == 0 {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
@@ -715,380 +609,268 @@ func (h *Handler) AddToCart(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
+	g, err := h.Games.Get(r.Context(), gameID, h.preferredCurrency(r.Context(), uid))
+	if err != nil || !g.Published {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if g.Unavailable {
+		// в валюте покупателя игра не продаётся — на странице игры это видно
+		http.Redirect(w, r, "/game?id="+strconv.Itoa(gameID), http.StatusSeeOther)
+		return
+	}
+	// gift=1 — копии в подарок, их может быть несколько; личная копия всегда одна
+	gift := r.FormValue("gift") == "1"
 	qty := 1
-	if q := r.FormValue("quantity"); q != "" {
+	if q := r.FormValue("quantity"); gift && q != "" {
 		if v, err := strconv.Atoi(q); err == nil && v > 0 {
-			qty = v
+			qty = min(v, models.MaxGiftCopies)
 		}
 	}
 
-	// upsert: если есть — увеличить, иначе вставить
-	_, err = h.DB.Exec(`
-        INSERT INTO cart_items (user_id, game_id, quantity)
-        VALUES (?, ?, ?)
-        ON CONFLICT(rowid) DO NOTHING
-    `, uid, gameID, qty)
-	// simpler fallback: try update then insert
+	err = h.Carts.Add(r.Context(), uid, gameID, qty, gift)
+	if errors.Is(err, storage.ErrAlreadyOwned) {
+		// игра уже в библиотеке — на странице игры это видно, там же можно купить её в подарок
+		http.Redirect(w, r, "/game?id="+strconv.Itoa(gameID), http.StatusSeeOther)
+		return
+	}
 	if err != nil {
-		// try update existing
-		res, _ := h.DB.Exec("UPDATE cart_items SET quantity = quantity + ? WHERE user_id = ? AND game_id = ?", qty, uid, gameID)
-		ra, _ := res.RowsAffected()
-		if ra == 0 {
-			_, _ = h.DB.Exec("INSERT INTO cart_items (user_id, game_id, quantity) VALUES (?, ?, ?)", uid, gameID, qty)
-		}
+		log.Printf("AddToCart: upsert error: %v", err)
 	}
 	http.Redirect(w, r, "/cart", http.StatusSeeOther)
 }
 
-// Cart — показывает корзину (теперь возвращает id записи корзины для корректного удаления)
+// Cart — показывает корзину (с id записи корзины для корректного удаления)
 func (h *Handler) Cart(w http.ResponseWriter, r *http.Request) {
-	h.ensureSchema()
 	uid, _ := h.getCurrentUser(r)
+	cur := h.preferredCurrency(r.Context(), uid)
+	ctx, previewAt := h.priceContext(r, uid)
 
-	// Используем map для совместимости с template (ключи доступны)
-	rows, err := h.DB.Query(`
-        SELECT c.id, g.id, g.title, g.price, g.image_url, c.quantity
-        FROM cart_items c
-        JOIN games g ON g.id = c.game_id
-        WHERE c.user_id = ?
-    `, uid)
+	items, err := h.Carts.Items(ctx, uid, cur)
 	if err != nil {
-		log.Printf("Cart: db error %v", err)
 		// показываем пустую корзину при ошибке
-		data := PageData{UserID: uid, Username: h.getUsernameByID(uid), Games: []interface{}{}}
-		h.renderTemplate(w, "cart.html", data)
-		return
+		log.Printf("Cart: db error %v", err)
 	}
-	defer rows.Close()
-
-	var items []map[string]interface{}
-	for rows.Next() {
-		var cartID, gameID, qty int
-		var title, imageURL string
-		var price float64
-		if err := rows.Scan(&cartID, &gameID, &title, &price, &imageURL, &qty); err != nil {
-			log.Printf("Cart: scan error: %v", err)
-			continue
-		}
-		items = append(items, map[string]interface{}{
-			"CartID":   cartID,
-			"ID":       gameID,
-			"Title":    title,
-			"Price":    price,
-			"ImageURL": imageURL,
-			"Quantity": qty,
-		})
+	total, err := models.CartTotal(items)
+	if err != nil {
+		log.Printf("Cart: total error %v", err)
 	}
 
 	data := PageData{
-		UserID:   uid,
-		Username: h.getUsernameByID(uid),
-		Games:    items,
+		UserID:    uid,
+		Username:  h.getUsernameByID(r.Context(), uid),
+		Games:     items,
+		Total:     total,
+		Currency:  cur,
+		Errors:    cartErrors(items),
+		PriceTime: previewAt,
 	}
 	h.renderTemplate(w, "cart.html", data)
 }
 
-// Checkout — GET показывает форму, POST создаёт заказ и перенаправляет на /pay
-func (h *Handler) Checkout(w http.ResponseWriter, r *http.Request) {
-	h.ensureSchema()
+// renderCheckout — форма оформления: корзина со скидками и купоном coupon. Купон, который
+// не подошёл, не применяется, а причина показывается над формой.
+func (h *Handler) renderCheckout(w http.ResponseWriter, r *http.Request, status int, coupon string, errs []string) {
 	uid, _ := h.getCurrentUser(r)
-	if r.Method == http.MethodGet {
-		// собрать текущую корзину и сумму
-		type Item struct {
-			ID       int
-			Title    string
-			Price    float64
-			Quantity int
-		}
-		var items []Item
-		rows, err := h.DB.Query(`
-            SELECT g.id, g.title, g.price, c.quantity
-            FROM cart_items c
-            JOIN games g ON g.id = c.game_id
-            WHERE c.user_id = ?
-        `, uid)
-		if err == nil {
-			defer rows.Close()
-			for rows.Next() {
-				var it Item
-				if err := rows.Scan(&it.ID, &it.Title, &it.Price, &it.Quantity); err == nil {
-					items = append(items, it)
-				}
-			}
-		}
-		// compute total
-		var total float64
-		for _, it := range items {
-			total += it.Price * float64(it.Quantity)
-		}
-		data := PageData{
-			UserID:   uid,
-			Username: h.getUsernameByID(uid),
-			Games:    items,
-		}
-		// attach total via Recommended as hack (or extend PageData) — лучше добавить поле, но для минимальных изменений используем Username/other
-		// We'll pass total in Username? Instead extend PageData — but to keep minimal edits, embed total in Recommended? Better: extend PageData.
-		h.renderTemplate(w, "checkout.html", data)
-		return
+	cur := h.preferredCurrency(r.Context(), uid)
+	// в предпросмотре форма показывает цены на выбранную дату, но заказ всё равно будет по текущим
+	ctx, previewAt := h.priceContext(r, uid)
+	items, applied, err := h.Carts.Quote(ctx, uid, cur, coupon)
+	if msg := couponMessage(err); msg != "" {
+		errs = append(errs, msg)
+		status, coupon = http.StatusUnprocessableEntity, ""
+		items, applied, err = h.Carts.Quote(ctx, uid, cur, "")
 	}
-
-	// POST — создаём запись purchase и purchase_items, очищаем корзину, редирект на /pay?purchase_id=...
-	tx, err := h.DB.Begin()
 	if err != nil {
-		log.Printf("Checkout: tx begin error %v", err)
-		http.Error(w, "DB error", http.StatusInternalServerError)
-		return
+		log.Printf("Checkout: cart error %v", err)
 	}
-	// calculate total
-	rows2, err := tx.Query(`
-        SELECT g.id, g.price, c.quantity
-        FROM cart_items c
-        JOIN games g ON g.id = c.game_id
-        WHERE c.user_id = ?
-    `, uid)
-	if err != nil {
-		tx.Rollback()
-		http.Error(w, "DB error", http.StatusInternalServerError)
+	if len(cartErrors(items)) > 0 {
+		http.Redirect(w, r, "/cart", http.StatusSeeOther)
 		return
 	}
-	defer rows2.Close()
-	var total float64
-	type cartRow struct {
-		gameID int
-		price  float64
-		qty    int
-	}
-	var cartRows []cartRow
-	for rows2.Next() {
-		var gr cartRow
-		if err := rows2.Scan(&gr.gameID, &gr.price, &gr.qty); err == nil {
-			total += gr.price * float64(gr.qty)
-			cartRows = append(cartRows, gr)
-		}
+	total, err := models.CartTotal(items)
+	if err != nil {
+		log.Printf("Checkout: total error %v", err)
 	}
-	if len(cartRows) == 0 {
-		tx.Rollback()
-		http.Redirect(w, r, "/cart", http.StatusSeeOther)
+	data := PageData{
+		UserID:         uid,
+		Username:       h.getUsernameByID(r.Context(), uid),
+		Games:          items,
+		Total:          total,
+		Currency:       cur,
+		Promotions:     applied,
+		Coupon:         coupon,
+		Errors:         errs,
+		IdempotencyKey: newIdempotencyKey(),
+		PriceTime:      previewAt,
+		Form:           r.PostForm,
+	}
+	h.renderTemplateStatus(w, status, "checkout.html", data)
+}
+
+// Checkout — GET показывает форму (?coupon= — с купоном), POST создаёт заказ и перенаправляет на /pay
+func (h *Handler) Checkout(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	cur := h.preferredCurrency(r.Context(), uid)
+	if r.Method == http.MethodGet {
+		h.renderCheckout(w, r, http.StatusOK, r.URL.Query().Get("coupon"), nil)
 		return
 	}
-	res, err := tx.Exec("INSERT INTO purchases (user_id, total, paid, created_at) VALUES (?, ?, 0, ?)", uid, total, time.Now().Format(time.RFC3339))
+
+	// POST — создаём purchase и purchase_items в валюте покупателя, очищаем корзину, редирект на /pay?purchase_id=...
+	// Повтор формы с тем же ключом ведёт к уже созданному заказу.
+	key, err := requestIdempotencyKey(r)
 	if err != nil {
-		tx.Rollback()
-		log.Printf("Checkout: insert purchase error %v", err)
-		http.Error(w, "DB error", http.StatusInternalServerError)
+		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
-	pid, _ := res.LastInsertId()
-	for _, cr := range cartRows {
-		_, err := tx.Exec("INSERT INTO purchase_items (purchase_id, game_id, price, quantity) VALUES (?, ?, ?, ?)", pid, cr.gameID, cr.price, cr.qty)
-		if err != nil {
-			tx.Rollback()
-			log.Printf("Checkout: insert purchase_items error %v", err)
-			http.Error(w, "DB error", http.StatusInternalServerError)
-			return
-		}
-	}
-	// clear cart
-	_, err = tx.Exec("DELETE FROM cart_items WHERE user_id = ?", uid)
+	// получатели подарков из формы; при ошибках форма показывается снова с введёнными значениями
+	items, err := h.Carts.Items(r.Context(), uid, cur)
 	if err != nil {
-		tx.Rollback()
+		log.Printf("Checkout: cart error %v", err)
 		http.Error(w, "DB error", http.StatusInternalServerError)
 		return
 	}
-	if err := tx.Commit(); err != nil {
-		log.Printf("Checkout: commit error %v", err)
+	gifts, giftErrs, err := h.resolveGifts(r.Context(), uid, items, checkoutGiftRequests(r, items))
+	if err != nil {
+		log.Printf("Checkout: gift recipients error %v", err)
 		http.Error(w, "DB error", http.StatusInternalServerError)
 		return
 	}
-	http.Redirect(w, r, "/pay?purchase_id="+strconv.FormatInt(pid, 10), http.StatusSeeOther)
-}
-
-// Pay — мок-оплата: отмечаем purchase как оплаченный, добавляем игры в библиотеку
-func (h *Handler) Pay(w http.ResponseWriter, r *http.Request) {
-	h.ensureSchema()
-	uid, _ := h.getCurrentUser(r)
-	pidStr := r.FormValue("purchase_id")
-	if pidStr == "" {
-		pidStr = r.URL.Query().Get("purchase_id")
-	}
-	pid, err := strconv.Atoi(pidStr)
-	if err != nil || pid == 0 {
-		http.Redirect(w, r, "/purchases", http.StatusSeeOther)
+	if len(giftErrs) > 0 {
+		msgs := make([]string, 0, len(giftErrs))
+		for _, e := range giftErrs {
+			msgs = append(msgs, e.Message())
+		}
+		h.renderCheckout(w, r, http.StatusUnprocessableEntity, r.PostFormValue("coupon"), msgs)
 		return
 	}
-
-	// verify purchase belongs to user
-	var owner int
-	err = h.DB.QueryRow("SELECT user_id FROM purchases WHERE id = ?", pid).Scan(&owner)
-	if err != nil || owner != uid {
-		http.Redirect(w, r, "/purchases", http.StatusSeeOther)
-		return
+	order, err := h.Orders.CreateFromCart(r.Context(), uid, cur, r.PostFormValue("coupon"), key, gifts)
+	if errors.Is(err, storage.ErrIdempotentReplay) {
+		err = nil
 	}
-
-	if r.Method == http.MethodGet {
-		data := PageData{
-			UserID:     uid,
-			Username:   h.getUsernameByID(uid),
-			PurchaseID: pid, // передаём в шаблон
-		}
-		h.renderTemplate(w, "pay.html", data)
+	if errors.Is(err, storage.ErrEmptyCart) || errors.Is(err, storage.ErrPriceUnavailable) || errors.Is(err, storage.ErrAlreadyOwned) {
+		http.Redirect(w, r, "/cart", http.StatusSeeOther)
 		return
 	}
-
-	// POST -> mark paid and add to user_games
-	tx, err := h.DB.Begin()
-	if err != nil {
-		http.Error(w, "DB error", http.StatusInternalServerError)
+	if errors.Is(err, storage.ErrInvalidGift) {
+		h.renderCheckout(w, r, http.StatusConflict, r.PostFormValue("coupon"), []string{"Корзина изменилась — проверьте получателей подарков ещё раз"})
 		return
 	}
-	_, err = tx.Exec("UPDATE purchases SET paid = 1 WHERE id = ?", pid)
-	if err != nil {
-		tx.Rollback()
-		http.Error(w, "DB error", http.StatusInternalServerError)
+	if msg := couponMessage(err); msg != "" {
+		// купон перестал действовать или последнее использование скидки заняли, пока покупатель
+		// смотрел на форму: показываем корзину с тем, что действует сейчас
+		h.renderCheckout(w, r, http.StatusConflict, "", []string{msg})
 		return
 	}
-	// select items
-	rows, err := tx.Query("SELECT game_id, quantity FROM purchase_items WHERE purchase_id = ?", pid)
 	if err != nil {
-		tx.Rollback()
+		log.Printf("Checkout: create order error %v", err)
 		http.Error(w, "DB error", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var gid, qty int
-		if err := rows.Scan(&gid, &qty); err == nil {
-			// insert into user_games (ignore duplicates)
-			_, _ = tx.Exec("INSERT OR IGNORE INTO user_games (user_id, game_id) VALUES (?, ?)", uid, gid)
-		}
+	http.Redirect(w, r, "/pay?purchase_id="+strconv.Itoa(order.ID), http.StatusSeeOther)
+}
+
+// cartErrors — почему корзину нельзя оформить: игры без цены в валюте покупателя
+// или личные копии игр, которые уже есть в библиотеке.
+func cartErrors(items []models.CartItem) []string {
+	var errs []string
+	if models.HasUnavailable(items) {
+		errs = append(errs, "Некоторые игры не продаются в вашем регионе — удалите их из корзины или смените валюту в аккаунте.")
 	}
-	if err := tx.Commit(); err != nil {
-		http.Error(w, "DB error", http.StatusInternalServerError)
-		return
+	if models.HasOwned(items) {
+		errs = append(errs, "Некоторые игры уже есть в вашей библиотеке — удалите их из корзины или купите в подарок.")
 	}
-	http.Redirect(w, r, "/library", http.StatusSeeOther)
+	return errs
 }
 
 // Purchases — история пользователя
 func (h *Handler) Purchases(w http.ResponseWriter, r *http.Request) {
-	h.ensureSchema()
 	uid, _ := h.getCurrentUser(r)
 
-	type P struct {
-		ID    int
-		Date  string
-		Total float64
-	}
-	var out []P
-	rows, err := h.DB.Query("SELECT id, created_at, total FROM purchases WHERE user_id = ? ORDER BY created_at DESC", uid)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var p P
-			if err := rows.Scan(&p.ID, &p.Date, &p.Total); err == nil {
-				out = append(out, p)
+	orders, err := h.Orders.ListByUser(r.Context(), uid)
+	if err != nil {
+		log.Printf("Purchases: db error %v", err)
+	}
+	refunds, err := h.Refunds.ListByUser(r.Context(), uid)
+	if err != nil {
+		log.Printf("Purchases: refunds query error %v", err)
+	}
+	now := time.Now()
+	views := make([]orderView, 0, len(orders))
+	for _, o := range orders {
+		for _, rf := range refunds {
+			if rf.OrderID == o.ID {
+				o.Refunds = append(o.Refunds, rf)
 			}
 		}
-	} else {
-		log.Printf("Purchases: db error %v", err)
+		views = append(views, orderView{Order: o, Refundable: h.refundable(o, now)})
 	}
 	data := PageData{
 		UserID:    uid,
-		Username:  h.getUsernameByID(uid),
-		Purchases: out,
+		Username:  h.getUsernameByID(r.Context(), uid),
+		Purchases: views,
 	}
 	h.renderTemplate(w, "orders.html", data)
 }
 
+// CancelOrder — POST /purchases/cancel: покупатель отменяет свой неоплаченный заказ
+// (и начатые попытки оплаты у провайдера).
+func (h *Handler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/purchases", http.StatusSeeOther)
+		return
+	}
+	pid, err := strconv.Atoi(r.FormValue("purchase_id"))
+	if err != nil {
+		http.Redirect(w, r, "/purchases", http.StatusSeeOther)
+		return
+	}
+	order, err := h.Orders.Get(r.Context(), pid)
+	if err != nil || order.UserID != uid {
+		http.Redirect(w, r, "/purchases", http.StatusSeeOther)
+		return
+	}
+	err = h.cancelOrder(r.Context(), order)
+	if errors.Is(err, errPaymentInFlight) {
+		log.Printf("CancelOrder: %v", err)
+		err = nil
+	}
+	if err != nil && !errors.Is(err, storage.ErrInvalidTransition) {
+		log.Printf("CancelOrder: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	// оплаченный (в том числе только что, пока событие в пути) или уже закрытый заказ не отменяется —
+	// на странице видно его статус
+	http.Redirect(w, r, "/purchases", http.StatusSeeOther)
+}
+
 // Library — список купленных игр
 func (h *Handler) Library(w http.ResponseWriter, r *http.Request) {
-	h.ensureSchema()
 	uid, _ := h.getCurrentUser(r)
 
-	type G struct {
-		ID    int
-		Title string
-	}
-	var libs []G
-	rows, err := h.DB.Query(`
-        SELECT g.id, g.title
-        FROM user_games ug
-        JOIN games g ON g.id = ug.game_id
-        WHERE ug.user_id = ?
-    `, uid)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var g G
-			if err := rows.Scan(&g.ID, &g.Title); err == nil {
-				libs = append(libs, g)
-			}
-		}
-	} else {
+	libs, err := h.Libraries.List(r.Context(), uid)
+	if err != nil {
 		log.Printf("Library: db error %v", err)
 	}
 	data := PageData{
 		UserID:   uid,
-		Username: h.getUsernameByID(uid),
+		Username: h.getUsernameByID(r.Context(), uid),
 		Games:    libs,
 	}
 	h.renderTemplate(w, "library.html", data)
 }
 
-// Account — страница аккаунта: показывает покупки и рекомендации
+// Account — страница аккаунта: показывает покупки, рекомендации и токены доступа
 func (h *Handler) Account(w http.ResponseWriter, r *http.Request) {
 	uid, err := h.getCurrentUser(r)
 	if err != nil || uid == 0 {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
-
-	type Purchase struct {
-		ID    int
-		Date  string
-		Total float64
-	}
-	var purchases []Purchase
-	rows, err := h.DB.Query("SELECT id, created_at, total FROM purchases WHERE user_id = ? ORDER BY created_at DESC", uid)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var p Purchase
-			if err := rows.Scan(&p.ID, &p.Date, &p.Total); err == nil {
-				purchases = append(purchases, p)
-			}
-		}
-	} else {
-		log.Printf("Account: purchases query error: %v", err)
-	}
-
-	type Rec struct {
-		ID       int
-		Title    string
-		Price    float64
-		ImageURL string
-	}
-	var recs []Rec
-	rrows, err := h.DB.Query("SELECT id, title, price, image_url FROM games ORDER BY id DESC LIMIT 6")
-	if err == nil {
-		defer rrows.Close()
-		for rrows.Next() {
-			var g Rec
-			if err := rrows.Scan(&g.ID, &g.Title, &g.Price, &g.ImageURL); err == nil {
-				recs = append(recs, g)
-			}
-		}
-	} else {
-		log.Printf("Account: recommended query error: %v", err)
-	}
-
-	data := PageData{
-		UserID:      uid,
-		Username:    h.getUsernameByID(uid),
-		Purchases:   purchases,
-		Recommended: recs,
-	}
-	h.renderTemplate(w, "account.html", data)
+	h.renderAccount(w, r, http.StatusOK, uid, "", nil)
 }
 
 func (h *Handler) Static(w http.ResponseWriter, r *http.Request) {
@@ -1097,19 +879,33 @@ func (h *Handler) Static(w http.ResponseWriter, r *http.Request) {
 
 // getUsernameByID возвращает имя пользователя по его id или пустую строку, если не найден.
 // Используется в PageData.Username перед рендером шаблонов.
-func (h *Handler) getUsernameByID(id int) string {
-	if id == 0 || h == nil || h.DB == nil {
+func (h *Handler) getUsernameByID(ctx context.Context, id int) string {
+	if id == 0 || h == nil || h.Customers == nil {
 		return ""
 	}
-	var username string
-	err := h.DB.QueryRow("SELECT username FROM customers WHERE id = ?", id).Scan(&username)
+	c, err := h.Customers.Get(ctx, id)
 	if err != nil {
-		if err != sql.ErrNoRows {
+		if !errors.Is(err, storage.ErrNotFound) {
 			log.Printf("getUsernameByID: db error for id=%d: %v", id, err)
 		}
 		return ""
 	}
-	return username
+	return c.Username
+}
+
+// getRoleByID возвращает роль пользователя; для анонима и при ошибке — пустую роль без прав.
+func (h *Handler) getRoleByID(ctx context.Context, id int) models.Role {
+	if id == 0 || h == nil || h.Customers == nil {
+		return ""
+	}
+	c, err := h.Customers.Get(ctx, id)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("getRoleByID: db error for id=%d: %v", id, err)
+		}
+		return ""
+	}
+	return c.Role
 }
 
 func (h *Handler) RemoveFromCart(w http.ResponseWriter, r *http.Request) {
@@ -1128,8 +924,7 @@ func (h *Handler) RemoveFromCart(w http.ResponseWriter, r *http.Request) {
 	if cartIDStr != "" {
 		cid, err := strconv.Atoi(cartIDStr)
 		if err == nil && cid > 0 {
-			_, err = h.DB.Exec("DELETE FROM cart_items WHERE id = ? AND user_id = ?", cid, uid)
-			if err != nil {
+			if err := h.Carts.Remove(r.Context(), uid, cid); err != nil {
 				log.Printf("RemoveFromCart (by cart_id): db error: %v", err)
 			}
 			http.Redirect(w, r, "/cart", http.StatusSeeOther)
@@ -1152,8 +947,7 @@ func (h *Handler) RemoveFromCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.DB.Exec("DELETE FROM cart_items WHERE user_id = ? AND game_id = ?", uid, gid)
-	if err != nil {
+	if err := h.Carts.RemoveGame(r.Context(), uid, gid); err != nil {
 		log.Printf("RemoveFromCart (by game_id): db error: %v", err)
 	}
 	http.Redirect(w, r, "/cart", http.StatusSeeOther)
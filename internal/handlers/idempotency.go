@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/payment"
+	"github.com/aml-709/game-store/internal/storage"
+)
+
+// Ключ идемпотентности приходит в заголовке (API) или скрытым полем формы (HTML);
+// в ответ на повтор API ставит заголовок IdempotentReplayedHeader.
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	idempotencyKeyField      = "idempotency_key"
+)
+
+var errIdempotencyKeyReused = errors.New("idempotency key was used for another order")
+
+// newIdempotencyKey — ключ для формы: одна отрисовка страницы — одна операция.
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("handlers: crypto/rand failed: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestIdempotencyKey — ключ из заголовка или формы; пустой — запрос без идемпотентности.
+func requestIdempotencyKey(r *http.Request) (string, error) {
+	key := strings.TrimSpace(r.Header.Get(IdempotencyKeyHeader))
+	if key == "" {
+		key = strings.TrimSpace(r.PostFormValue(idempotencyKeyField))
+	}
+	if len(key) > models.MaxIdempotencyKey {
+		return "", fmt.Errorf("%s longer than %d bytes", IdempotencyKeyHeader, models.MaxIdempotencyKey)
+	}
+	for _, c := range key {
+		if c < 0x21 || c > 0x7e {
+			return "", fmt.Errorf("%s must be printable ASCII", IdempotencyKeyHeader)
+		}
+	}
+	return key, nil
+}
+
+// replayedPayment — платёж, уже начатый по заказу с этим ключом, и его намерение у провайдера.
+// found=false — ключ ещё не использовался.
+func (h *Handler) replayedPayment(ctx context.Context, order models.Order, key string) (p models.Payment, in payment.Intent, found bool, err error) {
+	if key == "" {
+		return p, in, false, nil
+	}
+	prev, err := h.Idempotency.Lookup(ctx, order.UserID, models.OpPay, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return p, in, false, nil
+	}
+	if err != nil {
+		return p, in, false, err
+	}
+	if prev.OrderID != order.ID {
+		return p, in, true, errIdempotencyKeyReused
+	}
+	if p, err = h.Payments.Get(ctx, prev.PaymentID); err != nil {
+		return p, in, true, err
+	}
+	in, err = h.Gateway.Intent(ctx, p.IntentID)
+	return p, in, true, err
+}
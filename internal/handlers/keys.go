@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/storage"
+)
+
+const (
+	maxKeyBatch = 100 // длина пометки партии ключей
+	// recentRedemptions — сколько последних активаций показывает админка.
+	recentRedemptions = 100
+)
+
+// RedeemKey — GET /redeem: форма ввода ключа, POST — активирует ключ и добавляет игру в библиотеку.
+func (h *Handler) RedeemKey(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	data := PageData{
+		UserID:   uid,
+		Username: h.getUsernameByID(r.Context(), uid),
+	}
+	if r.Method != http.MethodPost {
+		h.renderTemplate(w, "redeem.html", data)
+		return
+	}
+
+	code := models.NormalizeKey(r.FormValue("code"))
+	data.Form = r.PostForm
+	status := http.StatusUnprocessableEntity
+	var err error
+	if !models.ValidKeyCode(code) {
+		err = storage.ErrNotFound
+	} else {
+		var k models.ActivationKey
+		k, err = h.Keys.Redeem(r.Context(), uid, code)
+		if err == nil {
+			log.Printf("RedeemKey: key %d for game %d redeemed by user %d", k.ID, k.GameID, uid)
+			data.Keys = k
+			data.Form = nil
+			h.renderTemplate(w, "redeem.html", data)
+			return
+		}
+	}
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		data.Errors = []string{"Такого ключа нет — проверьте, что он введён без ошибок"}
+	case errors.Is(err, storage.ErrKeyRedeemed):
+		status = http.StatusConflict
+		data.Errors = []string{"Этот ключ уже активирован"}
+	case errors.Is(err, storage.ErrKeyRevoked):
+		status = http.StatusConflict
+		data.Errors = []string{"Этот ключ отозван: за подарок вернули деньги"}
+	case errors.Is(err, storage.ErrAlreadyOwned):
+		status = http.StatusConflict
+		data.Errors = []string{"Эта игра уже есть в вашей библиотеке — ключ не активирован, его можно отдать другому"}
+	default:
+		log.Printf("RedeemKey: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	h.renderTemplateStatus(w, status, "redeem.html", data)
+}
+
+// parseKeyForm читает форму выпуска ключей из admin_keys.html: игра, партия и либо количество
+// новых ключей (mode=generate), либо список кодов по одному в строке (mode=import).
+func (h *Handler) parseKeyForm(r *http.Request) (gameID int, batch string, codes []string, errs []string) {
+	_ = r.ParseForm()
+	f := r.PostForm
+	gameID, err := strconv.Atoi(f.Get("game_id"))
+	if err == nil {
+		_, err = h.Games.Get(r.Context(), gameID, "")
+	}
+	if err != nil {
+		errs = append(errs, "Игра не найдена")
+	}
+	batch = strings.TrimSpace(f.Get("batch"))
+	if utf8.RuneCountInString(batch) > maxKeyBatch {
+		errs = append(errs, fmt.Sprintf("Партия — не длиннее %d символов", maxKeyBatch))
+	}
+
+	switch f.Get("mode") {
+	case "generate":
+		n, err := strconv.Atoi(strings.TrimSpace(f.Get("count")))
+		if err != nil || n < 1 || n > models.MaxKeysPerBatch {
+			errs = append(errs, fmt.Sprintf("Количество ключей — от 1 до %d", models.MaxKeysPerBatch))
+			break
+		}
+		for range n {
+			code, err := models.NewKeyCode()
+			if err != nil {
+				panic("handlers: crypto/rand failed: " + err.Error())
+			}
+			codes = append(codes, code)
+		}
+	case "import":
+		seen := map[string]bool{}
+		var bad []string
+		for line := range strings.Lines(f.Get("codes")) {
+			code := models.NormalizeKey(line)
+			switch {
+			case code == "" || seen[code]:
+			case !models.ValidKeyCode(code):
+				bad = append(bad, strings.TrimSpace(line))
+			default:
+				seen[code] = true
+				codes = append(codes, code)
+			}
+		}
+		if len(bad) > 0 {
+			errs = append(errs, fmt.Sprintf("Некорректные ключи (латинские буквы и цифры, до %d символов): %s", models.MaxKeyCode, strings.Join(bad, ", ")))
+		}
+		if len(codes) == 0 && len(bad) == 0 {
+			errs = append(errs, "Вставьте ключи, по одному в строке")
+		}
+		if len(codes) > models.MaxKeysPerBatch {
+			errs = append(errs, fmt.Sprintf("За раз — не больше %d ключей", models.MaxKeysPerBatch))
+		}
+	default:
+		errs = append(errs, "Выберите: сгенерировать ключи или импортировать")
+	}
+	return gameID, batch, codes, errs
+}
+
+func (h *Handler) renderAdminKeys(w http.ResponseWriter, r *http.Request, status int, form url.Values, added []models.ActivationKey, errs []string) {
+	uid, _ := h.getCurrentUser(r)
+	games, err := h.Games.ListAll(r.Context())
+	if err != nil {
+		log.Printf("AdminKeys: games error %v", err)
+	}
+	stock, err := h.Keys.Stock(r.Context())
+	if err != nil {
+		log.Printf("AdminKeys: stock error %v", err)
+	}
+	redemptions, err := h.Keys.Redemptions(r.Context(), recentRedemptions)
+	if err != nil {
+		log.Printf("AdminKeys: redemptions error %v", err)
+	}
+	if form == nil {
+		form = url.Values{"mode": {"generate"}, "count": {"10"}}
+	}
+	data := PageData{
+		UserID:      uid,
+		Username:    h.getUsernameByID(r.Context(), uid),
+		Games:       games,
+		Keys:        added,
+		KeyStock:    stock,
+		Redemptions: redemptions,
+		Form:        form,
+		Errors:      errs,
+	}
+	// ?game_id= — все ключи игры с тем, кто и когда их активировал
+	if id, err := strconv.Atoi(r.URL.Query().Get("game_id")); err == nil {
+		keys, err := h.Keys.List(r.Context(), id, "")
+		if err != nil {
+			log.Printf("AdminKeys: keys error %v", err)
+		}
+		data.Keys = keys
+	}
+	h.renderTemplateStatus(w, status, "admin_keys.html", data)
+}
+
+// AdminKeys — GET /admin/keys: запас ключей по играм и последние активации (?game_id= — все ключи
+// игры), POST — генерирует или импортирует партию ключей и показывает добавленные.
+func (h *Handler) AdminKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.renderAdminKeys(w, r, http.StatusOK, nil, nil, nil)
+		return
+	}
+	gameID, batch, codes, errs := h.parseKeyForm(r)
+	if len(errs) > 0 {
+		h.renderAdminKeys(w, r, http.StatusUnprocessableEntity, r.PostForm, nil, errs)
+		return
+	}
+	uid, _ := h.getCurrentUser(r)
+	added, err := h.Keys.Add(r.Context(), gameID, codes, batch, uid)
+	if err != nil {
+		log.Printf("AdminKeys: insert error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("AdminKeys: %d keys added for game %d (batch %q), %d duplicates skipped", len(added), gameID, batch, len(codes)-len(added))
+	if skipped := len(codes) - len(added); skipped > 0 {
+		errs = []string{fmt.Sprintf("Пропущено ключей, которые уже есть в магазине: %d", skipped)}
+	}
+	h.renderAdminKeys(w, r, http.StatusOK, nil, added, errs)
+}
+
+// ExportKeys — GET /admin/keys/export?game_id=&batch=: ключи игры (или одной партии) в CSV
+// для передачи партнёру, со статусом активации.
+func (h *Handler) ExportKeys(w http.ResponseWriter, r *http.Request) {
+	gameID, err := strconv.Atoi(r.URL.Query().Get("game_id"))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	batch := r.URL.Query().Get("batch")
+	keys, err := h.Keys.List(r.Context(), gameID, batch)
+	if err != nil {
+		log.Printf("ExportKeys: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="keys-game-%d.csv"`, gameID))
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"key", "game", "batch", "created_at", "redeemed_by", "redeemed_at"})
+	for _, k := range keys {
+		var redeemedAt string
+		if k.Redeemed() {
+			redeemedAt = k.RedeemedAt.UTC().Format(time.RFC3339)
+		}
+		_ = cw.Write([]string{k.Display(), k.GameTitle, k.Batch, k.CreatedAt.UTC().Format(time.RFC3339), k.Redeemer, redeemedAt})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("ExportKeys: write error %v", err)
+	}
+}
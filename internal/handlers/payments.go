@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/payment"
+	"github.com/aml-709/game-store/internal/storage"
+)
+
+var (
+	errPaymentAmountMismatch = errors.New("payment event amount does not match the payment")
+	// errPaymentInFlight — намерение уже оплачено у провайдера, событие об этом ещё не дошло:
+	// заказ сейчас станет оплаченным, закрывать его нельзя.
+	errPaymentInFlight = errors.New("payment has already succeeded at the provider")
+)
+
+// payReturnURL — куда провайдер возвращает покупателя: снова на страницу оплаты заказа,
+// которая покажет результат.
+func payReturnURL(orderID int) string {
+	return "/pay?purchase_id=" + strconv.Itoa(orderID)
+}
+
+// startPayment создаёт у провайдера платёжное намерение на сумму заказа и запоминает платёж.
+// Если тот же ключ idemKey уже использовали (в том числе параллельный запрос), возвращает
+// первый платёж и его намерение с storage.ErrIdempotentReplay.
+func (h *Handler) startPayment(ctx context.Context, order models.Order, idemKey string) (models.Payment, payment.Intent, error) {
+	if p, in, found, err := h.replayedPayment(ctx, order, idemKey); found || err != nil {
+		if err == nil {
+			err = storage.ErrIdempotentReplay
+		}
+		return p, in, err
+	}
+	in, err := h.Gateway.CreateIntent(ctx, payment.IntentParams{
+		OrderID:   order.ID,
+		Amount:    order.Total,
+		ReturnURL: payReturnURL(order.ID),
+	})
+	if err != nil {
+		return models.Payment{}, in, err
+	}
+	p := models.Payment{OrderID: order.ID, Provider: h.Gateway.Name(), IntentID: in.ID, Amount: order.Total}
+	err = h.Payments.Create(ctx, &p, models.IdempotencyKey{UserID: order.UserID, Key: idemKey})
+	if errors.Is(err, storage.ErrIdempotentReplay) {
+		// параллельный запрос с тем же ключом успел раньше; наше намерение так и останется неоплаченным
+		if in, err = h.Gateway.Intent(ctx, p.IntentID); err == nil {
+			err = storage.ErrIdempotentReplay
+		}
+	}
+	return p, in, err
+}
+
+// VoidPayments отменяет у провайдера намерения ожидающих платежей заказа, чтобы по заказу,
+// который закрывают без оплаты (отмена покупателем, просрочка), нельзя было заплатить.
+// Годится как storage.VoidFunc для фоновой просрочки заказов.
+// Намерение, которого провайдер не знает, оплатить тоже нельзя — это не ошибка.
+func (h *Handler) VoidPayments(ctx context.Context, orderID int) error {
+	pending, err := h.Payments.Pending(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	for _, p := range pending {
+		_, err := h.Gateway.Cancel(ctx, p.IntentID)
+		switch {
+		case err == nil, errors.Is(err, payment.ErrUnknownIntent):
+		case errors.Is(err, payment.ErrInvalidState):
+			return fmt.Errorf("%w: order %d, payment %d: %v", errPaymentInFlight, orderID, p.ID, err)
+		default:
+			return fmt.Errorf("cancel payment %d: %w", p.ID, err)
+		}
+	}
+	return nil
+}
+
+// cancelOrder — отмена заказа покупателем: сначала отменяются намерения у провайдера, потом заказ.
+// Оплаченный или уже закрытый заказ — storage.ErrInvalidTransition, оплата в пути — errPaymentInFlight.
+func (h *Handler) cancelOrder(ctx context.Context, order models.Order) error {
+	if !order.Status.Cancellable() {
+		return fmt.Errorf("%w: order %d is %s", storage.ErrInvalidTransition, order.ID, order.Status)
+	}
+	if err := h.VoidPayments(ctx, order.ID); err != nil {
+		return err
+	}
+	return h.Orders.Transition(ctx, order.ID, models.OrderCancelled, "Отменён покупателем")
+}
+
+// refundClosedOrderPayment возвращает оплату, которая пришла по уже закрытому заказу
+// (storage.ErrOrderClosed): игры за неё не выданы. Событие отмечается обработанным только
+// после возврата — если провайдер не ответил, повтор события попробует снова.
+func (h *Handler) refundClosedOrderPayment(ctx context.Context, p models.Payment, processed models.ProcessedEvent, cause error) error {
+	_, err := h.Gateway.Refund(ctx, p.IntentID, p.Amount)
+	// ErrInvalidAmount — платёж уже возвращён (повтор события после возврата)
+	if err != nil && !errors.Is(err, payment.ErrInvalidAmount) {
+		return fmt.Errorf("refund payment %d for closed order: %w", p.ID, err)
+	}
+	if err := h.Payments.RecordEvent(ctx, processed); err != nil && !errors.Is(err, storage.ErrDuplicateEvent) {
+		return err
+	}
+	log.Printf("payment %d refunded automatically: %v", p.ID, cause)
+	return nil
+}
+
+// Pay — GET показывает заказ и состояние оплаты, POST отправляет покупателя на страницу провайдера.
+// Оплаченным заказ становится только по событию провайдера (PaymentWebhook).
+func (h *Handler) Pay(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	pidStr := r.FormValue("purchase_id")
+	if pidStr == "" {
+		pidStr = r.URL.Query().Get("purchase_id")
+	}
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil || pid == 0 {
+		http.Redirect(w, r, "/purchases", http.StatusSeeOther)
+		return
+	}
+
+	// verify purchase belongs to user
+	order, err := h.Orders.Get(r.Context(), pid)
+	if err != nil || order.UserID != uid {
+		http.Redirect(w, r, "/purchases", http.StatusSeeOther)
+		return
+	}
+	if order.Paid {
+		http.Redirect(w, r, "/library", http.StatusSeeOther)
+		return
+	}
+	if !order.Status.Payable() {
+		// отменён, просрочен или возвращён — статус виден в истории заказов
+		http.Redirect(w, r, "/purchases", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		data := PageData{
+			UserID:         uid,
+			Username:       h.getUsernameByID(r.Context(), uid),
+			PurchaseID:     pid, // передаём в шаблон
+			Order:          order,
+			IdempotencyKey: newIdempotencyKey(),
+		}
+		p, err := h.Payments.LatestForOrder(r.Context(), pid)
+		switch {
+		case err == nil:
+			data.Payment = p
+		case !errors.Is(err, storage.ErrNotFound):
+			log.Printf("Pay: payment query error %v", err)
+		}
+		h.renderTemplate(w, "pay.html", data)
+		return
+	}
+
+	// POST -> новая попытка оплаты у провайдера (повтор той же формы — та же попытка)
+	key, err := requestIdempotencyKey(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	_, in, err := h.startPayment(r.Context(), order, key)
+	if errors.Is(err, storage.ErrInvalidTransition) || errors.Is(err, errIdempotencyKeyReused) {
+		http.Redirect(w, r, "/purchases", http.StatusSeeOther)
+		return
+	}
+	if errors.Is(err, storage.ErrIdempotentReplay) {
+		err = nil
+	}
+	if err != nil {
+		log.Printf("Pay: start payment error %v", err)
+		http.Error(w, "Payment error", http.StatusBadGateway)
+		return
+	}
+	http.Redirect(w, r, in.RedirectURL, http.StatusSeeOther)
+}
+
+// FakeCheckout — страница оплаты тестового провайдера (GET/POST /payments/fake/{id}).
+// В реальном провайдере эта страница на его стороне; здесь она открыта без входа,
+// как и страница провайдера, — id намерения случайный.
+func (h *Handler) FakeCheckout(w http.ResponseWriter, r *http.Request) {
+	fake, ok := h.Gateway.(*payment.Fake)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	in, err := fake.Intent(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		h.renderTemplate(w, "payment_fake.html", PageData{Payment: in})
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "pay":
+		_, err = fake.Confirm(r.Context(), in.ID)
+	case "decline":
+		_, err = fake.Decline(r.Context(), in.ID, "Оплата отклонена")
+	default:
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if err != nil && !errors.Is(err, payment.ErrInvalidState) {
+		log.Printf("FakeCheckout: %v", err)
+		http.Error(w, "Payment error", http.StatusInternalServerError)
+		return
+	}
+	ret := in.ReturnURL
+	if ret == "" {
+		ret = "/"
+	}
+	http.Redirect(w, r, ret, http.StatusSeeOther)
+}
+
+// maxWebhookBody — предел размера тела вебхука.
+const maxWebhookBody = 64 << 10
+
+// PaymentWebhook — POST /webhooks/payments: события провайдера. Проверяет подпись,
+// применяет событие к платежу и заказу; повтор уже обработанного события ничего не меняет.
+// На 404 и 5xx провайдер повторит доставку, на прочие 4xx — нет.
+func (h *Handler) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	ev, err := h.Gateway.VerifyWebhook(payload, r.Header)
+	if err != nil {
+		log.Printf("PaymentWebhook: rejected event: %v", err)
+		http.Error(w, "Invalid signature", http.StatusBadRequest)
+		return
+	}
+
+	err = h.processPaymentEvent(r.Context(), ev)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, storage.ErrDuplicateEvent):
+		log.Printf("PaymentWebhook: event %s already processed", ev.ID)
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, storage.ErrNotFound):
+		log.Printf("PaymentWebhook: %v", err)
+		http.Error(w, "Unknown payment", http.StatusNotFound)
+	case errors.Is(err, storage.ErrInvalidTransition):
+		// оплату по закрытому заказу возвращаем сами (refundClosedOrderPayment); сюда — прочие
+		// конфликты статусов, повторять доставку бессмысленно
+		log.Printf("PaymentWebhook: %v", err)
+		http.Error(w, "Order state conflict", http.StatusConflict)
+	case errors.Is(err, errPaymentAmountMismatch), errors.Is(err, storage.ErrInvalidRefund):
+		log.Printf("PaymentWebhook: %v", err)
+		http.Error(w, "Amount mismatch", http.StatusUnprocessableEntity)
+	default:
+		log.Printf("PaymentWebhook: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+	}
+}
+
+// processPaymentEvent переводит платёж (и заказ) по событию провайдера. Каждое событие
+// применяется в одной транзакции с отметкой в processed_events, поэтому повтор — ErrDuplicateEvent.
+func (h *Handler) processPaymentEvent(ctx context.Context, ev payment.Event) error {
+	processed := models.ProcessedEvent{Provider: h.Gateway.Name(), ID: ev.ID, Type: string(ev.Type)}
+	p, err := h.Payments.GetByIntent(ctx, processed.Provider, ev.IntentID)
+	if err != nil {
+		return fmt.Errorf("payment for intent %s: %w", ev.IntentID, err)
+	}
+	switch ev.Type {
+	case payment.EventPaymentSucceeded:
+		if ev.Amount != p.Amount {
+			return fmt.Errorf("%w: event %s, payment %d: %s != %s", errPaymentAmountMismatch, ev.ID, p.ID, ev.Amount, p.Amount)
+		}
+		err := h.Payments.MarkSucceeded(ctx, p.ID, processed)
+		if errors.Is(err, storage.ErrOrderClosed) {
+			return h.refundClosedOrderPayment(ctx, p, processed, err)
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("payment %d succeeded, order %d paid", p.ID, p.OrderID)
+	case payment.EventPaymentFailed:
+		if err := h.Payments.MarkFailed(ctx, p.ID, ev.Reason, processed); err != nil {
+			return err
+		}
+		log.Printf("payment %d failed: %s", p.ID, ev.Reason)
+	case payment.EventRefundSucceeded:
+		if err := h.Payments.AddRefund(ctx, p.ID, ev.Amount, processed); err != nil {
+			return fmt.Errorf("refund %s of payment %d: %w", ev.Amount, p.ID, err)
+		}
+		log.Printf("payment %d refunded %s", p.ID, ev.Amount)
+	default:
+		if err := h.Payments.RecordEvent(ctx, processed); err != nil {
+			return err
+		}
+		log.Printf("payment event %s of type %s ignored", ev.ID, ev.Type)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+	"github.com/aml-709/game-store/internal/payment"
+	"github.com/aml-709/game-store/internal/storage"
+)
+
+// fakeOrders — OrderRepo с одним заказом в памяти; остальные методы не нужны (паника при вызове).
+type fakeOrders struct {
+	storage.OrderRepo
+	order       models.Order
+	transitions []models.OrderStatus
+}
+
+func (f *fakeOrders) Get(ctx context.Context, id int) (models.Order, error) {
+	if id != f.order.ID {
+		return models.Order{}, storage.ErrNotFound
+	}
+	return f.order, nil
+}
+
+func (f *fakeOrders) Transition(ctx context.Context, id int, to models.OrderStatus, reason string) error {
+	if !f.order.Status.CanTransition(to) {
+		return storage.ErrInvalidTransition
+	}
+	f.order.Status = to
+	f.transitions = append(f.transitions, to)
+	return nil
+}
+
+// fakePayments — PaymentRepo, который знает только ожидающие платежи.
+type fakePayments struct {
+	storage.PaymentRepo
+	pending []models.Payment
+}
+
+func (f *fakePayments) Pending(ctx context.Context, orderID int) ([]models.Payment, error) {
+	return f.pending, nil
+}
+
+// newCancelTest — заказ покупателя 1 с одной попыткой оплаты у тестового провайдера.
+func newCancelTest(t *testing.T, status models.OrderStatus) (*Handler, *fakeOrders, *payment.Fake, payment.Intent) {
+	t.Helper()
+	gw := payment.NewFake("secret")
+	amount := money.New(1999, money.USD)
+	intent, err := gw.CreateIntent(context.Background(), payment.IntentParams{OrderID: 7, Amount: amount})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders := &fakeOrders{order: models.Order{ID: 7, UserID: 1, Status: status, Total: amount}}
+	payments := &fakePayments{pending: []models.Payment{{ID: 3, OrderID: 7, Provider: gw.Name(), IntentID: intent.ID, Amount: amount}}}
+	h := &Handler{Repos: storage.Repos{Orders: orders, Payments: payments}, Gateway: gw}
+	return h, orders, gw, intent
+}
+
+func cancelRequest(h *Handler, userID, orderID int) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/orders/"+strconv.Itoa(orderID)+"/cancel", nil)
+	r.SetPathValue("id", strconv.Itoa(orderID))
+	r = r.WithContext(context.WithValue(r.Context(), principalCtxKey, &principal{UserID: userID}))
+	w := httptest.NewRecorder()
+	h.APICancelOrder(w, r)
+	return w
+}
+
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Error apiError `json:"error"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Error.Code
+}
+
+func TestAPICancelOrderVoidsIntent(t *testing.T) {
+	h, orders, gw, intent := newCancelTest(t, models.OrderPending)
+
+	w := cancelRequest(h, 1, 7)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if orders.order.Status != models.OrderCancelled {
+		t.Errorf("order is %s, want cancelled", orders.order.Status)
+	}
+	// отменённое намерение оплатить уже нельзя
+	if _, err := gw.Confirm(context.Background(), intent.ID); !errors.Is(err, payment.ErrInvalidState) {
+		t.Errorf("confirm after cancel: err = %v, want ErrInvalidState", err)
+	}
+}
+
+func TestAPICancelOrderPaymentInFlight(t *testing.T) {
+	h, orders, gw, intent := newCancelTest(t, models.OrderPending)
+	// покупатель уже заплатил, событие об оплате ещё не дошло
+	if _, err := gw.Confirm(context.Background(), intent.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	w := cancelRequest(h, 1, 7)
+	if w.Code != http.StatusConflict || errorCode(t, w) != "payment_in_progress" {
+		t.Fatalf("status = %d %s, want 409 payment_in_progress", w.Code, w.Body)
+	}
+	if len(orders.transitions) != 0 {
+		t.Errorf("order moved to %v while its payment was in flight", orders.transitions)
+	}
+}
+
+func TestAPICancelOrderRejected(t *testing.T) {
+	h, orders, _, _ := newCancelTest(t, models.OrderPaid)
+
+	if w := cancelRequest(h, 1, 7); w.Code != http.StatusConflict || errorCode(t, w) != "invalid_status" {
+		t.Errorf("paid order: status = %d %s, want 409 invalid_status", w.Code, w.Body)
+	}
+	if w := cancelRequest(h, 2, 7); w.Code != http.StatusNotFound {
+		t.Errorf("someone else's order: status = %d, want 404", w.Code)
+	}
+	if len(orders.transitions) != 0 {
+		t.Errorf("order moved to %v", orders.transitions)
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+	"github.com/aml-709/game-store/internal/storage"
+)
+
+// pricePreviewCookie — дата, на которую администратор смотрит цены магазина (RFC3339).
+const pricePreviewCookie = "price_preview"
+
+const maxPriceNote = 200
+
+// priceContext — контекст, в котором страница считает цены: у администратора в режиме
+// предпросмотра — на выбранную дату (она же возвращается), у остальных — текущие цены.
+func (h *Handler) priceContext(r *http.Request, uid int) (context.Context, time.Time) {
+	c, err := r.Cookie(pricePreviewCookie)
+	if err != nil || !h.getRoleByID(r.Context(), uid).AtLeast(models.RoleAdmin) {
+		return r.Context(), time.Time{}
+	}
+	at, err := time.Parse(time.RFC3339, c.Value)
+	if err != nil {
+		return r.Context(), time.Time{}
+	}
+	return storage.WithPriceTime(r.Context(), at), at
+}
+
+// parsePriceChangeForm читает и валидирует форму изменения цены из admin_prices.html.
+func (h *Handler) parsePriceChangeForm(r *http.Request) (models.PriceChange, []string) {
+	_ = r.ParseForm()
+	f := r.PostForm
+	pc := models.PriceChange{Note: strings.TrimSpace(f.Get("note"))}
+	var errs []string
+
+	id, err := strconv.Atoi(f.Get("game_id"))
+	if err == nil {
+		_, err = h.Games.Get(r.Context(), id, "")
+	}
+	if err != nil {
+		errs = append(errs, "Игра не найдена")
+	}
+	pc.GameID = id
+
+	switch f.Get("kind") {
+	case "percent":
+		v, err := strconv.Atoi(strings.TrimSpace(f.Get("percent")))
+		if err != nil || v < 1 || v > 100 {
+			errs = append(errs, "Процент — целое число от 1 до 100")
+		}
+		pc.Percent = v
+	case "price":
+		cur := money.Currency(f.Get("currency"))
+		price, err := money.Parse(f.Get("price"), cur)
+		if !cur.Valid() || err != nil || price.Minor < 0 {
+			errs = append(errs, "Цена — неотрицательное число в одной из валют магазина")
+		}
+		pc.Price = price
+	default:
+		errs = append(errs, "Выберите новую цену или процент")
+	}
+
+	for _, field := range []struct {
+		name, label string
+		dst         *time.Time
+	}{{"starts_at", "начала", &pc.StartsAt}, {"ends_at", "окончания", &pc.EndsAt}} {
+		t, err := time.ParseInLocation(promotionTimeLayout, strings.TrimSpace(f.Get(field.name)), time.Local)
+		if err != nil {
+			errs = append(errs, "Укажите дату "+field.label)
+		}
+		*field.dst = t
+	}
+	if !pc.EndsAt.After(pc.StartsAt) {
+		errs = append(errs, "Изменение должно заканчиваться позже, чем начинается")
+	}
+	if utf8.RuneCountInString(pc.Note) > maxPriceNote {
+		errs = append(errs, "Заметка не длиннее 200 символов")
+	}
+	return pc, errs
+}
+
+func (h *Handler) renderAdminPrices(w http.ResponseWriter, r *http.Request, status int, form url.Values, errs []string) {
+	uid, _ := h.getCurrentUser(r)
+	_, previewAt := h.priceContext(r, uid)
+	changes, err := h.Prices.List(r.Context())
+	if err != nil {
+		log.Printf("AdminPrices: db error %v", err)
+	}
+	games, err := h.Games.ListAll(r.Context())
+	if err != nil {
+		log.Printf("AdminPrices: games error %v", err)
+	}
+	if form == nil {
+		form = url.Values{"kind": {"percent"}, "currency": {string(money.Default)}}
+	}
+	data := PageData{
+		UserID:    uid,
+		Username:  h.getUsernameByID(r.Context(), uid),
+		Prices:    changes,
+		Games:     games,
+		Form:      form,
+		Errors:    errs,
+		PriceTime: previewAt,
+	}
+	h.renderTemplateStatus(w, status, "admin_prices.html", data)
+}
+
+// AdminPrices — GET /admin/prices: календарь цен (запланированные, идущие и прошедшие изменения)
+// и предпросмотр магазина на дату, POST — добавляет изменение цены.
+func (h *Handler) AdminPrices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.renderAdminPrices(w, r, http.StatusOK, nil, nil)
+		return
+	}
+	pc, errs := h.parsePriceChangeForm(r)
+	if len(errs) > 0 {
+		h.renderAdminPrices(w, r, http.StatusUnprocessableEntity, r.PostForm, errs)
+		return
+	}
+	if err := h.Prices.Create(r.Context(), &pc); err != nil {
+		log.Printf("AdminPrices: insert error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("AdminPrices: price change %d for game %d scheduled (%s)", pc.ID, pc.GameID, pc.Label())
+	http.Redirect(w, r, "/admin/prices", http.StatusSeeOther)
+}
+
+// DeletePriceChange — POST /admin/prices/delete (id): убирает изменение цены из календаря.
+func (h *Handler) DeletePriceChange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/prices", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	err = h.Prices.Delete(r.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("DeletePriceChange: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/prices", http.StatusSeeOther)
+}
+
+// PricePreview — POST /admin/prices/preview (at): показывать администратору каталог, корзину
+// и оформление с ценами на дату at; пустое at — выйти из предпросмотра.
+func (h *Handler) PricePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/prices", http.StatusSeeOther)
+		return
+	}
+	v := strings.TrimSpace(r.FormValue("at"))
+	if v == "" {
+		http.SetCookie(w, &http.Cookie{Name: pricePreviewCookie, Value: "", Path: "/", MaxAge: -1})
+		http.Redirect(w, r, "/admin/prices", http.StatusSeeOther)
+		return
+	}
+	at, err := time.ParseInLocation(promotionTimeLayout, v, time.Local)
+	if err != nil {
+		h.renderAdminPrices(w, r, http.StatusUnprocessableEntity, nil, []string{"Неверная дата предпросмотра"})
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     pricePreviewCookie,
+		Value:    at.UTC().Format(time.RFC3339),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
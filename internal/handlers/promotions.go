@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+	"github.com/aml-709/game-store/internal/storage"
+)
+
+// promotionTimeLayout — формат полей datetime-local в форме скидки (местное время сервера).
+const promotionTimeLayout = "2006-01-02T15:04"
+
+// couponMessage — что сказать покупателю, если купон или скидка не применились; для прочих ошибок — "".
+func couponMessage(err error) string {
+	switch {
+	case errors.Is(err, storage.ErrCouponNotFound):
+		return "Купон не найден или сейчас не действует"
+	case errors.Is(err, storage.ErrCouponNotApplicable):
+		return "Купон не подходит к играм в корзине или к вашей валюте"
+	case errors.Is(err, storage.ErrPromotionUsedUp):
+		return "Лимит использований скидки исчерпан"
+	}
+	return ""
+}
+
+// apiCouponError отвечает ошибкой купона, если err — она; иначе ничего не пишет и возвращает false.
+func apiCouponError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, storage.ErrCouponNotFound):
+		apiFail(w, http.StatusUnprocessableEntity, "coupon_not_found", "coupon does not exist or is not active")
+	case errors.Is(err, storage.ErrCouponNotApplicable):
+		apiFail(w, http.StatusUnprocessableEntity, "coupon_not_applicable", "coupon does not apply to the cart")
+	case errors.Is(err, storage.ErrPromotionUsedUp):
+		apiFail(w, http.StatusConflict, "promotion_used_up", "promotion usage limit reached")
+	default:
+		return false
+	}
+	return true
+}
+
+// parsePromotionForm читает и валидирует форму скидки из admin_promotions.html.
+func (h *Handler) parsePromotionForm(r *http.Request) (models.Promotion, []string) {
+	_ = r.ParseForm()
+	f := r.PostForm
+	p := models.Promotion{
+		Name:   strings.TrimSpace(f.Get("name")),
+		Code:   strings.TrimSpace(f.Get("code")),
+		Kind:   models.PromotionKind(f.Get("kind")),
+		Active: f.Get("active") == "1",
+	}
+	var errs []string
+	if p.Name == "" {
+		errs = append(errs, "Название обязательно")
+	} else if utf8.RuneCountInString(p.Name) > maxTitleLen {
+		errs = append(errs, "Название не длиннее 200 символов")
+	}
+	if utf8.RuneCountInString(p.Code) > models.MaxCouponCode || strings.ContainsAny(p.Code, " \t") {
+		errs = append(errs, "Код купона — до 64 символов без пробелов")
+	}
+
+	switch p.Kind {
+	case models.PromotionPercent:
+		v, err := strconv.Atoi(strings.TrimSpace(f.Get("percent")))
+		if err != nil || v < 1 || v > 100 {
+			errs = append(errs, "Процент — целое число от 1 до 100")
+		}
+		p.Percent = v
+	case models.PromotionFixed:
+		cur := money.Currency(f.Get("currency"))
+		amount, err := money.Parse(f.Get("amount"), cur)
+		if !cur.Valid() || err != nil || amount.Minor <= 0 {
+			errs = append(errs, "Сумма скидки — положительное число в одной из валют магазина")
+		}
+		p.Amount = amount
+	default:
+		errs = append(errs, "Выберите вид скидки")
+	}
+
+	if v := f.Get("game_id"); v != "" && v != "0" {
+		id, err := strconv.Atoi(v)
+		if err == nil {
+			_, err = h.Games.Get(r.Context(), id, "")
+		}
+		if err != nil {
+			errs = append(errs, "Игра не найдена")
+		}
+		p.GameID = id
+	}
+
+	for _, field := range []struct {
+		name, label string
+		dst         *time.Time
+	}{{"starts_at", "начала", &p.StartsAt}, {"ends_at", "окончания", &p.EndsAt}} {
+		v := strings.TrimSpace(f.Get(field.name))
+		if v == "" {
+			continue
+		}
+		t, err := time.ParseInLocation(promotionTimeLayout, v, time.Local)
+		if err != nil {
+			errs = append(errs, "Неверная дата "+field.label)
+		}
+		*field.dst = t
+	}
+	if !p.EndsAt.IsZero() && !p.EndsAt.After(p.StartsAt) {
+		errs = append(errs, "Скидка должна заканчиваться позже, чем начинается")
+	}
+
+	for _, field := range []struct {
+		name string
+		dst  *int
+	}{{"max_uses", &p.MaxUses}, {"max_uses_per_customer", &p.MaxUsesPerCustomer}} {
+		v := strings.TrimSpace(f.Get(field.name))
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			errs = append(errs, "Лимиты использований — неотрицательные целые числа (0 — без ограничений)")
+			break
+		}
+		*field.dst = n
+	}
+	return p, errs
+}
+
+func (h *Handler) renderAdminPromotions(w http.ResponseWriter, r *http.Request, status int, form url.Values, errs []string) {
+	uid, _ := h.getCurrentUser(r)
+	promos, err := h.Promotions.List(r.Context())
+	if err != nil {
+		log.Printf("AdminPromotions: db error %v", err)
+	}
+	games, err := h.Games.ListAll(r.Context())
+	if err != nil {
+		log.Printf("AdminPromotions: games error %v", err)
+	}
+	if form == nil {
+		form = url.Values{"active": {"1"}, "kind": {string(models.PromotionPercent)}}
+	}
+	data := PageData{
+		UserID:     uid,
+		Username:   h.getUsernameByID(r.Context(), uid),
+		Promotions: promos,
+		Games:      games,
+		Form:       form,
+		Errors:     errs,
+	}
+	h.renderTemplateStatus(w, status, "admin_promotions.html", data)
+}
+
+// AdminPromotions — GET /admin/promotions: распродажи и купоны с числом использований,
+// POST — создаёт скидку.
+func (h *Handler) AdminPromotions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.renderAdminPromotions(w, r, http.StatusOK, nil, nil)
+		return
+	}
+	p, errs := h.parsePromotionForm(r)
+	if len(errs) > 0 {
+		h.renderAdminPromotions(w, r, http.StatusUnprocessableEntity, r.PostForm, errs)
+		return
+	}
+	err := h.Promotions.Create(r.Context(), &p)
+	if errors.Is(err, storage.ErrCouponCodeTaken) {
+		h.renderAdminPromotions(w, r, http.StatusConflict, r.PostForm, []string{"Купон с кодом «" + p.Code + "» уже есть"})
+		return
+	}
+	if err != nil {
+		log.Printf("AdminPromotions: insert error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("AdminPromotions: promotion %d %q created", p.ID, p.Name)
+	http.Redirect(w, r, "/admin/promotions", http.StatusSeeOther)
+}
+
+// SetPromotionActive — POST /admin/promotions/active (id, active=0|1): выключает или снова включает скидку.
+func (h *Handler) SetPromotionActive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/promotions", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	err = h.Promotions.SetActive(r.Context(), id, r.FormValue("active") == "1")
+	if errors.Is(err, storage.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("SetPromotionActive: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/promotions", http.StatusSeeOther)
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/storage"
+)
+
+// DefaultRefundWindow — сколько после оплаты можно попросить возврат, если Handler.RefundWindow не задан.
+const DefaultRefundWindow = 14 * 24 * time.Hour
+
+const maxRefundReason = 1000
+
+func (h *Handler) refundWindow() time.Duration {
+	if h.RefundWindow > 0 {
+		return h.RefundWindow
+	}
+	return DefaultRefundWindow
+}
+
+// refundable — можно ли ещё попросить возврат по заказу (оплачен и срок не вышел).
+func (h *Handler) refundable(o models.Order, now time.Time) bool {
+	return o.Status == models.OrderPaid && now.Before(o.PaidAt().Add(h.refundWindow()))
+}
+
+// orderView — заказ в истории покупок вместе с тем, что с ним можно сделать.
+type orderView struct {
+	models.Order
+	Refundable bool
+}
+
+// refundPageData — страница заявки на возврат по заказу.
+func (h *Handler) refundPageData(r *http.Request, uid int, order models.Order, errs []string) PageData {
+	return PageData{
+		UserID:     uid,
+		Username:   h.getUsernameByID(r.Context(), uid),
+		PurchaseID: order.ID,
+		Order:      order,
+		Form:       r.PostForm,
+		Errors:     errs,
+	}
+}
+
+// RequestRefund — GET/POST /purchases/refund: покупатель выбирает позиции оплаченного заказа
+// и просит вернуть деньги; решение принимает администратор.
+func (h *Handler) RequestRefund(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	pid, err := strconv.Atoi(r.FormValue("purchase_id"))
+	if err != nil {
+		http.Redirect(w, r, "/purchases", http.StatusSeeOther)
+		return
+	}
+	order, err := h.Orders.Get(r.Context(), pid)
+	if err != nil || order.UserID != uid || !h.refundable(order, time.Now()) {
+		http.Redirect(w, r, "/purchases", http.StatusSeeOther)
+		return
+	}
+	if r.Method != http.MethodPost {
+		h.renderTemplate(w, "refund.html", h.refundPageData(r, uid, order, nil))
+		return
+	}
+
+	var itemIDs []int
+	for _, v := range r.PostForm["item"] {
+		if id, err := strconv.Atoi(v); err == nil {
+			itemIDs = append(itemIDs, id)
+		}
+	}
+	reason := strings.TrimSpace(r.PostFormValue("reason"))
+	var errs []string
+	if len(itemIDs) == 0 {
+		errs = append(errs, "Выберите, что вернуть")
+	}
+	if utf8.RuneCountInString(reason) > maxRefundReason {
+		errs = append(errs, fmt.Sprintf("Причина — не больше %d символов", maxRefundReason))
+	}
+	if len(errs) > 0 {
+		h.renderTemplateStatus(w, http.StatusUnprocessableEntity, "refund.html", h.refundPageData(r, uid, order, errs))
+		return
+	}
+
+	rf := models.Refund{OrderID: order.ID, UserID: uid, Reason: reason}
+	err = h.Refunds.Create(r.Context(), &rf, itemIDs)
+	switch {
+	case err == nil:
+		log.Printf("RequestRefund: refund %d requested for order %d (%s)", rf.ID, order.ID, rf.Amount)
+		http.Redirect(w, r, "/purchases", http.StatusSeeOther)
+	case errors.Is(err, storage.ErrAlreadyRefunded), errors.Is(err, storage.ErrNotFound):
+		order, _ = h.Orders.Get(r.Context(), pid)
+		h.renderTemplateStatus(w, http.StatusConflict, "refund.html",
+			h.refundPageData(r, uid, order, []string{"Часть позиций уже возвращена или ждёт решения"}))
+	case errors.Is(err, storage.ErrInvalidTransition):
+		http.Redirect(w, r, "/purchases", http.StatusSeeOther)
+	default:
+		log.Printf("RequestRefund: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) renderAdminRefunds(w http.ResponseWriter, r *http.Request, status int, errs []string) {
+	uid, _ := h.getCurrentUser(r)
+	filter := models.RefundStatus(r.URL.Query().Get("status"))
+	if r.URL.Query().Get("status") == "" {
+		filter = models.RefundPending
+	} else if filter == "all" {
+		filter = ""
+	}
+	refunds, err := h.Refunds.List(r.Context(), filter)
+	if err != nil {
+		log.Printf("AdminRefunds: db error %v", err)
+	}
+	data := PageData{
+		UserID:   uid,
+		Username: h.getUsernameByID(r.Context(), uid),
+		Refunds:  refunds,
+		Form:     string(filter), // текущий фильтр
+		Errors:   errs,
+	}
+	h.renderTemplateStatus(w, status, "admin_refunds.html", data)
+}
+
+// AdminRefunds — GET /admin/refunds: заявки на возврат (по умолчанию — ожидающие, ?status=all — все).
+func (h *Handler) AdminRefunds(w http.ResponseWriter, r *http.Request) {
+	h.renderAdminRefunds(w, r, http.StatusOK, nil)
+}
+
+// DecideRefund — POST /admin/refunds/decide: одобрить (action=approve) или отклонить (action=deny) заявку.
+// Одобрение сначала занимает заявку в базе, затем возвращает деньги у провайдера и только потом
+// фиксирует заявку и забирает игры из библиотеки: два одобрения одной заявки не вернут деньги дважды.
+// Возврат у провайдера запоминается до одобрения, поэтому сорвавшееся одобрение можно повторить.
+func (h *Handler) DecideRefund(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/refunds", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	note := strings.TrimSpace(r.FormValue("note"))
+	rf, err := h.Refunds.Get(r.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("DecideRefund: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "deny":
+		err = h.Refunds.Deny(r.Context(), id, uid, note)
+		if errors.Is(err, storage.ErrInvalidTransition) {
+			err = nil // заявку уже решили или одобряют прямо сейчас
+		}
+	case "approve":
+		// заявка «проводится» с сохранённым возвратом — деньги уже вернули, а одобрение
+		// не записалось: повтор только завершает его, второй раз провайдер не возвращает
+		resume := rf.Status == models.RefundProcessing && rf.ProviderRefundID != ""
+		paymentID, providerRefundID := rf.PaymentID, rf.ProviderRefundID
+		if !resume {
+			err = h.Refunds.Claim(r.Context(), id)
+			if errors.Is(err, storage.ErrInvalidTransition) {
+				http.Redirect(w, r, "/admin/refunds", http.StatusSeeOther)
+				return
+			}
+			if err != nil {
+				break
+			}
+			paymentID, providerRefundID, err = h.refundPayment(r, rf)
+			if err != nil {
+				log.Printf("DecideRefund: provider refund for refund %d failed: %v", id, err)
+				if err := h.Refunds.Release(r.Context(), id); err != nil {
+					log.Printf("DecideRefund: release refund %d: %v", id, err)
+				}
+				h.renderAdminRefunds(w, r, http.StatusBadGateway, []string{fmt.Sprintf("Возврат #%d не проведён у платёжного провайдера: %v", id, err)})
+				return
+			}
+			if providerRefundID != "" {
+				if err := h.Refunds.Issued(r.Context(), id, paymentID, providerRefundID); err != nil {
+					log.Printf("DecideRefund: save provider refund %s for refund %d: %v", providerRefundID, id, err)
+				}
+			}
+		}
+		err = h.Refunds.Approve(r.Context(), id, uid, note, paymentID, providerRefundID)
+		switch {
+		case err != nil && providerRefundID != "":
+			// деньги уже вернули: заявка остаётся «проводится» с возвратом, одобрение можно повторить
+			log.Printf("DecideRefund: refund %d issued at provider as %s but not approved: %v", id, providerRefundID, err)
+			h.renderAdminRefunds(w, r, http.StatusInternalServerError, []string{fmt.Sprintf("Деньги по возврату #%d возвращены, но заявка не одобрена — повторите одобрение", id)})
+			return
+		case err != nil:
+			if err := h.Refunds.Release(r.Context(), id); err != nil {
+				log.Printf("DecideRefund: release refund %d: %v", id, err)
+			}
+		}
+	default:
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("DecideRefund: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/refunds", http.StatusSeeOther)
+}
+
+// refundPayment возвращает сумму заявки по успешному платежу заказа; более поздние попытки
+// (ожидающие или возвращённые автоматически) не в счёт. У старых заказов, оплаченных до
+// появления платежей, платежа нет — тогда возвращать через провайдера нечего.
+func (h *Handler) refundPayment(r *http.Request, rf models.Refund) (paymentID int, providerRefundID string, err error) {
+	p, err := h.Payments.Succeeded(r.Context(), rf.OrderID)
+	if errors.Is(err, storage.ErrNotFound) {
+		latest, err := h.Payments.LatestForOrder(r.Context(), rf.OrderID)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			return 0, "", nil
+		case err != nil:
+			return 0, "", err
+		}
+		// платежи есть, но успешного нет — например, деньги уже вернули у провайдера
+		return 0, "", fmt.Errorf("order %d has no succeeded payment (latest %d is %s)", rf.OrderID, latest.ID, latest.Status)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	if p.Provider != h.Gateway.Name() {
+		return 0, "", fmt.Errorf("payment %d was made at %s", p.ID, p.Provider)
+	}
+	if rf.Amount.Minor == 0 {
+		return p.ID, "", nil // бесплатные позиции: возвращать нечего
+	}
+	refund, err := h.Gateway.Refund(r.Context(), p.IntentID, rf.Amount)
+	if err != nil {
+		return 0, "", err
+	}
+	return p.ID, refund.ID, nil
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+const (
+	searchPageLimit = 50
+	searchAPIMax    = 100
+)
+
+// searchResult — найденная игра с подсвеченными совпадениями.
+type searchResult struct {
+	models.Game
+	TitleHTML   template.HTML `json:"title_html"`
+	SnippetHTML template.HTML `json:"snippet_html"`
+}
+
+// markHighlights экранирует текст и превращает маркеры совпадений в <mark>.
+func markHighlights(s string) template.HTML {
+	s = html.EscapeString(s)
+	if strings.Count(s, models.HighlightStart) != strings.Count(s, models.HighlightEnd) {
+		// маркеры не парные — в самом тексте оказались управляющие символы; подсветку не показываем
+		return template.HTML(strings.NewReplacer(models.HighlightStart, "", models.HighlightEnd, "").Replace(s))
+	}
+	return template.HTML(strings.NewReplacer(models.HighlightStart, "<mark>", models.HighlightEnd, "</mark>").Replace(s))
+}
+
+func toSearchResults(hits []models.SearchHit) []searchResult {
+	out := make([]searchResult, 0, len(hits))
+	for _, h := range hits {
+		out = append(out, searchResult{
+			Game:        h.Game,
+			TitleHTML:   markHighlights(h.TitleHighlight),
+			SnippetHTML: markHighlights(h.Snippet),
+		})
+	}
+	return out
+}
+
+// Search — страница поиска по каталогу (GET /search?q=...)
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	cur, _ := h.catalogCurrency(r, uid)
+	hits, err := h.Games.Search(r.Context(), q, cur, searchPageLimit)
+	if err != nil {
+		log.Printf("Search: db error for q=%q: %v", q, err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	data := PageData{
+		UserID:   uid,
+		Username: h.getUsernameByID(r.Context(), uid),
+		Games:    toSearchResults(hits),
+		Query:    q,
+	}
+	h.renderTemplate(w, "search.html", data)
+}
+
+// APISearch — GET /api/v1/search?q=...&limit=N
+func (h *Handler) APISearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		apiFail(w, http.StatusBadRequest, "bad_request", "q is required")
+		return
+	}
+	limit := searchPageLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > searchAPIMax {
+			apiFail(w, http.StatusBadRequest, "bad_request", "limit must be between 1 and "+strconv.Itoa(searchAPIMax))
+			return
+		}
+		limit = n
+	}
+	cur, ok := h.apiCurrency(w, r)
+	if !ok {
+		return
+	}
+	hits, err := h.Games.Search(r.Context(), q, cur, limit)
+	if err != nil {
+		apiInternal(w, "APISearch", err)
+		return
+	}
+	apiData(w, http.StatusOK, toSearchResults(hits))
+}
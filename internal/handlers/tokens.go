@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aml-709/game-store/internal/auth"
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/session"
+	"github.com/aml-709/game-store/internal/storage"
+)
+
+// errInvalidToken — передан заголовок Authorization, но токен неверный или отозван.
+// В отличие от отсутствия сессии, это не повод молча пускать анонимом.
+var errInvalidToken = errors.New("handlers: invalid access token")
+
+// tokenTouchInterval — как часто обновлять last_used_at, чтобы не писать в базу на каждый запрос.
+const tokenTouchInterval = time.Minute
+
+// principal — от чьего имени выполняется запрос: cookie-сессия или персональный токен.
+type principal struct {
+	UserID  int
+	Session *session.Session // nil при входе по токену
+	Token   *models.APIToken // nil при входе по сессии
+}
+
+// allows сообщает, можно ли principal на маршрут с правами scopes. Сессии можно всё;
+// токену — только если выданы все права, а маршруты без прав (аккаунт, админка) — только сессии.
+func (p *principal) allows(scopes []models.Scope) bool {
+	if p.Token == nil {
+		return true
+	}
+	if len(scopes) == 0 {
+		return false
+	}
+	for _, s := range scopes {
+		if !p.Token.HasScope(s) {
+			return false
+		}
+	}
+	return true
+}
+
+func withPrincipal(r *http.Request, p *principal) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalCtxKey, p))
+}
+
+// currentPrincipal возвращает principal из контекста (если его уже положил middleware),
+// иначе проверяет "Authorization: Bearer" и затем cookie сессии.
+func (h *Handler) currentPrincipal(r *http.Request) (*principal, error) {
+	if p, ok := r.Context().Value(principalCtxKey).(*principal); ok {
+		return p, nil
+	}
+	if header := r.Header.Get("Authorization"); header != "" {
+		return h.tokenPrincipal(r.Context(), header)
+	}
+	c, err := r.Cookie(session.CookieName)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := h.Sessions.Get(c.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &principal{UserID: sess.UserID, Session: sess}, nil
+}
+
+func (h *Handler) tokenPrincipal(ctx context.Context, header string) (*principal, error) {
+	raw, ok := auth.BearerToken(header)
+	if !ok || h.Tokens == nil {
+		return nil, errInvalidToken
+	}
+	t, err := h.Tokens.GetActiveByHash(ctx, auth.HashAccessToken(raw))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, errInvalidToken
+	}
+	if err != nil {
+		log.Printf("tokenPrincipal: db error %v", err)
+		return nil, err
+	}
+	if now := time.Now(); now.Sub(t.LastUsedAt) > tokenTouchInterval {
+		if err := h.Tokens.Touch(ctx, t.ID, now); err != nil {
+			log.Printf("tokenPrincipal: touch token %d error %v", t.ID, err)
+		}
+	}
+	return &principal{UserID: t.UserID, Token: &t}, nil
+}
+
+// renderAccount показывает страницу аккаунта: покупки, рекомендации, валюту и токены доступа.
+func (h *Handler) renderAccount(w http.ResponseWriter, r *http.Request, status int, uid int, newToken string, errs []string) {
+	purchases, err := h.Orders.ListByUser(r.Context(), uid)
+	if err != nil {
+		log.Printf("Account: purchases query error: %v", err)
+	}
+
+	cur := h.preferredCurrency(r.Context(), uid)
+	recs, err := h.Games.Latest(r.Context(), cur, 6)
+	if err != nil {
+		log.Printf("Account: recommended query error: %v", err)
+	}
+
+	tokens, err := h.Tokens.ListByUser(r.Context(), uid)
+	if err != nil {
+		log.Printf("Account: tokens query error: %v", err)
+	}
+
+	var email string
+	if c, err := h.Customers.Get(r.Context(), uid); err == nil {
+		email = c.Email
+	} else {
+		log.Printf("Account: customer query error: %v", err)
+	}
+
+	data := PageData{
+		UserID:      uid,
+		Username:    h.getUsernameByID(r.Context(), uid),
+		Purchases:   purchases,
+		Recommended: recs,
+		Tokens:      tokens,
+		NewToken:    newToken,
+		Form:        r.PostForm,
+		Errors:      errs,
+		Currency:    cur,
+		Email:       email,
+	}
+	h.renderTemplateStatus(w, status, "account.html", data)
+}
+
+// CreateToken — выпуск персонального токена (POST name, scope[]). Токен показывается один раз.
+func (h *Handler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	uid, err := h.getCurrentUser(r)
+	if err != nil || uid == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	t := models.APIToken{UserID: uid, Name: strings.TrimSpace(r.PostForm.Get("name"))}
+	var errs []string
+	switch n := utf8.RuneCountInString(t.Name); {
+	case n == 0:
+		errs = append(errs, "Укажите название токена")
+	case n > 100:
+		errs = append(errs, "Название токена длиннее 100 символов")
+	}
+	for _, v := range r.PostForm["scope"] {
+		s := models.Scope(v)
+		if !s.Valid() {
+			errs = append(errs, "Неизвестное право: "+v)
+			continue
+		}
+		if !t.HasScope(s) {
+			t.Scopes = append(t.Scopes, s)
+		}
+	}
+	if len(t.Scopes) == 0 {
+		errs = append(errs, "Выберите хотя бы одно право")
+	}
+	if len(errs) > 0 {
+		h.renderAccount(w, r, http.StatusUnprocessableEntity, uid, "", errs)
+		return
+	}
+
+	raw, hash, err := auth.NewAccessToken()
+	if err != nil {
+		log.Printf("CreateToken: generate error %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Tokens.Create(r.Context(), &t, hash); err != nil {
+		log.Printf("CreateToken: insert error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("CreateToken: user %d created token %d", uid, t.ID)
+	r.PostForm = nil // форму после успеха не показываем заново
+	h.renderAccount(w, r, http.StatusOK, uid, raw, nil)
+}
+
+// RevokeToken — отзыв своего токена (POST token_id).
+func (h *Handler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	uid, err := h.getCurrentUser(r)
+	if err != nil || uid == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("token_id"))
+	if err != nil {
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+	if err := h.Tokens.Revoke(r.Context(), uid, id); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("RevokeToken: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aml-709/game-store/internal/storage"
+)
+
+// recentNotifications — сколько последних уведомлений показывает страница списка желаемого.
+const recentNotifications = 50
+
+// wishlisted — игры из списка желаемого покупателя для кнопок каталога; для анонима — nil.
+func (h *Handler) wishlisted(ctx context.Context, uid int) map[int]bool {
+	if uid == 0 || h.Wishlists == nil {
+		return nil
+	}
+	ids, err := h.Wishlists.GameIDs(ctx, uid)
+	if err != nil {
+		log.Printf("wishlisted: db error %v", err)
+	}
+	return ids
+}
+
+// backTo — страница, с которой пришла форма (только этот же сайт), иначе fallback:
+// из каталога кнопка «В желаемое» возвращает в каталог с теми же фильтрами.
+func backTo(r *http.Request, fallback string) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil || u.Host != r.Host || !strings.HasPrefix(u.Path, "/") {
+		return fallback
+	}
+	return u.RequestURI()
+}
+
+// Wishlist — GET /wishlist: список желаемого с текущими ценами и уведомления о снижении цен.
+// Открытая страница отмечает уведомления прочитанными.
+func (h *Handler) Wishlist(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	cur := h.preferredCurrency(r.Context(), uid)
+	ctx, previewAt := h.priceContext(r, uid)
+
+	items, err := h.Wishlists.List(ctx, uid, cur)
+	if err != nil {
+		log.Printf("Wishlist: db error %v", err)
+	}
+	notes, err := h.Wishlists.Notifications(r.Context(), uid, recentNotifications)
+	if err != nil {
+		log.Printf("Wishlist: notifications query error %v", err)
+	}
+	if err := h.Wishlists.MarkRead(r.Context(), uid); err != nil {
+		log.Printf("Wishlist: mark read error %v", err)
+	}
+
+	data := PageData{
+		UserID:        uid,
+		Username:      h.getUsernameByID(r.Context(), uid),
+		Games:         items,
+		Notifications: notes,
+		Currency:      cur,
+		PriceTime:     previewAt,
+	}
+	h.renderTemplate(w, "wishlist.html", data)
+}
+
+// AddToWishlist — POST /wishlist/add (id): кладёт опубликованную игру в список желаемого.
+func (h *Handler) AddToWishlist(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/wishlist", http.StatusSeeOther)
+		return
+	}
+	gameID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	g, err := h.Games.Get(r.Context(), gameID, "")
+	if err != nil || !g.Published {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if err := h.Wishlists.Add(r.Context(), uid, gameID); err != nil {
+		log.Printf("AddToWishlist: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, backTo(r, "/wishlist"), http.StatusSeeOther)
+}
+
+// RemoveFromWishlist — POST /wishlist/remove (id): убирает игру из списка желаемого.
+func (h *Handler) RemoveFromWishlist(w http.ResponseWriter, r *http.Request) {
+	uid, _ := h.getCurrentUser(r)
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/wishlist", http.StatusSeeOther)
+		return
+	}
+	gameID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Redirect(w, r, "/wishlist", http.StatusSeeOther)
+		return
+	}
+	if err := h.Wishlists.Remove(r.Context(), uid, gameID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("RemoveFromWishlist: db error %v", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, backTo(r, "/wishlist"), http.StatusSeeOther)
+}
@@ -0,0 +1,104 @@
+package migrations
+
+import (
+	"database/sql"
+	"log"
+)
+
+// legacyColumns — колонки, которые InitDB и ensureSchema в разное время добавляли
+// к таблицам. В старой базе могло не оказаться любой из них.
+var legacyColumns = []struct {
+	table, column, decl string
+}{
+	{"games", "published", "INTEGER NOT NULL DEFAULT 1"},
+	{"customers", "role", "TEXT NOT NULL DEFAULT 'customer'"},
+	{"purchases", "user_id", "INTEGER"},
+	{"purchases", "total", "REAL"},
+	{"purchases", "created_at", "DATETIME"},
+	{"purchases", "paid", "INTEGER DEFAULT 0"},
+	{"purchase_items", "purchase_id", "INTEGER"},
+	{"purchase_items", "game_id", "INTEGER"},
+	{"purchase_items", "price", "REAL"},
+	{"purchase_items", "quantity", "INTEGER DEFAULT 1"},
+	{"cart_items", "user_id", "INTEGER"},
+	{"cart_items", "game_id", "INTEGER"},
+	{"cart_items", "quantity", "INTEGER DEFAULT 1"},
+	{"comments", "game_id", "INTEGER"},
+	{"comments", "user_id", "INTEGER"},
+	{"comments", "rating", "INTEGER"},
+	{"comments", "text", "TEXT"},
+	{"comments", "created_at", "DATETIME"},
+	{"user_games", "user_id", "INTEGER"},
+	{"user_games", "game_id", "INTEGER"},
+}
+
+// adoptLegacy приводит базу, созданную до появления миграций, к виду,
+// на который рассчитаны 0001_baseline и 0002_resolve_drift: добавляет недостающие
+// колонки и переносит данные из колонок InitDB (customer_id, purchase_date).
+func adoptLegacy(db *sql.DB) error {
+	log.Printf("migrations: adopting legacy schema")
+	for _, c := range legacyColumns {
+		exists, err := tableExists(db, c.table)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue // таблицу создаст 0001_baseline
+		}
+		if err := addColumnIfMissing(db, c.table, c.column, c.decl); err != nil {
+			return err
+		}
+	}
+
+	if ok, err := hasColumn(db, "purchases", "customer_id"); err != nil {
+		return err
+	} else if ok {
+		if _, err := db.Exec("UPDATE purchases SET user_id = customer_id WHERE user_id IS NULL"); err != nil {
+			return err
+		}
+	}
+	if ok, err := hasColumn(db, "purchases", "purchase_date"); err != nil {
+		return err
+	} else if ok {
+		if _, err := db.Exec("UPDATE purchases SET created_at = purchase_date WHERE created_at IS NULL"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tableExists(db *sql.DB, name string) (bool, error) {
+	var cnt int
+	err := db.QueryRow("SELECT count(name) FROM sqlite_master WHERE type='table' AND name = ?", name).Scan(&cnt)
+	return cnt > 0, err
+}
+
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, ctype string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+func addColumnIfMissing(db *sql.DB, table, column, decl string) error {
+	ok, err := hasColumn(db, table, column)
+	if err != nil || ok {
+		return err
+	}
+	log.Printf("migrations: adding legacy column %s.%s", table, column)
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + decl)
+	return err
+}
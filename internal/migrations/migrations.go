@@ -0,0 +1,236 @@
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// Migration — одна пронумерованная миграция: NNNN_name.up.sql / NNNN_name.down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status — состояние миграции в конкретной базе.
+type Status struct {
+	Migration
+	AppliedAt string // пусто, если не применена
+}
+
+// Load читает встроенные миграции, отсортированные по версии.
+func Load() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migrations: unexpected file %s", name)
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		num, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migrations: bad file name %s", name)
+		}
+		version, err := strconv.Atoi(num)
+		if err != nil {
+			return nil, fmt.Errorf("migrations: bad version in %s: %w", name, err)
+		}
+		body, err := files.ReadFile(path.Join("sql", name))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migrations: version %d used by %s and %s", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrations: %04d_%s needs both up and down files", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+func ensureTable(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	);`)
+	return err
+}
+
+func applied(db *sql.DB) (map[int]string, error) {
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int]string{}
+	for rows.Next() {
+		var v int
+		var at string
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		out[v] = at
+	}
+	return out, rows.Err()
+}
+
+// prepare создаёт schema_migrations; для базы, созданной до миграций, сначала адаптирует её.
+func prepare(db *sql.DB) error {
+	tracked, err := tableExists(db, "schema_migrations")
+	if err != nil {
+		return err
+	}
+	if !tracked {
+		legacy, err := tableExists(db, "games")
+		if err != nil {
+			return err
+		}
+		if legacy {
+			if err := adoptLegacy(db); err != nil {
+				return fmt.Errorf("migrations: adopt legacy schema: %w", err)
+			}
+		}
+	}
+	return ensureTable(db)
+}
+
+// Up применяет все ещё не применённые миграции и возвращает их версии.
+func Up(db *sql.DB) ([]int, error) {
+	all, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	if err := prepare(db); err != nil {
+		return nil, err
+	}
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	var versions []int
+	for _, m := range all {
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+		if err := run(db, m.Up, func(tx *sql.Tx) error {
+			_, err := tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				m.Version, m.Name, time.Now().UTC().Format(time.RFC3339))
+			return err
+		}); err != nil {
+			return versions, fmt.Errorf("migrations: up %04d_%s: %w", m.Version, m.Name, err)
+		}
+		log.Printf("migrations: applied %04d_%s", m.Version, m.Name)
+		versions = append(versions, m.Version)
+	}
+	return versions, nil
+}
+
+// Down откатывает steps последних применённых миграций.
+func Down(db *sql.DB, steps int) ([]int, error) {
+	all, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	if err := prepare(db); err != nil {
+		return nil, err
+	}
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	var versions []int
+	for i := len(all) - 1; i >= 0 && len(versions) < steps; i-- {
+		m := all[i]
+		if _, ok := done[m.Version]; !ok {
+			continue
+		}
+		if err := run(db, m.Down, func(tx *sql.Tx) error {
+			_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+			return err
+		}); err != nil {
+			return versions, fmt.Errorf("migrations: down %04d_%s: %w", m.Version, m.Name, err)
+		}
+		log.Printf("migrations: reverted %04d_%s", m.Version, m.Name)
+		versions = append(versions, m.Version)
+	}
+	return versions, nil
+}
+
+// List возвращает все миграции с отметкой, применены ли они.
+func List(db *sql.DB) ([]Status, error) {
+	all, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	// status ничего не меняет в базе: без schema_migrations все миграции считаются ожидающими
+	done := map[int]string{}
+	if ok, err := tableExists(db, "schema_migrations"); err != nil {
+		return nil, err
+	} else if ok {
+		if done, err = applied(db); err != nil {
+			return nil, err
+		}
+	}
+	out := make([]Status, 0, len(all))
+	for _, m := range all {
+		out = append(out, Status{Migration: m, AppliedAt: done[m.Version]})
+	}
+	return out, nil
+}
+
+// run выполняет SQL миграции и запись в schema_migrations в одной транзакции.
+func run(db *sql.DB, script string, record func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(script); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
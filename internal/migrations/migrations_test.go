@@ -0,0 +1,158 @@
+package migrations
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "games.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// downTo откатывает полностью применённую базу до состояния перед миграцией version.
+func downTo(t *testing.T, db *sql.DB, version int) {
+	t.Helper()
+	all, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := 0
+	for _, m := range all {
+		if m.Version >= version {
+			steps++
+		}
+	}
+	if _, err := Down(db, steps); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpDownUp(t *testing.T) {
+	db := openTestDB(t)
+	all, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up, err := Up(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(up) != len(all) {
+		t.Fatalf("applied %d migrations, want %d", len(up), len(all))
+	}
+	if again, err := Up(db); err != nil || len(again) != 0 {
+		t.Fatalf("second Up = %v, %v; want nothing to apply", again, err)
+	}
+
+	down, err := Down(db, len(all))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(down) != len(all) {
+		t.Fatalf("reverted %d migrations, want %d", len(down), len(all))
+	}
+	if _, err := Up(db); err != nil {
+		t.Fatalf("Up after full Down: %v", err)
+	}
+}
+
+// Копии в подарок без получателя, оплаченные до 0020_gift_keys, получают по ключу на копию.
+func TestGiftKeysBackfill(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := Up(db); err != nil {
+		t.Fatal(err)
+	}
+	downTo(t, db, 20)
+	_, err := db.Exec(`
+        INSERT INTO customers (id, username, password) VALUES (1, 'eve', 'x'), (2, 'bob', 'x');
+        INSERT INTO games (id, title, price_minor) VALUES (1, 'Doom', 1999);
+        INSERT INTO purchases (id, user_id, status) VALUES (1, 1, 'paid'), (2, 1, 'pending');
+        INSERT INTO purchase_items (id, purchase_id, game_id, quantity, gift) VALUES
+            (1, 1, 1, 3, 1), -- оплаченные копии без получателя
+            (2, 1, 1, 1, 1), -- подарок с получателем
+            (3, 1, 1, 1, 0), -- личная копия
+            (4, 2, 1, 2, 1); -- неоплаченный заказ
+        INSERT INTO gifts (purchase_item_id, purchase_id, sender_id, recipient_id, game_id, created_at)
+            VALUES (2, 1, 1, 2, 1, '2026-01-01T00:00:00Z');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Up(db); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("SELECT purchase_item_id, COUNT(*), COUNT(DISTINCT code) FROM activation_keys GROUP BY purchase_item_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	got := map[int]int{}
+	for rows.Next() {
+		var item, n, distinct int
+		if err := rows.Scan(&item, &n, &distinct); err != nil {
+			t.Fatal(err)
+		}
+		if distinct != n {
+			t.Errorf("item %d: %d keys share codes", item, n-distinct)
+		}
+		got[item] = n
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[1] != 3 {
+		t.Errorf("keys per item = %v, want 3 keys for item 1 only", got)
+	}
+}
+
+// Прежнее «количество N» в корзине — одна личная копия и N-1 в подарок; последующие
+// миграции количество не трогают, при оплате такие копии получают ключи.
+func TestGiftCopiesKeepQuantity(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := Up(db); err != nil {
+		t.Fatal(err)
+	}
+	downTo(t, db, 13)
+	_, err := db.Exec(`
+        INSERT INTO customers (id, username, password) VALUES (1, 'eve', 'x');
+        INSERT INTO games (id, title, price_minor) VALUES (1, 'Doom', 1999), (2, 'Quake', 999);
+        INSERT INTO cart_items (user_id, game_id, quantity) VALUES (1, 1, 3), (1, 2, 1);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Up(db); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("SELECT game_id, gift, quantity FROM cart_items ORDER BY game_id, gift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got [][3]int
+	for rows.Next() {
+		var line [3]int
+		if err := rows.Scan(&line[0], &line[1], &line[2]); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, line)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := [][3]int{{1, 0, 1}, {1, 1, 2}, {2, 0, 1}}
+	if !slices.Equal(got, want) {
+		t.Errorf("cart lines (game, gift, quantity) = %v, want %v", got, want)
+	}
+}
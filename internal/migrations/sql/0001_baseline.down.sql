@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS user_games;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS cart_items;
+DROP TABLE IF EXISTS purchase_items;
+DROP TABLE IF EXISTS purchases;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS customers;
+DROP TABLE IF EXISTS games;
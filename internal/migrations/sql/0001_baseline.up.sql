@@ -0,0 +1,71 @@
+-- Базовая схема магазина. IF NOT EXISTS — чтобы миграция спокойно ложилась
+-- и на старые games.db, созданные InitDB/ensureSchema.
+
+CREATE TABLE IF NOT EXISTS games (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	description TEXT,
+	price REAL NOT NULL DEFAULT 0,
+	image_url TEXT,
+	published INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS customers (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL,
+	password TEXT NOT NULL,
+	role TEXT NOT NULL DEFAULT 'customer'
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	token_hash TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	created_at TEXT NOT NULL,
+	last_seen_at TEXT NOT NULL,
+	expires_at TEXT NOT NULL,
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY(user_id) REFERENCES customers(id)
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+
+CREATE TABLE IF NOT EXISTS purchases (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER,
+	total REAL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	paid INTEGER DEFAULT 0,
+	FOREIGN KEY(user_id) REFERENCES customers(id)
+);
+
+CREATE TABLE IF NOT EXISTS purchase_items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_id INTEGER,
+	game_id INTEGER,
+	quantity INTEGER DEFAULT 1,
+	price REAL,
+	FOREIGN KEY(purchase_id) REFERENCES purchases(id),
+	FOREIGN KEY(game_id) REFERENCES games(id)
+);
+
+CREATE TABLE IF NOT EXISTS cart_items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER,
+	game_id INTEGER,
+	quantity INTEGER DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS comments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	game_id INTEGER,
+	user_id INTEGER,
+	rating INTEGER,
+	text TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_games (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER,
+	game_id INTEGER
+);
@@ -0,0 +1,48 @@
+-- Данные library были слиты в user_games и обратно не разделяются:
+-- возвращаем только саму таблицу (пустой) и старую форму purchases/cart_items/user_games.
+DROP INDEX IF EXISTS idx_comments_game_id;
+DROP INDEX IF EXISTS idx_purchase_items_purchase_id;
+
+CREATE TABLE cart_items_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER,
+	game_id INTEGER,
+	quantity INTEGER DEFAULT 1
+);
+INSERT INTO cart_items_old (id, user_id, game_id, quantity) SELECT id, user_id, game_id, quantity FROM cart_items;
+DROP TABLE cart_items;
+ALTER TABLE cart_items_old RENAME TO cart_items;
+
+CREATE TABLE purchases_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	customer_id INTEGER,
+	total REAL,
+	purchase_date DATETIME DEFAULT CURRENT_TIMESTAMP,
+	user_id INTEGER,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	paid INTEGER DEFAULT 0,
+	FOREIGN KEY(customer_id) REFERENCES customers(id)
+);
+INSERT INTO purchases_old (id, customer_id, total, purchase_date, user_id, created_at, paid)
+	SELECT id, user_id, total, created_at, user_id, created_at, paid FROM purchases;
+DROP TABLE purchases;
+ALTER TABLE purchases_old RENAME TO purchases;
+
+CREATE TABLE user_games_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER,
+	game_id INTEGER
+);
+INSERT INTO user_games_old (id, user_id, game_id) SELECT id, user_id, game_id FROM user_games;
+DROP TABLE user_games;
+ALTER TABLE user_games_old RENAME TO user_games;
+
+CREATE TABLE IF NOT EXISTS library (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	customer_id INTEGER,
+	game_id INTEGER,
+	purchase_id INTEGER,
+	FOREIGN KEY(customer_id) REFERENCES customers(id),
+	FOREIGN KEY(game_id) REFERENCES games(id),
+	FOREIGN KEY(purchase_id) REFERENCES purchases(id)
+);
@@ -0,0 +1,68 @@
+-- 1. library дублировал user_games: переносим записи в user_games и удаляем таблицу.
+--    CREATE IF NOT EXISTS нужен для новых баз, где library никогда не было.
+CREATE TABLE IF NOT EXISTS library (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	customer_id INTEGER,
+	game_id INTEGER,
+	purchase_id INTEGER
+);
+
+-- 2. user_games без UNIQUE копил дубли (INSERT OR IGNORE не срабатывал).
+CREATE TABLE user_games_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	game_id INTEGER NOT NULL,
+	UNIQUE(user_id, game_id),
+	FOREIGN KEY(user_id) REFERENCES customers(id),
+	FOREIGN KEY(game_id) REFERENCES games(id)
+);
+INSERT OR IGNORE INTO user_games_new (user_id, game_id)
+	SELECT user_id, game_id FROM user_games
+	WHERE user_id IS NOT NULL AND game_id IS NOT NULL
+	ORDER BY id;
+INSERT OR IGNORE INTO user_games_new (user_id, game_id)
+	SELECT customer_id, game_id FROM library
+	WHERE customer_id IS NOT NULL AND game_id IS NOT NULL
+	ORDER BY id;
+DROP TABLE user_games;
+ALTER TABLE user_games_new RENAME TO user_games;
+DROP TABLE library;
+
+-- 3. purchases: убираем customer_id/purchase_date, оставшиеся от InitDB
+--    (их значения перенесены в user_id/created_at при адаптации старой базы).
+CREATE TABLE purchases_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	total REAL NOT NULL DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	paid INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY(user_id) REFERENCES customers(id)
+);
+INSERT INTO purchases_new (id, user_id, total, created_at, paid)
+	SELECT id, user_id, COALESCE(total, 0), created_at, COALESCE(paid, 0)
+	FROM purchases
+	WHERE user_id IS NOT NULL;
+DROP TABLE purchases;
+ALTER TABLE purchases_new RENAME TO purchases;
+CREATE INDEX idx_purchases_user_id ON purchases(user_id);
+
+-- 4. cart_items: одна строка на пару (user_id, game_id), чтобы AddToCart мог делать честный upsert.
+CREATE TABLE cart_items_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	game_id INTEGER NOT NULL,
+	quantity INTEGER NOT NULL DEFAULT 1,
+	UNIQUE(user_id, game_id),
+	FOREIGN KEY(user_id) REFERENCES customers(id),
+	FOREIGN KEY(game_id) REFERENCES games(id)
+);
+INSERT INTO cart_items_new (user_id, game_id, quantity)
+	SELECT user_id, game_id, SUM(COALESCE(quantity, 1))
+	FROM cart_items
+	WHERE user_id IS NOT NULL AND game_id IS NOT NULL
+	GROUP BY user_id, game_id;
+DROP TABLE cart_items;
+ALTER TABLE cart_items_new RENAME TO cart_items;
+
+CREATE INDEX IF NOT EXISTS idx_purchase_items_purchase_id ON purchase_items(purchase_id);
+CREATE INDEX IF NOT EXISTS idx_comments_game_id ON comments(game_id);
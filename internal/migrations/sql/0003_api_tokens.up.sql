@@ -0,0 +1,13 @@
+-- Персональные токены доступа (Authorization: Bearer ...). Храним только sha256 токена.
+CREATE TABLE api_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	last_used_at TEXT,
+	revoked_at TEXT,
+	FOREIGN KEY(user_id) REFERENCES customers(id)
+);
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
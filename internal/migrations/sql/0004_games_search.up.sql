@@ -0,0 +1,24 @@
+-- Полнотекстовый поиск по каталогу: FTS5 поверх games (external content),
+-- индекс поддерживается триггерами.
+CREATE VIRTUAL TABLE games_fts USING fts5(
+	title,
+	description,
+	content = 'games',
+	content_rowid = 'id',
+	tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER games_fts_ai AFTER INSERT ON games BEGIN
+	INSERT INTO games_fts (rowid, title, description) VALUES (new.id, new.title, new.description);
+END;
+
+CREATE TRIGGER games_fts_ad AFTER DELETE ON games BEGIN
+	INSERT INTO games_fts (games_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+END;
+
+CREATE TRIGGER games_fts_au AFTER UPDATE OF title, description ON games BEGIN
+	INSERT INTO games_fts (games_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+	INSERT INTO games_fts (rowid, title, description) VALUES (new.id, new.title, new.description);
+END;
+
+INSERT INTO games_fts (games_fts) VALUES ('rebuild');
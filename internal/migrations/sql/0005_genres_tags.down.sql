@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS game_tags;
+DROP TABLE IF EXISTS game_genres;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS genres;
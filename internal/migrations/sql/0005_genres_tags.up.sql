@@ -0,0 +1,26 @@
+-- Жанры и теги: справочники и связи многие-ко-многим с играми.
+CREATE TABLE genres (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	slug TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE tags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	slug TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE game_genres (
+	game_id INTEGER NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+	genre_id INTEGER NOT NULL REFERENCES genres(id) ON DELETE CASCADE,
+	PRIMARY KEY (game_id, genre_id)
+);
+CREATE INDEX idx_game_genres_genre_id ON game_genres(genre_id);
+
+CREATE TABLE game_tags (
+	game_id INTEGER NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+	tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+	PRIMARY KEY (game_id, tag_id)
+);
+CREATE INDEX idx_game_tags_tag_id ON game_tags(tag_id);
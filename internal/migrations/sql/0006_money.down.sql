@@ -0,0 +1,13 @@
+ALTER TABLE games ADD COLUMN price REAL;
+UPDATE games SET price = price_minor / 100.0;
+ALTER TABLE games DROP COLUMN currency;
+ALTER TABLE games DROP COLUMN price_minor;
+
+ALTER TABLE purchase_items ADD COLUMN price REAL;
+UPDATE purchase_items SET price = price_minor / 100.0;
+ALTER TABLE purchase_items DROP COLUMN price_minor;
+
+ALTER TABLE purchases ADD COLUMN total REAL NOT NULL DEFAULT 0;
+UPDATE purchases SET total = total_minor / 100.0;
+ALTER TABLE purchases DROP COLUMN currency;
+ALTER TABLE purchases DROP COLUMN total_minor;
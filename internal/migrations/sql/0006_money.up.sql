@@ -0,0 +1,19 @@
+-- Деньги в целых минорных единицах (центах) с кодом валюты вместо REAL.
+
+ALTER TABLE games ADD COLUMN price_minor INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE games ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD';
+UPDATE games SET price_minor = CAST(ROUND(COALESCE(price, 0) * 100) AS INTEGER);
+ALTER TABLE games DROP COLUMN price;
+
+ALTER TABLE purchase_items ADD COLUMN price_minor INTEGER NOT NULL DEFAULT 0;
+UPDATE purchase_items SET price_minor = CAST(ROUND(COALESCE(price, 0) * 100) AS INTEGER);
+ALTER TABLE purchase_items DROP COLUMN price;
+
+ALTER TABLE purchases ADD COLUMN total_minor INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE purchases ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD';
+UPDATE purchases SET total_minor = CAST(ROUND(COALESCE(total, 0) * 100) AS INTEGER);
+-- итог, посчитанный во float, мог разойтись с позициями — пересчитываем по ним в целых
+UPDATE purchases SET total_minor = (
+	SELECT SUM(pi.price_minor * COALESCE(pi.quantity, 1)) FROM purchase_items pi WHERE pi.purchase_id = purchases.id
+) WHERE EXISTS (SELECT 1 FROM purchase_items pi WHERE pi.purchase_id = purchases.id);
+ALTER TABLE purchases DROP COLUMN total;
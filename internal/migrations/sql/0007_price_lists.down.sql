@@ -0,0 +1,2 @@
+ALTER TABLE customers DROP COLUMN currency;
+DROP TABLE IF EXISTS game_prices;
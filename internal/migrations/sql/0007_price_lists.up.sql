@@ -0,0 +1,12 @@
+-- Региональные прайс-листы. Базовая цена остаётся в games.price_minor/currency,
+-- game_prices задаёт цену игры в других валютах витрины. Без строки в game_prices
+-- игра продаётся только в валюте базовой цены.
+CREATE TABLE game_prices (
+	game_id INTEGER NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+	currency TEXT NOT NULL,
+	price_minor INTEGER NOT NULL,
+	PRIMARY KEY (game_id, currency)
+);
+
+-- Валюта, в которой покупатель видит цены и оплачивает заказы; NULL — валюта по умолчанию.
+ALTER TABLE customers ADD COLUMN currency TEXT;
@@ -0,0 +1,16 @@
+-- Платежи по заказам: каждая попытка оплаты через провайдера — отдельная строка.
+-- Заказ становится оплаченным только по событию провайдера.
+CREATE TABLE payments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_id INTEGER NOT NULL REFERENCES purchases(id),
+	provider TEXT NOT NULL,
+	intent_id TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	amount_minor INTEGER NOT NULL,
+	currency TEXT NOT NULL,
+	failure_reason TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	UNIQUE (provider, intent_id)
+);
+CREATE INDEX idx_payments_purchase_id ON payments(purchase_id);
@@ -0,0 +1,2 @@
+ALTER TABLE payments DROP COLUMN refunded_minor;
+DROP TABLE IF EXISTS processed_events;
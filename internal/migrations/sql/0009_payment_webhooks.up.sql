@@ -0,0 +1,12 @@
+-- Обработанные события провайдера: повтор того же события (ретрай вебхука, атака
+-- повтором) распознаётся по первичному ключу и ничего не меняет.
+CREATE TABLE processed_events (
+	provider TEXT NOT NULL,
+	event_id TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	processed_at TEXT NOT NULL,
+	PRIMARY KEY (provider, event_id)
+);
+
+-- Сколько уже возвращено по платежу (события refund.succeeded).
+ALTER TABLE payments ADD COLUMN refunded_minor INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS order_events;
+
+ALTER TABLE purchases ADD COLUMN paid INTEGER NOT NULL DEFAULT 0;
+UPDATE purchases SET paid = CASE WHEN status = 'paid' THEN 1 ELSE 0 END;
+DROP INDEX IF EXISTS idx_purchases_status;
+ALTER TABLE purchases DROP COLUMN status;
+ALTER TABLE purchases DROP COLUMN updated_at;
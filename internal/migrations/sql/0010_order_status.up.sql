@@ -0,0 +1,23 @@
+-- Жизненный цикл заказа: вместо флага paid — статус, а переходы между статусами
+-- (с причиной и временем) пишутся в order_events.
+ALTER TABLE purchases ADD COLUMN status TEXT NOT NULL DEFAULT 'pending';
+ALTER TABLE purchases ADD COLUMN updated_at TEXT;
+UPDATE purchases SET status = CASE WHEN paid = 1 THEN 'paid' ELSE 'pending' END, updated_at = created_at;
+ALTER TABLE purchases DROP COLUMN paid;
+CREATE INDEX idx_purchases_status ON purchases(status);
+
+CREATE TABLE order_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_id INTEGER NOT NULL REFERENCES purchases(id),
+	from_status TEXT NOT NULL DEFAULT '',
+	to_status TEXT NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL
+);
+CREATE INDEX idx_order_events_purchase_id ON order_events(purchase_id);
+
+-- история существующих заказов начинается с создания; время оплаты не сохранялось
+INSERT INTO order_events (purchase_id, from_status, to_status, created_at)
+	SELECT id, '', 'pending', created_at FROM purchases;
+INSERT INTO order_events (purchase_id, from_status, to_status, created_at)
+	SELECT id, 'pending', 'paid', created_at FROM purchases WHERE status = 'paid';
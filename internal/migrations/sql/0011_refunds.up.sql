@@ -0,0 +1,28 @@
+-- Заявки на возврат: покупатель выбирает позиции оплаченного заказа, администратор
+-- одобряет или отклоняет. Одобренный возврат проводится через провайдера по платежу
+-- payment_id, а игры из позиций забираются из библиотеки.
+CREATE TABLE refunds (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_id INTEGER NOT NULL REFERENCES purchases(id),
+	user_id INTEGER NOT NULL REFERENCES customers(id),
+	status TEXT NOT NULL DEFAULT 'pending',
+	reason TEXT NOT NULL DEFAULT '',
+	amount_minor INTEGER NOT NULL,
+	currency TEXT NOT NULL,
+	payment_id INTEGER REFERENCES payments(id),
+	provider_refund_id TEXT NOT NULL DEFAULT '',
+	admin_note TEXT NOT NULL DEFAULT '',
+	decided_by INTEGER REFERENCES customers(id),
+	created_at TEXT NOT NULL,
+	decided_at TEXT
+);
+CREATE INDEX idx_refunds_purchase_id ON refunds(purchase_id);
+CREATE INDEX idx_refunds_status ON refunds(status);
+
+-- Позиции заказа в заявке; позиция может быть в одной ожидающей или одобренной заявке.
+CREATE TABLE refund_items (
+	refund_id INTEGER NOT NULL REFERENCES refunds(id),
+	purchase_item_id INTEGER NOT NULL REFERENCES purchase_items(id),
+	PRIMARY KEY (refund_id, purchase_item_id)
+);
+CREATE INDEX idx_refund_items_purchase_item_id ON refund_items(purchase_item_id);
@@ -0,0 +1,11 @@
+-- Ключи идемпотентности оформления и оплаты: повтор запроса с тем же ключом
+-- (двойной клик, ретрай браузера или клиента API) возвращает первый результат.
+CREATE TABLE idempotency_keys (
+	user_id INTEGER NOT NULL REFERENCES customers(id),
+	operation TEXT NOT NULL,
+	key TEXT NOT NULL,
+	purchase_id INTEGER NOT NULL REFERENCES purchases(id),
+	payment_id INTEGER REFERENCES payments(id),
+	created_at TEXT NOT NULL,
+	PRIMARY KEY (user_id, operation, key)
+);
@@ -0,0 +1,15 @@
+ALTER TABLE purchase_items DROP COLUMN gift;
+
+CREATE TABLE cart_items_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	game_id INTEGER NOT NULL,
+	quantity INTEGER NOT NULL DEFAULT 1,
+	UNIQUE(user_id, game_id),
+	FOREIGN KEY(user_id) REFERENCES customers(id),
+	FOREIGN KEY(game_id) REFERENCES games(id)
+);
+INSERT INTO cart_items_old (id, user_id, game_id, quantity)
+	SELECT MIN(id), user_id, game_id, SUM(quantity) FROM cart_items GROUP BY user_id, game_id;
+DROP TABLE cart_items;
+ALTER TABLE cart_items_old RENAME TO cart_items;
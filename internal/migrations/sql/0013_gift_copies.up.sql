@@ -0,0 +1,22 @@
+-- Личная копия игры и копии в подарок — разные строки корзины и заказа: личная
+-- всегда одна (и только если игры ещё нет в библиотеке), подарочных может быть несколько.
+CREATE TABLE cart_items_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	game_id INTEGER NOT NULL,
+	quantity INTEGER NOT NULL DEFAULT 1,
+	gift INTEGER NOT NULL DEFAULT 0,
+	UNIQUE(user_id, game_id, gift),
+	FOREIGN KEY(user_id) REFERENCES customers(id),
+	FOREIGN KEY(game_id) REFERENCES games(id)
+);
+-- прежнее «количество N» — одна личная копия и N-1 в подарок
+INSERT INTO cart_items_new (id, user_id, game_id, quantity, gift)
+	SELECT id, user_id, game_id, 1, 0 FROM cart_items;
+INSERT INTO cart_items_new (user_id, game_id, quantity, gift)
+	SELECT user_id, game_id, quantity - 1, 1 FROM cart_items WHERE quantity > 1;
+DROP TABLE cart_items;
+ALTER TABLE cart_items_new RENAME TO cart_items;
+
+-- в библиотеку покупателя попадают только личные копии
+ALTER TABLE purchase_items ADD COLUMN gift INTEGER NOT NULL DEFAULT 0;
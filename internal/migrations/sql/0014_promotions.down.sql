@@ -0,0 +1,5 @@
+ALTER TABLE purchase_items DROP COLUMN discount_minor;
+ALTER TABLE purchases DROP COLUMN coupon_code;
+ALTER TABLE purchases DROP COLUMN discount_minor;
+DROP TABLE promotion_redemptions;
+DROP TABLE promotions;
@@ -0,0 +1,38 @@
+-- Скидки: распродажи (code IS NULL — применяются сами) и купоны (по коду).
+-- game_id IS NULL — на весь магазин. Процент — percent, фиксированная сумма — amount_minor в currency.
+CREATE TABLE promotions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	code TEXT UNIQUE COLLATE NOCASE,
+	kind TEXT NOT NULL CHECK (kind IN ('percent', 'fixed')),
+	percent INTEGER NOT NULL DEFAULT 0,
+	amount_minor INTEGER NOT NULL DEFAULT 0,
+	currency TEXT NOT NULL DEFAULT '',
+	game_id INTEGER,
+	starts_at TEXT,
+	ends_at TEXT,
+	max_uses INTEGER NOT NULL DEFAULT 0,
+	max_uses_per_customer INTEGER NOT NULL DEFAULT 0,
+	active INTEGER NOT NULL DEFAULT 1,
+	created_at TEXT NOT NULL,
+	FOREIGN KEY(game_id) REFERENCES games(id)
+);
+
+-- какие скидки получил заказ и на сколько; по ним же считаются лимиты использований
+CREATE TABLE promotion_redemptions (
+	promotion_id INTEGER NOT NULL,
+	purchase_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	discount_minor INTEGER NOT NULL,
+	currency TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	PRIMARY KEY (promotion_id, purchase_id),
+	FOREIGN KEY(promotion_id) REFERENCES promotions(id),
+	FOREIGN KEY(purchase_id) REFERENCES purchases(id)
+);
+CREATE INDEX idx_promotion_redemptions_user ON promotion_redemptions(user_id, promotion_id);
+
+-- total_minor заказа — уже со скидкой; discount_minor строки — скидка на всю строку (все копии)
+ALTER TABLE purchases ADD COLUMN discount_minor INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE purchases ADD COLUMN coupon_code TEXT NOT NULL DEFAULT '';
+ALTER TABLE purchase_items ADD COLUMN discount_minor INTEGER NOT NULL DEFAULT 0;
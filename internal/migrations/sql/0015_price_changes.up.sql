@@ -0,0 +1,18 @@
+-- Календарь цен: с starts_at до ends_at игра стоит price_minor в currency (в остальных валютах
+-- цена не меняется) или на percent процентов дешевле во всех валютах. Из нескольких
+-- одновременных изменений действует самая низкая цена; выше обычной цена не поднимается.
+CREATE TABLE price_changes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	game_id INTEGER NOT NULL,
+	price_minor INTEGER,
+	currency TEXT NOT NULL DEFAULT '',
+	percent INTEGER NOT NULL DEFAULT 0,
+	starts_at TEXT NOT NULL,
+	ends_at TEXT NOT NULL,
+	note TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	CHECK ((price_minor IS NULL) = (percent > 0)),
+	FOREIGN KEY(game_id) REFERENCES games(id)
+);
+
+CREATE INDEX idx_price_changes_game ON price_changes(game_id, starts_at);
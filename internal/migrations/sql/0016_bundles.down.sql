@@ -0,0 +1,22 @@
+DROP TABLE purchase_bundle_games;
+-- до этой миграции позиций без игры не бывает
+DELETE FROM purchase_items WHERE bundle_id IS NOT NULL;
+ALTER TABLE purchase_items DROP COLUMN bundle_id;
+
+CREATE TABLE cart_items_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	game_id INTEGER NOT NULL,
+	quantity INTEGER NOT NULL DEFAULT 1,
+	gift INTEGER NOT NULL DEFAULT 0,
+	UNIQUE(user_id, game_id, gift),
+	FOREIGN KEY(user_id) REFERENCES customers(id),
+	FOREIGN KEY(game_id) REFERENCES games(id)
+);
+INSERT INTO cart_items_old (id, user_id, game_id, quantity, gift)
+	SELECT id, user_id, game_id, quantity, gift FROM cart_items WHERE game_id IS NOT NULL;
+DROP TABLE cart_items;
+ALTER TABLE cart_items_old RENAME TO cart_items;
+
+DROP TABLE bundle_games;
+DROP TABLE bundles;
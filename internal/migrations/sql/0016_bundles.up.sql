@@ -0,0 +1,52 @@
+-- Наборы: несколько игр, которые продаются как один товар по своей цене.
+CREATE TABLE bundles (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	image_url TEXT NOT NULL DEFAULT '',
+	price_minor INTEGER NOT NULL,
+	currency TEXT NOT NULL,
+	published INTEGER NOT NULL DEFAULT 1,
+	created_at TEXT NOT NULL
+);
+
+CREATE TABLE bundle_games (
+	bundle_id INTEGER NOT NULL,
+	game_id INTEGER NOT NULL,
+	PRIMARY KEY (bundle_id, game_id),
+	FOREIGN KEY(bundle_id) REFERENCES bundles(id),
+	FOREIGN KEY(game_id) REFERENCES games(id)
+);
+CREATE INDEX idx_bundle_games_game ON bundle_games(game_id);
+
+-- строка корзины — либо игра, либо набор (набор — всегда одна личная копия)
+CREATE TABLE cart_items_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	game_id INTEGER,
+	bundle_id INTEGER,
+	quantity INTEGER NOT NULL DEFAULT 1,
+	gift INTEGER NOT NULL DEFAULT 0,
+	CHECK ((game_id IS NULL) <> (bundle_id IS NULL)),
+	UNIQUE(user_id, game_id, gift),
+	UNIQUE(user_id, bundle_id),
+	FOREIGN KEY(user_id) REFERENCES customers(id),
+	FOREIGN KEY(game_id) REFERENCES games(id),
+	FOREIGN KEY(bundle_id) REFERENCES bundles(id)
+);
+INSERT INTO cart_items_new (id, user_id, game_id, quantity, gift)
+	SELECT id, user_id, game_id, quantity, gift FROM cart_items;
+DROP TABLE cart_items;
+ALTER TABLE cart_items_new RENAME TO cart_items;
+
+-- позиция заказа с набором (game_id IS NULL) и игры, которые она выдаёт при оплате:
+-- те, которых у покупателя не было при оформлении
+ALTER TABLE purchase_items ADD COLUMN bundle_id INTEGER;
+CREATE TABLE purchase_bundle_games (
+	purchase_item_id INTEGER NOT NULL,
+	game_id INTEGER NOT NULL,
+	PRIMARY KEY (purchase_item_id, game_id),
+	FOREIGN KEY(purchase_item_id) REFERENCES purchase_items(id),
+	FOREIGN KEY(game_id) REFERENCES games(id)
+);
+CREATE INDEX idx_purchase_bundle_games_game ON purchase_bundle_games(game_id);
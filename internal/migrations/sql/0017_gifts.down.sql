@@ -0,0 +1,3 @@
+DROP TABLE gifts;
+DROP INDEX idx_customers_email;
+ALTER TABLE customers DROP COLUMN email;
@@ -0,0 +1,25 @@
+-- email покупателя — по нему (или по имени) находят получателя подарка; хранится в нижнем регистре
+ALTER TABLE customers ADD COLUMN email TEXT;
+CREATE UNIQUE INDEX idx_customers_email ON customers(email);
+
+-- подарок — копия игры из строки заказа для другого покупателя; заводится при оформлении,
+-- в библиотеку получателя игра попадает при оплате, получатель принимает или отклоняет её
+CREATE TABLE gifts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purchase_item_id INTEGER NOT NULL UNIQUE,
+	purchase_id INTEGER NOT NULL,
+	sender_id INTEGER NOT NULL,
+	recipient_id INTEGER NOT NULL,
+	game_id INTEGER NOT NULL,
+	message TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT 'pending',
+	created_at TEXT NOT NULL,
+	decided_at TEXT,
+	FOREIGN KEY(purchase_item_id) REFERENCES purchase_items(id),
+	FOREIGN KEY(purchase_id) REFERENCES purchases(id),
+	FOREIGN KEY(sender_id) REFERENCES customers(id),
+	FOREIGN KEY(recipient_id) REFERENCES customers(id),
+	FOREIGN KEY(game_id) REFERENCES games(id)
+);
+CREATE INDEX idx_gifts_recipient ON gifts(recipient_id, status);
+CREATE INDEX idx_gifts_sender ON gifts(sender_id);
@@ -0,0 +1 @@
+DROP TABLE activation_keys;
@@ -0,0 +1,17 @@
+-- ключи активации для продаж через партнёров: код хранится без дефисов и пробелов, в верхнем
+-- регистре; активированный ключ помнит, кто и когда его активировал
+CREATE TABLE activation_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	game_id INTEGER NOT NULL,
+	code TEXT NOT NULL UNIQUE,
+	batch TEXT NOT NULL DEFAULT '',
+	created_by INTEGER,
+	created_at TEXT NOT NULL,
+	redeemed_by INTEGER,
+	redeemed_at TEXT,
+	FOREIGN KEY(game_id) REFERENCES games(id),
+	FOREIGN KEY(created_by) REFERENCES customers(id),
+	FOREIGN KEY(redeemed_by) REFERENCES customers(id)
+);
+CREATE INDEX idx_activation_keys_game ON activation_keys(game_id, batch);
+CREATE INDEX idx_activation_keys_redeemed ON activation_keys(redeemed_at);
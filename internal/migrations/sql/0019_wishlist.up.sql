@@ -0,0 +1,33 @@
+-- список желаемого: notified_minor/currency — цена копии для покупателя (с календарём цен
+-- и распродажами), о которой он уже знает; уведомление приходит, когда цена опускается ниже
+CREATE TABLE wishlist_items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	game_id INTEGER NOT NULL,
+	created_at TEXT NOT NULL,
+	notified_minor INTEGER,
+	currency TEXT,
+	UNIQUE(user_id, game_id),
+	FOREIGN KEY(user_id) REFERENCES customers(id),
+	FOREIGN KEY(game_id) REFERENCES games(id)
+);
+CREATE INDEX idx_wishlist_items_game ON wishlist_items(game_id);
+
+-- уведомления покупателю: игра из списка желаемого подешевела (kind = price_drop)
+-- или на неё началась распродажа (kind = sale, promotion_id — распродажа)
+CREATE TABLE notifications (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	kind TEXT NOT NULL,
+	game_id INTEGER NOT NULL,
+	promotion_id INTEGER,
+	old_price_minor INTEGER NOT NULL,
+	new_price_minor INTEGER NOT NULL,
+	currency TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	read_at TEXT,
+	FOREIGN KEY(user_id) REFERENCES customers(id),
+	FOREIGN KEY(game_id) REFERENCES games(id),
+	FOREIGN KEY(promotion_id) REFERENCES promotions(id)
+);
+CREATE INDEX idx_notifications_user ON notifications(user_id, read_at);
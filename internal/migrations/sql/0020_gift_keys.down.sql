@@ -0,0 +1,4 @@
+DELETE FROM activation_keys WHERE purchase_item_id IS NOT NULL;
+DROP INDEX idx_activation_keys_purchase_item;
+ALTER TABLE activation_keys DROP COLUMN revoked_at;
+ALTER TABLE activation_keys DROP COLUMN purchase_item_id;
@@ -0,0 +1,21 @@
+-- копии в подарок без получателя доставляются ключами активации: при оплате на каждую копию
+-- выпускается ключ, привязанный к строке заказа, покупатель видит коды в истории заказов.
+-- Возврат строки отзывает её ключи (revoked_at), а игру забирает у тех, кто их активировал.
+ALTER TABLE activation_keys ADD COLUMN purchase_item_id INTEGER REFERENCES purchase_items(id);
+ALTER TABLE activation_keys ADD COLUMN revoked_at TEXT;
+CREATE INDEX idx_activation_keys_purchase_item ON activation_keys(purchase_item_id);
+
+-- уже оплаченные копии без получателя, проданные до ключей: по ключу на копию
+WITH RECURSIVE copies(item_id, game_id, purchase_id, n) AS (
+	SELECT pi.id, pi.game_id, pi.purchase_id, COALESCE(pi.quantity, 1)
+	FROM purchase_items pi JOIN purchases p ON p.id = pi.purchase_id
+	WHERE p.status = 'paid' AND pi.gift = 1 AND pi.game_id IS NOT NULL
+	  AND NOT EXISTS (SELECT 1 FROM gifts gf WHERE gf.purchase_item_id = pi.id)
+	  AND pi.id NOT IN (SELECT ri.purchase_item_id FROM refund_items ri JOIN refunds x ON x.id = ri.refund_id
+	                    WHERE x.status = 'approved')
+	UNION ALL
+	SELECT item_id, game_id, purchase_id, n - 1 FROM copies WHERE n > 1
+)
+INSERT INTO activation_keys (game_id, code, batch, created_at, purchase_item_id)
+	SELECT game_id, upper(hex(randomblob(8))), 'order-' || purchase_id, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'), item_id
+	FROM copies;
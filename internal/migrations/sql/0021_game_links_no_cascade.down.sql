@@ -0,0 +1,29 @@
+CREATE TABLE game_genres_old (
+	game_id INTEGER NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+	genre_id INTEGER NOT NULL REFERENCES genres(id) ON DELETE CASCADE,
+	PRIMARY KEY (game_id, genre_id)
+);
+INSERT INTO game_genres_old (game_id, genre_id) SELECT game_id, genre_id FROM game_genres;
+DROP TABLE game_genres;
+ALTER TABLE game_genres_old RENAME TO game_genres;
+CREATE INDEX idx_game_genres_genre_id ON game_genres(genre_id);
+
+CREATE TABLE game_tags_old (
+	game_id INTEGER NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+	tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+	PRIMARY KEY (game_id, tag_id)
+);
+INSERT INTO game_tags_old (game_id, tag_id) SELECT game_id, tag_id FROM game_tags;
+DROP TABLE game_tags;
+ALTER TABLE game_tags_old RENAME TO game_tags;
+CREATE INDEX idx_game_tags_tag_id ON game_tags(tag_id);
+
+CREATE TABLE game_prices_old (
+	game_id INTEGER NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+	currency TEXT NOT NULL,
+	price_minor INTEGER NOT NULL,
+	PRIMARY KEY (game_id, currency)
+);
+INSERT INTO game_prices_old (game_id, currency, price_minor) SELECT game_id, currency, price_minor FROM game_prices;
+DROP TABLE game_prices;
+ALTER TABLE game_prices_old RENAME TO game_prices;
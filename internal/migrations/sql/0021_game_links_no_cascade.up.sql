@@ -0,0 +1,31 @@
+-- foreign_keys в базе не включены, поэтому ON DELETE CASCADE из 0005 и 0007 никогда не
+-- срабатывал: связи игры удаляет сам gameRepo.Delete. Убираем вводящие в заблуждение каскады.
+CREATE TABLE game_genres_new (
+	game_id INTEGER NOT NULL REFERENCES games(id),
+	genre_id INTEGER NOT NULL REFERENCES genres(id),
+	PRIMARY KEY (game_id, genre_id)
+);
+INSERT INTO game_genres_new (game_id, genre_id) SELECT game_id, genre_id FROM game_genres;
+DROP TABLE game_genres;
+ALTER TABLE game_genres_new RENAME TO game_genres;
+CREATE INDEX idx_game_genres_genre_id ON game_genres(genre_id);
+
+CREATE TABLE game_tags_new (
+	game_id INTEGER NOT NULL REFERENCES games(id),
+	tag_id INTEGER NOT NULL REFERENCES tags(id),
+	PRIMARY KEY (game_id, tag_id)
+);
+INSERT INTO game_tags_new (game_id, tag_id) SELECT game_id, tag_id FROM game_tags;
+DROP TABLE game_tags;
+ALTER TABLE game_tags_new RENAME TO game_tags;
+CREATE INDEX idx_game_tags_tag_id ON game_tags(tag_id);
+
+CREATE TABLE game_prices_new (
+	game_id INTEGER NOT NULL REFERENCES games(id),
+	currency TEXT NOT NULL,
+	price_minor INTEGER NOT NULL,
+	PRIMARY KEY (game_id, currency)
+);
+INSERT INTO game_prices_new (game_id, currency, price_minor) SELECT game_id, currency, price_minor FROM game_prices;
+DROP TABLE game_prices;
+ALTER TABLE game_prices_new RENAME TO game_prices;
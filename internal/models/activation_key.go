@@ -0,0 +1,106 @@
+package models
+
+import (
+	"crypto/rand"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxKeysPerBatch — сколько ключей можно сгенерировать или импортировать за раз.
+	MaxKeysPerBatch = 1000
+	// MaxKeyCode — предельная длина кода импортируемого ключа (без дефисов).
+	MaxKeyCode = 64
+	// keyAlphabet — символы генерируемых ключей: без 0/O и 1/I, которые легко спутать.
+	// 32 символа — байт из crypto/rand делится на них без перекоса.
+	keyAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+	keyGroups   = 3
+	keyGroupLen = 5
+)
+
+// ActivationKey — ключ активации игры (строка activation_keys).
+type ActivationKey struct {
+	ID        int       `json:"id"`
+	GameID    int       `json:"game_id"`
+	GameTitle string    `json:"game_title"`
+	Code      string    `json:"code"`            // в NormalizeKey-виде
+	Batch     string    `json:"batch,omitempty"` // партия: партнёр, акция
+	CreatedAt time.Time `json:"created_at"`
+	// RedeemedBy и RedeemedAt — кто и когда активировал ключ; 0 — ещё не активирован.
+	RedeemedBy int       `json:"redeemed_by,omitempty"`
+	Redeemer   string    `json:"redeemer,omitempty"`
+	RedeemedAt time.Time `json:"redeemed_at,omitzero"`
+	// OrderID — заказ, за копию в подарок из которого выпущен ключ; 0 — ключ из админки.
+	OrderID int `json:"order_id,omitempty"`
+	// RevokedAt — когда ключ отозван возвратом денег за копию; отозванный ключ не активируется.
+	RevokedAt time.Time `json:"revoked_at,omitzero"`
+}
+
+// Redeemed — ключ уже активирован.
+func (k ActivationKey) Redeemed() bool { return k.RedeemedBy != 0 }
+
+// Revoked — ключ отозван.
+func (k ActivationKey) Revoked() bool { return !k.RevokedAt.IsZero() }
+
+// Display — код для показа и выгрузки: группами по пять символов.
+func (k ActivationKey) Display() string { return FormatKey(k.Code) }
+
+// KeyStock — запас ключей игры.
+type KeyStock struct {
+	GameID    int
+	GameTitle string
+	Total     int
+	Redeemed  int
+}
+
+// Available — сколько ключей ещё не активировано.
+func (s KeyStock) Available() int { return s.Total - s.Redeemed }
+
+// NewKeyCode генерирует код ключа: 15 символов из keyAlphabet (в NormalizeKey-виде).
+func NewKeyCode() (string, error) {
+	b := make([]byte, keyGroups*keyGroupLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = keyAlphabet[int(b[i])%len(keyAlphabet)]
+	}
+	return string(b), nil
+}
+
+// NormalizeKey приводит введённый ключ к виду, в котором он хранится: верхний регистр,
+// без дефисов и пробелов — "abcde-fghij" и "ABCDEFGHIJ" один и тот же ключ.
+func NormalizeKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(s)))
+}
+
+// ValidKeyCode — код в NormalizeKey-виде годится как ключ: латинские буквы и цифры,
+// не длиннее MaxKeyCode.
+func ValidKeyCode(code string) bool {
+	if code == "" || len(code) > MaxKeyCode {
+		return false
+	}
+	for _, r := range code {
+		if !('A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatKey разбивает код на группы по пять символов через дефис.
+func FormatKey(code string) string {
+	var sb strings.Builder
+	for i, r := range code {
+		if i > 0 && i%keyGroupLen == 0 {
+			sb.WriteByte('-')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+
+	"github.com/aml-709/game-store/internal/money"
+)
+
+// Bundle — набор игр (строка bundles и её bundle_games), который продаётся как один товар:
+// одна позиция корзины и заказа, а при оплате покупатель получает каждую игру набора.
+// Цена — только в валюте Price; в остальных валютах набор не продаётся.
+type Bundle struct {
+	ID          int          `json:"id"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	ImageURL    string       `json:"image_url"`
+	Price       money.Amount `json:"price"`
+	Published   bool         `json:"published"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Games       []BundleGame `json:"games"`
+}
+
+// BundleGame — игра набора. Price — её обычная цена в валюте набора (нулевая, если в этой
+// валюте игра не продаётся).
+type BundleGame struct {
+	ID    int          `json:"id"`
+	Title string       `json:"title"`
+	Price money.Amount `json:"price"`
+	// Owned — игра уже есть у покупателя (в корзине — или лежит там отдельно): её стоимость
+	// вычитается из цены набора, а при покупке набора она не выдаётся второй раз.
+	Owned bool `json:"owned,omitempty"`
+}
+
+// Value — сколько стоят игры набора по отдельности.
+func (b Bundle) Value() money.Amount {
+	v := money.New(0, b.Price.Currency)
+	for _, g := range b.Games {
+		v.Minor += g.Price.Minor
+	}
+	return v
+}
+
+// OwnedAll — у покупателя уже есть все игры набора, покупать нечего.
+func (b Bundle) OwnedAll() bool {
+	for _, g := range b.Games {
+		if !g.Owned {
+			return false
+		}
+	}
+	return true
+}
+
+// NetPrice — цена набора для покупателя: обычная цена без доли игр, которые у него уже есть.
+// Доля считается по обычным ценам игр, а если все они бесплатные — по числу игр.
+func (b Bundle) NetPrice() money.Amount {
+	free := b.Value().IsZero()
+	var total, owned int64
+	for _, g := range b.Games {
+		w := g.Price.Minor
+		if free {
+			w = 1
+		}
+		total += w
+		if g.Owned {
+			owned += w
+		}
+	}
+	if total == 0 || owned == 0 {
+		return b.Price
+	}
+	return money.New(b.Price.Minor*(total-owned)/total, b.Price.Currency)
+}
+
+// Granted — игры, которые покупатель получит, купив набор.
+func (b Bundle) Granted() []int {
+	var out []int
+	for _, g := range b.Games {
+		if !g.Owned {
+			out = append(out, g.ID)
+		}
+	}
+	return out
+}
+
+// HasGame — для отметки чекбоксов в форме набора.
+func (b Bundle) HasGame(id int) bool {
+	for _, g := range b.Games {
+		if g.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package models
+
+import "github.com/aml-709/game-store/internal/money"
+
+// MaxGiftCopies — сколько копий одной игры в подарок можно держать в корзине.
+// Личная копия всегда одна.
+const MaxGiftCopies = 10
+
+// CartItem — строка корзины вместе с данными игры или набора.
+type CartItem struct {
+	ID     int `json:"id"` // id строки cart_items
+	GameID int `json:"game_id,omitempty"`
+	// BundleID — строка с набором (GameID == 0): Price — цена набора для покупателя (NetPrice),
+	// BundleGames — игры, которые он получит.
+	BundleID    int          `json:"bundle_id,omitempty"`
+	BundleGames []int        `json:"bundle_games,omitempty"`
+	Title       string       `json:"title"`
+	Price       money.Amount `json:"price"`
+	// OriginalPrice — обычная цена копии, если Price снижена по календарю цен; иначе нулевая.
+	OriginalPrice money.Amount `json:"original_price,omitzero"`
+	ImageURL      string       `json:"image_url"`
+	Quantity      int          `json:"quantity"`
+	// Gift — копии в подарок: в библиотеку покупателя они не попадают. Личная строка — одна копия.
+	Gift bool `json:"gift"`
+	// Discount — скидка на всю строку (все копии) по распродажам и купону, см. ApplyPromotions.
+	Discount money.Amount `json:"discount"`
+	// Owned — личная копия игры, которая уже есть в библиотеке (или набор, все игры которого
+	// уже есть); такую корзину не оформить.
+	Owned bool `json:"owned,omitempty"`
+	// Unavailable — у игры нет цены в валюте покупателя; такую корзину не оформить.
+	Unavailable bool `json:"unavailable,omitempty"`
+}
+
+// Subtotal — стоимость строки со скидкой.
+func (c CartItem) Subtotal() money.Amount {
+	return money.New(c.Price.Minor*int64(c.Quantity)-c.Discount.Minor, c.Price.Currency)
+}
+
+// FullPrice — стоимость строки по обычной цене, без календаря цен и скидок.
+func (c CartItem) FullPrice() money.Amount {
+	unit := c.Price
+	if !c.OriginalPrice.IsZero() {
+		unit = c.OriginalPrice
+	}
+	return unit.Mul(c.Quantity)
+}
+
+// Reduced — строка стоит меньше обычного (по календарю цен или скидкам).
+func (c CartItem) Reduced() bool { return c.FullPrice() != c.Subtotal() }
+
+// HasUnavailable — есть ли в корзине игры без цены в валюте покупателя.
+func HasUnavailable(items []CartItem) bool {
+	for _, it := range items {
+		if it.Unavailable {
+			return true
+		}
+	}
+	return false
+}
+
+// HasOwned — есть ли в корзине личные копии игр, которые покупатель уже купил.
+func HasOwned(items []CartItem) bool {
+	for _, it := range items {
+		if it.Owned {
+			return true
+		}
+	}
+	return false
+}
+
+// CartTotal — итог корзины; позиции в разных валютах — ошибка.
+func CartTotal(items []CartItem) (money.Amount, error) {
+	var total money.Amount
+	for _, it := range items {
+		var err error
+		if total, err = total.Add(it.Subtotal()); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
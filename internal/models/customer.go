@@ -0,0 +1,43 @@
+package models
+
+import "github.com/aml-709/game-store/internal/money"
+
+// Role — роль покупателя в магазине.
+type Role string
+
+const (
+	RoleCustomer  Role = "customer"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Roles — все роли по возрастанию прав.
+var Roles = []Role{RoleCustomer, RoleModerator, RoleAdmin}
+
+func (r Role) level() int {
+	for i, x := range Roles {
+		if x == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// Valid сообщает, известна ли роль.
+func (r Role) Valid() bool {
+	return r.level() >= 0
+}
+
+// AtLeast — true, если у роли не меньше прав, чем у min.
+func (r Role) AtLeast(min Role) bool {
+	return r.Valid() && r.level() >= min.level()
+}
+
+type Customer struct {
+	ID           int            `json:"id"`
+	Username     string         `json:"username"`
+	PasswordHash string         `json:"-"`
+	Role         Role           `json:"role"`
+	Currency     money.Currency `json:"currency,omitempty"` // выбранная валюта; пусто — валюта по умолчанию
+	Email        string         `json:"email,omitempty"`    // по нему покупателя находят как получателя подарка
+}
@@ -1,9 +1,62 @@
 package models
 
+import "github.com/aml-709/game-store/internal/money"
+
+// Game — игра каталога. Price — цена в запрошенной валюте; если в этой валюте
+// игра не продаётся, Unavailable == true, а Price нулевая. Пока идёт запланированное
+// изменение цены (PriceChange), Price — сниженная цена, а OriginalPrice — обычная.
 type Game struct {
-	ID          int
-	Title       string
-	Description string
-	Price       float64
-	ImageURL    string
+	ID            int            `json:"id"`
+	Title         string         `json:"title"`
+	Description   string         `json:"description"`
+	Price         money.Amount   `json:"price"`
+	OriginalPrice money.Amount   `json:"original_price,omitzero"` // нулевая, если цена не снижена
+	Unavailable   bool           `json:"unavailable,omitempty"`
+	ImageURL      string         `json:"image_url"`
+	Published     bool           `json:"published"`
+	Genres        []Term         `json:"genres,omitempty"` // заполняются при загрузке одной игры
+	Tags          []Term         `json:"tags,omitempty"`
+	Prices        []money.Amount `json:"-"` // региональные цены (game_prices), тоже только для одной игры
+}
+
+// OnSale — цена снижена по календарю цен.
+func (g Game) OnSale() bool { return !g.OriginalPrice.IsZero() }
+
+// RegionalPrice — региональная цена в валюте c для формы игры; пусто, если не задана.
+func (g Game) RegionalPrice(c money.Currency) string {
+	for _, p := range g.Prices {
+		if p.Currency == c {
+			return p.Decimal()
+		}
+	}
+	return ""
+}
+
+// HasGenre / HasTag — для отметки чекбоксов в форме игры.
+func (g Game) HasGenre(id int) bool { return hasTerm(g.Genres, id) }
+func (g Game) HasTag(id int) bool   { return hasTerm(g.Tags, id) }
+
+func hasTerm(terms []Term, id int) bool {
+	for _, t := range terms {
+		if t.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Маркеры подсветки в SearchHit: текст между HighlightStart и HighlightEnd совпал с запросом.
+// Управляющие символы не встречаются в названиях и описаниях, поэтому их безопасно
+// заменять на разметку уже после экранирования.
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// SearchHit — игра, найденная полнотекстовым поиском.
+type SearchHit struct {
+	Game
+	TitleHighlight string  // название с маркерами совпадений
+	Snippet        string  // фрагмент описания с маркерами совпадений
+	Rank           float64 // bm25: чем меньше, тем релевантнее
 }
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// MaxGiftMessage — предел длины поздравления к подарку (в символах).
+const MaxGiftMessage = 500
+
+// GiftStatus — состояние подарка.
+type GiftStatus string
+
+const (
+	GiftPending  GiftStatus = "pending" // игра у получателя, ждёт его ответа
+	GiftAccepted GiftStatus = "accepted"
+	GiftDeclined GiftStatus = "declined" // игра забрана из библиотеки получателя
+	GiftRevoked  GiftStatus = "revoked"  // покупателю вернули деньги за подарок
+)
+
+// Label — статус для показа в шаблонах.
+func (s GiftStatus) Label() string {
+	switch s {
+	case GiftPending:
+		return "Ждёт ответа"
+	case GiftAccepted:
+		return "Принят"
+	case GiftDeclined:
+		return "Отклонён"
+	case GiftRevoked:
+		return "Отозван"
+	}
+	return string(s)
+}
+
+// Gift — копия игры, купленная для другого покупателя (строка gifts).
+type Gift struct {
+	ID          int        `json:"id"`
+	OrderID     int        `json:"order_id"`
+	ItemID      int        `json:"item_id"` // позиция заказа (purchase_items)
+	SenderID    int        `json:"sender_id"`
+	Sender      string     `json:"sender"`
+	RecipientID int        `json:"recipient_id"`
+	Recipient   string     `json:"recipient"`
+	GameID      int        `json:"game_id"`
+	GameTitle   string     `json:"game_title"`
+	Message     string     `json:"message,omitempty"`
+	Status      GiftStatus `json:"status"`
+	// Delivered — заказ с подарком оплачен (или подарок уже решён); до этого получатель его не видит.
+	Delivered bool      `json:"delivered"`
+	CreatedAt time.Time `json:"created_at"`
+	DecidedAt time.Time `json:"decided_at,omitzero"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// IdempotencyOp — операция, к которой относится ключ идемпотентности;
+// один и тот же ключ для разных операций — разные ключи.
+type IdempotencyOp string
+
+const (
+	OpCheckout IdempotencyOp = "checkout"
+	OpPay      IdempotencyOp = "pay"
+)
+
+// MaxIdempotencyKey — предельная длина ключа.
+const MaxIdempotencyKey = 255
+
+// IdempotencyKey — выполненная операция и её результат (строка idempotency_keys).
+type IdempotencyKey struct {
+	UserID    int
+	Op        IdempotencyOp
+	Key       string
+	OrderID   int
+	PaymentID int // только для OpPay
+	CreatedAt time.Time
+}
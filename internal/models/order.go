@@ -0,0 +1,142 @@
+package models
+
+import (
+	"time"
+
+	"github.com/aml-709/game-store/internal/money"
+)
+
+// OrderStatus — состояние заказа. Допустимые переходы — в orderTransitions.
+type OrderStatus string
+
+const (
+	OrderPending   OrderStatus = "pending" // создан, ждёт оплаты
+	OrderPaid      OrderStatus = "paid"
+	OrderFailed    OrderStatus = "failed" // последняя попытка оплаты не прошла, можно повторить
+	OrderCancelled OrderStatus = "cancelled"
+	OrderRefunded  OrderStatus = "refunded"
+	OrderExpired   OrderStatus = "expired" // не оплачен вовремя
+)
+
+// orderTransitions — из какого статуса в какие можно перейти; отменённый,
+// возвращённый и просроченный заказы — конечные.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderPending: {OrderPaid, OrderFailed, OrderCancelled, OrderExpired},
+	OrderFailed:  {OrderPending, OrderPaid, OrderCancelled, OrderExpired},
+	OrderPaid:    {OrderRefunded},
+}
+
+// CanTransition — разрешён ли переход s → to.
+func (s OrderStatus) CanTransition(to OrderStatus) bool {
+	for _, next := range orderTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Payable — заказ можно (ещё или снова) оплатить.
+func (s OrderStatus) Payable() bool { return s == OrderPending || s == OrderFailed }
+
+// Cancellable — покупатель может отменить заказ сам.
+func (s OrderStatus) Cancellable() bool { return s.CanTransition(OrderCancelled) }
+
+// Label — статус для показа в шаблонах.
+func (s OrderStatus) Label() string {
+	switch s {
+	case OrderPending:
+		return "Ожидает оплаты"
+	case OrderPaid:
+		return "Оплачен"
+	case OrderFailed:
+		return "Оплата не прошла"
+	case OrderCancelled:
+		return "Отменён"
+	case OrderRefunded:
+		return "Возвращён"
+	case OrderExpired:
+		return "Просрочен"
+	}
+	return string(s)
+}
+
+// Order — заказ (строка purchases).
+type Order struct {
+	ID        int          `json:"id"`
+	UserID    int          `json:"user_id"`
+	Total     money.Amount `json:"total"`
+	CreatedAt time.Time    `json:"created_at"`
+	Status    OrderStatus  `json:"status"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	Paid      bool         `json:"paid"` // Status == OrderPaid; оставлено для клиентов API
+	// Discount — общая скидка по заказу; Total — уже со скидкой. Coupon — применённый купон.
+	Discount   money.Amount       `json:"discount"`
+	Coupon     string             `json:"coupon,omitempty"`
+	Promotions []AppliedPromotion `json:"promotions,omitempty"`
+	Items      []OrderItem        `json:"items,omitempty"`
+	Events     []OrderEvent       `json:"events,omitempty"`
+	Refunds    []Refund           `json:"refunds,omitempty"`
+	// GiftKeys — ключи активации копий в подарок без получателя, по ключу на копию; их
+	// выпускают при оплате, и покупатель передаёт их сам.
+	GiftKeys []ActivationKey `json:"gift_keys,omitempty"`
+}
+
+// Subtotal — стоимость заказа без скидок.
+func (o Order) Subtotal() money.Amount {
+	return money.New(o.Total.Minor+o.Discount.Minor, o.Total.Currency)
+}
+
+// PaidAt — когда заказ был оплачен (по истории); нулевое время, если не оплачивался.
+func (o Order) PaidAt() time.Time {
+	var t time.Time
+	for _, e := range o.Events {
+		if e.To == OrderPaid {
+			t = e.CreatedAt
+		}
+	}
+	return t
+}
+
+// RefundableItems — позиции, которые ещё не возвращены и не ждут решения по возврату.
+func (o Order) RefundableItems() []OrderItem {
+	var out []OrderItem
+	for _, it := range o.Items {
+		if it.RefundStatus == "" {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+// OrderItem — позиция заказа (строка purchase_items).
+type OrderItem struct {
+	ID       int          `json:"id"`
+	OrderID  int          `json:"order_id"`
+	GameID   int          `json:"game_id,omitempty"`
+	BundleID int          `json:"bundle_id,omitempty"` // позиция — набор (GameID == 0); игры выдаются при оплате
+	Title    string       `json:"title"`
+	Price    money.Amount `json:"price"`
+	Quantity int          `json:"quantity"`
+	Gift     bool         `json:"gift"` // копии в подарок, не в библиотеку покупателя
+	// Recipient — кому подарена копия (имя покупателя); пусто — подарок без получателя.
+	Recipient string       `json:"recipient,omitempty"`
+	Discount  money.Amount `json:"discount"` // скидка на всю строку
+	// RefundStatus — состояние заявки на возврат этой позиции (ожидающей, проводимой или одобренной); пусто — не возвращалась.
+	RefundStatus RefundStatus `json:"refund_status,omitempty"`
+}
+
+// Subtotal — стоимость позиции со скидкой (столько же вернётся при возврате).
+func (it OrderItem) Subtotal() money.Amount {
+	return money.New(it.Price.Minor*int64(it.Quantity)-it.Discount.Minor, it.Price.Currency)
+}
+
+// OrderEvent — переход заказа между статусами (строка order_events); у создания заказа From пустой.
+type OrderEvent struct {
+	ID        int         `json:"id"`
+	OrderID   int         `json:"order_id"`
+	From      OrderStatus `json:"from,omitempty"`
+	To        OrderStatus `json:"to"`
+	Reason    string      `json:"reason,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/aml-709/game-store/internal/money"
+)
+
+// PaymentStatus — состояние платежа по заказу в магазине.
+type PaymentStatus string
+
+const (
+	PaymentPending   PaymentStatus = "pending" // покупатель ушёл на страницу провайдера
+	PaymentSucceeded PaymentStatus = "succeeded"
+	PaymentFailed    PaymentStatus = "failed"
+	PaymentRefunded  PaymentStatus = "refunded"  // возвращён полностью
+	PaymentCancelled PaymentStatus = "cancelled" // заказ закрыт без оплаты, намерение отменено у провайдера
+)
+
+// Label — статус для показа в шаблонах.
+func (s PaymentStatus) Label() string {
+	switch s {
+	case PaymentPending:
+		return "Ожидает подтверждения"
+	case PaymentSucceeded:
+		return "Оплачен"
+	case PaymentFailed:
+		return "Отклонён"
+	case PaymentRefunded:
+		return "Возвращён"
+	case PaymentCancelled:
+		return "Отменён"
+	}
+	return string(s)
+}
+
+// Payment — попытка оплаты заказа через провайдера (строка payments).
+type Payment struct {
+	ID            int           `json:"id"`
+	OrderID       int           `json:"order_id"`
+	Provider      string        `json:"provider"`
+	IntentID      string        `json:"intent_id"`
+	Status        PaymentStatus `json:"status"`
+	Amount        money.Amount  `json:"amount"`
+	Refunded      money.Amount  `json:"refunded"`
+	FailureReason string        `json:"failure_reason,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+// ProcessedEvent — событие провайдера, уже применённое магазином (processed_events).
+type ProcessedEvent struct {
+	Provider    string
+	ID          string
+	Type        string
+	ProcessedAt time.Time
+}
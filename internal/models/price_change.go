@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aml-709/game-store/internal/money"
+)
+
+// PriceChange — запланированная смена цены игры (строка price_changes): с StartsAt до EndsAt
+// игра стоит Price (только в валюте Price) или на Percent процентов дешевле во всех валютах.
+// Из нескольких одновременных изменений действует самая низкая цена, и выше обычной она
+// не поднимается. Распродажи и купоны (Promotion) считаются уже от этой цены.
+type PriceChange struct {
+	ID        int          `json:"id"`
+	GameID    int          `json:"game_id"`
+	GameTitle string       `json:"-"`
+	Price     money.Amount `json:"price"`
+	Percent   int          `json:"percent,omitempty"` // 1..100; 0 — задана Price
+	StartsAt  time.Time    `json:"starts_at"`
+	EndsAt    time.Time    `json:"ends_at"`
+	Note      string       `json:"note,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// Label — новая цена для показа: "−20%" или "9.99 $".
+func (pc PriceChange) Label() string {
+	if pc.Percent > 0 {
+		return fmt.Sprintf("−%d%%", pc.Percent)
+	}
+	return pc.Price.String()
+}
+
+// Status — где изменение в календаре сейчас.
+func (pc PriceChange) Status() string {
+	t := time.Now()
+	switch {
+	case t.Before(pc.StartsAt):
+		return "Запланировано"
+	case t.Before(pc.EndsAt):
+		return "Действует"
+	}
+	return "Закончилось"
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aml-709/game-store/internal/money"
+)
+
+// PromotionKind — как считается скидка.
+type PromotionKind string
+
+const (
+	PromotionPercent PromotionKind = "percent" // процент от цены
+	PromotionFixed   PromotionKind = "fixed"   // сумма в валюте скидки
+)
+
+// MaxCouponCode — предельная длина кода купона.
+const MaxCouponCode = 64
+
+// Promotion — скидка (строка promotions).
+//
+// Без Code — распродажа: применяется к корзине сама и снижает цену каждой копии игры GameID
+// (0 — всех игр). Распродажи между собой не складываются — строке достаётся самая выгодная.
+// С Code — купон: покупатель вводит его при оформлении, и он действует поверх распродаж.
+// Процентный купон снижает подходящие строки, фиксированный — их общую стоимость.
+// Фиксированная скидка действует только в заказах в валюте Amount.
+type Promotion struct {
+	ID        int           `json:"id"`
+	Name      string        `json:"name"`
+	Code      string        `json:"code,omitempty"`
+	Kind      PromotionKind `json:"kind"`
+	Percent   int           `json:"percent,omitempty"` // 1..100
+	Amount    money.Amount  `json:"amount"`
+	GameID    int           `json:"game_id,omitempty"` // 0 — весь магазин
+	GameTitle string        `json:"-"`
+	StartsAt  time.Time     `json:"starts_at"` // нулевое — действует с момента создания
+	EndsAt    time.Time     `json:"ends_at"`   // нулевое — бессрочно
+	// MaxUses и MaxUsesPerCustomer — сколько заказов всего и у одного покупателя могут
+	// получить скидку; 0 — без ограничений. Отменённые и просроченные заказы не считаются.
+	MaxUses            int       `json:"max_uses"`
+	MaxUsesPerCustomer int       `json:"max_uses_per_customer"`
+	Active             bool      `json:"active"`
+	CreatedAt          time.Time `json:"created_at"`
+	Uses               int       `json:"uses"`
+}
+
+// IsCoupon — скидка по коду, а не распродажа.
+func (p Promotion) IsCoupon() bool { return p.Code != "" }
+
+// Running — включена ли скидка и идёт ли она в момент t.
+func (p Promotion) Running(t time.Time) bool {
+	return p.Active && !t.Before(p.StartsAt) && (p.EndsAt.IsZero() || t.Before(p.EndsAt))
+}
+
+// Label — размер скидки для показа: "−15%" или "−5.00 $".
+func (p Promotion) Label() string {
+	if p.Kind == PromotionPercent {
+		return fmt.Sprintf("−%d%%", p.Percent)
+	}
+	return "−" + p.Amount.String()
+}
+
+// appliesTo — на наборы скидки не действуют: у них своя цена.
+func (p Promotion) appliesTo(it CartItem) bool {
+	return it.BundleID == 0 && (p.GameID == 0 || p.GameID == it.GameID)
+}
+
+// unitDiscount — на сколько распродажа снижает цену одной копии.
+func (p Promotion) unitDiscount(price money.Amount) int64 {
+	switch p.Kind {
+	case PromotionPercent:
+		return price.Minor * int64(p.Percent) / 100
+	case PromotionFixed:
+		if p.Amount.Currency == price.Currency {
+			return min(p.Amount.Minor, price.Minor)
+		}
+	}
+	return 0
+}
+
+// AppliedPromotion — скидка, применённая к корзине или заказу, и её сумма.
+type AppliedPromotion struct {
+	PromotionID int          `json:"promotion_id"`
+	Name        string       `json:"name"`
+	Code        string       `json:"code,omitempty"`
+	Discount    money.Amount `json:"discount"`
+}
+
+// ApplyPromotions проставляет строкам корзины Discount по скидкам promos (распродажам
+// и купону) и возвращает применённые скидки с суммами. Действуют ли скидки сейчас,
+// проверяет вызывающий; скидки, которые ничего не снизили, в результат не попадают.
+func ApplyPromotions(items []CartItem, promos []Promotion) []AppliedPromotion {
+	var applied []AppliedPromotion
+	add := func(p Promotion, d money.Amount) {
+		for i := range applied {
+			if applied[i].PromotionID == p.ID {
+				applied[i].Discount.Minor += d.Minor
+				return
+			}
+		}
+		applied = append(applied, AppliedPromotion{PromotionID: p.ID, Name: p.Name, Code: p.Code, Discount: d})
+	}
+
+	for i, it := range items {
+		items[i].Discount = money.New(0, it.Price.Currency)
+		var best Promotion
+		var bestUnit int64
+		for _, p := range promos {
+			if p.IsCoupon() || !p.appliesTo(it) {
+				continue
+			}
+			if u := p.unitDiscount(it.Price); u > bestUnit {
+				best, bestUnit = p, u
+			}
+		}
+		if bestUnit > 0 {
+			items[i].Discount.Minor = bestUnit * int64(it.Quantity)
+			add(best, items[i].Discount)
+		}
+	}
+
+	for _, p := range promos {
+		if !p.IsCoupon() {
+			continue
+		}
+		var d money.Amount
+		switch p.Kind {
+		case PromotionPercent:
+			for i, it := range items {
+				if !p.appliesTo(it) {
+					continue
+				}
+				x := it.Subtotal().Minor * int64(p.Percent) / 100
+				items[i].Discount.Minor += x
+				d = money.New(d.Minor+x, it.Price.Currency)
+			}
+		case PromotionFixed:
+			d = spreadDiscount(items, p)
+		}
+		if d.Minor > 0 {
+			add(p, d)
+		}
+	}
+	return applied
+}
+
+// spreadDiscount делит фиксированную скидку купона между подходящими строками пропорционально
+// их стоимости (остаток от деления — по одной минорной единице первым строкам), чтобы у каждой
+// строки заказа была своя скидка — от неё считается возврат. Возвращает разделённую сумму.
+func spreadDiscount(items []CartItem, p Promotion) money.Amount {
+	eligible := func(it CartItem) bool { return p.appliesTo(it) && it.Price.Currency == p.Amount.Currency }
+	var base int64
+	for _, it := range items {
+		if eligible(it) {
+			base += it.Subtotal().Minor
+		}
+	}
+	if base <= 0 {
+		return money.Amount{}
+	}
+	total := min(p.Amount.Minor, base)
+	shares := make([]int64, len(items))
+	var given int64
+	for i, it := range items {
+		if eligible(it) {
+			shares[i] = total * it.Subtotal().Minor / base
+			given += shares[i]
+		}
+	}
+	for i, it := range items {
+		if given < total && eligible(it) && shares[i] < it.Subtotal().Minor {
+			shares[i]++
+			given++
+		}
+	}
+	for i := range items {
+		items[i].Discount.Minor += shares[i]
+	}
+	return money.New(total, p.Amount.Currency)
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/aml-709/game-store/internal/money"
+)
+
+// RefundStatus — состояние заявки на возврат.
+type RefundStatus string
+
+const (
+	RefundPending    RefundStatus = "pending"    // ждёт решения администратора
+	RefundProcessing RefundStatus = "processing" // одобряется: деньги возвращаются у провайдера
+	RefundApproved   RefundStatus = "approved"
+	RefundDenied     RefundStatus = "denied"
+)
+
+// Label — статус для показа в шаблонах.
+func (s RefundStatus) Label() string {
+	switch s {
+	case RefundPending:
+		return "На рассмотрении"
+	case RefundProcessing:
+		return "Проводится"
+	case RefundApproved:
+		return "Одобрен"
+	case RefundDenied:
+		return "Отклонён"
+	}
+	return string(s)
+}
+
+// Refund — заявка на возврат части или всего заказа (строка refunds и её позиции).
+type Refund struct {
+	ID               int          `json:"id"`
+	OrderID          int          `json:"order_id"`
+	UserID           int          `json:"user_id"`
+	Username         string       `json:"-"` // для списка в админке
+	Status           RefundStatus `json:"status"`
+	Reason           string       `json:"reason,omitempty"`
+	Amount           money.Amount `json:"amount"`
+	PaymentID        int          `json:"payment_id,omitempty"`
+	ProviderRefundID string       `json:"provider_refund_id,omitempty"`
+	AdminNote        string       `json:"admin_note,omitempty"`
+	Items            []OrderItem  `json:"items"`
+	CreatedAt        time.Time    `json:"created_at"`
+	DecidedAt        time.Time    `json:"decided_at,omitempty"`
+}
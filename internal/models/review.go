@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Review — отзыв об игре (строка comments).
+type Review struct {
+	ID        int       `json:"id"`
+	GameID    int       `json:"game_id"`
+	UserID    int       `json:"user_id"`
+	Author    string    `json:"author"`
+	Rating    int       `json:"rating"` // 1..5
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
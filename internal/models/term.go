@@ -0,0 +1,71 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/aml-709/game-store/internal/money"
+)
+
+// TermKind — вид справочника, к которому относится Term.
+type TermKind string
+
+const (
+	TermGenre TermKind = "genre"
+	TermTag   TermKind = "tag"
+)
+
+func (k TermKind) Valid() bool { return k == TermGenre || k == TermTag }
+
+// Term — жанр или тег. Slug используется в адресах фильтров (/?genre=rpg).
+type Term struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// Slugify делает slug из названия: нижний регистр, буквы и цифры, остальное — дефисы.
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// TermFacet — значение фасета жанра или тега с числом подходящих игр.
+type TermFacet struct {
+	Term
+	Count int `json:"count"`
+}
+
+// PriceFacet — ценовой диапазон [Min, Max] включительно; нулевой Max — без верхней границы.
+type PriceFacet struct {
+	Min   money.Amount `json:"min"`
+	Max   money.Amount `json:"max"`
+	Count int          `json:"count"`
+}
+
+// RatingFacet — игры со средней оценкой не ниже Min.
+type RatingFacet struct {
+	Min   int `json:"min"`
+	Count int `json:"count"`
+}
+
+// Facets — счётчики для фильтров каталога. Счётчик каждого фасета учитывает
+// все выбранные фильтры, кроме фильтров этого же фасета.
+type Facets struct {
+	Genres  []TermFacet   `json:"genres"`
+	Tags    []TermFacet   `json:"tags"`
+	Prices  []PriceFacet  `json:"prices"`
+	Ratings []RatingFacet `json:"ratings"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Scope — право персонального токена доступа.
+type Scope string
+
+const (
+	ScopeCatalogRead  Scope = "catalog:read"  // каталог и отзывы
+	ScopeCartWrite    Scope = "cart:write"    // корзина
+	ScopePurchase     Scope = "purchase"      // оформление, оплата, заказы, библиотека
+	ScopeReviewsWrite Scope = "reviews:write" // свои отзывы
+)
+
+// Scopes — все известные права в порядке показа на странице аккаунта.
+var Scopes = []Scope{ScopeCatalogRead, ScopeCartWrite, ScopePurchase, ScopeReviewsWrite}
+
+func (s Scope) Valid() bool {
+	for _, x := range Scopes {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Label — описание права для страницы аккаунта.
+func (s Scope) Label() string {
+	switch s {
+	case ScopeCatalogRead:
+		return "Чтение каталога и отзывов"
+	case ScopeCartWrite:
+		return "Управление корзиной"
+	case ScopePurchase:
+		return "Покупки: оформление, оплата, заказы и библиотека"
+	case ScopeReviewsWrite:
+		return "Публикация своих отзывов"
+	}
+	return string(s)
+}
+
+// APIToken — персональный токен доступа (сам токен не хранится, только его хеш).
+type APIToken struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	Name       string    `json:"name"`
+	Scopes     []Scope   `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	RevokedAt  time.Time `json:"revoked_at"`
+}
+
+// HasScope сообщает, выдано ли токену право s.
+func (t APIToken) HasScope(s Scope) bool {
+	for _, x := range t.Scopes {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (t APIToken) Revoked() bool {
+	return !t.RevokedAt.IsZero()
+}
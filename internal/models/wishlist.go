@@ -0,0 +1,68 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aml-709/game-store/internal/money"
+)
+
+// WishlistItem — игра в списке желаемого покупателя (строка wishlist_items). Цены — в валюте
+// покупателя на сегодня: Price уже снижена по календарю цен, Discount — скидка распродажи Sale.
+type WishlistItem struct {
+	Game
+	Discount money.Amount // скидка распродажи на копию; нулевая — распродажи нет
+	Sale     string       // название распродажи
+	SaleID   int          // id распродажи (promotions)
+	Owned    bool         // игра уже в библиотеке — уведомлений о ней не будет
+	AddedAt  time.Time
+}
+
+// FinalPrice — сколько копия стоит для покупателя сейчас, со скидкой распродажи.
+func (w WishlistItem) FinalPrice() money.Amount {
+	return money.New(w.Price.Minor-w.Discount.Minor, w.Price.Currency)
+}
+
+// FullPrice — обычная цена копии, без календаря цен и распродаж.
+func (w WishlistItem) FullPrice() money.Amount {
+	if w.OnSale() {
+		return w.OriginalPrice
+	}
+	return w.Price
+}
+
+// Reduced — цена ниже обычной: по календарю цен или по распродаже.
+func (w WishlistItem) Reduced() bool { return w.OnSale() || !w.Discount.IsZero() }
+
+// NotificationKind — о чём уведомление.
+type NotificationKind string
+
+const (
+	NotifyPriceDrop NotificationKind = "price_drop" // игра из списка желаемого подешевела
+	NotifySale      NotificationKind = "sale"       // на игру из списка желаемого началась распродажа
+)
+
+// Notification — уведомление покупателю (строка notifications).
+type Notification struct {
+	ID        int
+	UserID    int
+	Kind      NotificationKind
+	GameID    int
+	GameTitle string
+	Sale      string // название распродажи (NotifySale)
+	OldPrice  money.Amount
+	NewPrice  money.Amount
+	CreatedAt time.Time
+	ReadAt    time.Time // нулевое — не прочитано
+}
+
+// Unread — покупатель ещё не открывал список желаемого после уведомления.
+func (n Notification) Unread() bool { return n.ReadAt.IsZero() }
+
+// Text — текст уведомления для показа.
+func (n Notification) Text() string {
+	if n.Kind == NotifySale {
+		return fmt.Sprintf("Распродажа «%s»: %s теперь стоит %s вместо %s", n.Sale, n.GameTitle, n.NewPrice, n.OldPrice)
+	}
+	return fmt.Sprintf("%s подешевела: %s вместо %s", n.GameTitle, n.NewPrice, n.OldPrice)
+}
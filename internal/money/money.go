@@ -0,0 +1,197 @@
+// Package money — денежные суммы в целых минорных единицах (центах, копейках)
+// с кодом валюты. Никакой арифметики с плавающей точкой: цены, итоги заказов
+// и строки чеков считаются в int64.
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Currency — код валюты ISO 4217.
+type Currency string
+
+const (
+	USD Currency = "USD"
+	EUR Currency = "EUR"
+	RUB Currency = "RUB"
+)
+
+// Default — валюта витрины по умолчанию; в ней же задаётся базовая цена игры.
+const Default = USD
+
+// Currencies — валюты витрины в порядке показа.
+var Currencies = []Currency{USD, EUR, RUB}
+
+type currencyInfo struct {
+	exponent int    // знаков после запятой
+	symbol   string // символ для показа в шаблонах
+	region   string // регион продаж с этой валютой
+}
+
+var currencies = map[Currency]currencyInfo{
+	USD: {exponent: 2, symbol: "$", region: "США и остальной мир"},
+	EUR: {exponent: 2, symbol: "€", region: "Европа"},
+	RUB: {exponent: 2, symbol: "₽", region: "Россия"},
+}
+
+var (
+	ErrInvalidAmount    = errors.New("money: invalid amount")
+	ErrCurrencyMismatch = errors.New("money: currency mismatch")
+)
+
+// Valid сообщает, поддерживается ли валюта.
+func (c Currency) Valid() bool {
+	_, ok := currencies[c]
+	return ok
+}
+
+// Exponent — число знаков после запятой (для неизвестной валюты — 2).
+func (c Currency) Exponent() int {
+	if info, ok := currencies[c]; ok {
+		return info.exponent
+	}
+	return 2
+}
+
+// Symbol — символ валюты; для неизвестной валюты — её код.
+func (c Currency) Symbol() string {
+	if info, ok := currencies[c]; ok {
+		return info.symbol
+	}
+	return string(c)
+}
+
+// Region — регион продаж, в котором цены указываются в этой валюте.
+func (c Currency) Region() string {
+	return currencies[c].region
+}
+
+func (c Currency) scale() int64 {
+	return int64(math.Pow10(c.Exponent()))
+}
+
+// Amount — сумма в минорных единицах валюты: {1999, USD} — это 19.99 $.
+type Amount struct {
+	Minor    int64
+	Currency Currency
+}
+
+// New — сумма из минорных единиц.
+func New(minor int64, c Currency) Amount {
+	return Amount{Minor: minor, Currency: c}
+}
+
+// Parse разбирает десятичную запись ("19.99", "19,9", "20") без потери точности.
+// Знаков после запятой не может быть больше, чем у валюты.
+func Parse(s string, c Currency) (Amount, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	whole, frac, _ := strings.Cut(strings.Replace(s, ",", ".", 1), ".")
+	exp := c.Exponent()
+	if whole == "" && frac == "" || len(frac) > exp || !digits(whole) || !digits(frac) {
+		return Amount{}, ErrInvalidAmount
+	}
+	var units int64
+	if whole != "" {
+		var err error
+		if units, err = strconv.ParseInt(whole, 10, 64); err != nil || units > math.MaxInt64/c.scale()-1 {
+			return Amount{}, ErrInvalidAmount
+		}
+	}
+	minor := units * c.scale()
+	if frac != "" {
+		f, _ := strconv.ParseInt(frac+strings.Repeat("0", exp-len(frac)), 10, 64)
+		minor += f
+	}
+	if neg {
+		minor = -minor
+	}
+	return New(minor, c), nil
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (a Amount) IsZero() bool     { return a.Minor == 0 }
+func (a Amount) IsNegative() bool { return a.Minor < 0 }
+
+// Mul — сумма, умноженная на количество.
+func (a Amount) Mul(n int) Amount {
+	return New(a.Minor*int64(n), a.Currency)
+}
+
+// Add складывает суммы одной валюты. Нулевая сумма без валюты складывается с любой.
+func (a Amount) Add(b Amount) (Amount, error) {
+	switch {
+	case a.Currency == "" && a.Minor == 0:
+		return b, nil
+	case b.Currency == "" && b.Minor == 0:
+		return a, nil
+	case a.Currency != b.Currency:
+		return a, fmt.Errorf("%w: %s + %s", ErrCurrencyMismatch, a.Currency, b.Currency)
+	}
+	return New(a.Minor+b.Minor, a.Currency), nil
+}
+
+// Decimal — десятичная запись без символа валюты: "19.99".
+func (a Amount) Decimal() string {
+	exp := a.Currency.Exponent()
+	minor := a.Minor
+	sign := ""
+	if minor < 0 {
+		sign, minor = "-", -minor
+	}
+	scale := a.Currency.scale()
+	if exp == 0 {
+		return sign + strconv.FormatInt(minor, 10)
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, minor/scale, exp, minor%scale)
+}
+
+// Short — как Decimal, но без нулевой дробной части: "20" вместо "20.00".
+func (a Amount) Short() string {
+	if a.Minor%a.Currency.scale() == 0 {
+		return strconv.FormatInt(a.Minor/a.Currency.scale(), 10)
+	}
+	return a.Decimal()
+}
+
+// String — сумма для показа: "19.99 $".
+func (a Amount) String() string {
+	if a.Currency == "" {
+		return a.Decimal()
+	}
+	return a.Decimal() + " " + a.Currency.Symbol()
+}
+
+// jsonAmount — представление в API: точные минорные единицы, валюта и строка для показа.
+type jsonAmount struct {
+	Minor    int64    `json:"minor"`
+	Currency Currency `json:"currency"`
+	Amount   string   `json:"amount"`
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonAmount{Minor: a.Minor, Currency: a.Currency, Amount: a.Decimal()})
+}
+
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	var v jsonAmount
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*a = New(v.Minor, v.Currency)
+	return nil
+}
@@ -0,0 +1,274 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aml-709/game-store/internal/money"
+)
+
+// SignatureHeader — заголовок с подписью вебхука: "t=<unix-время>,v1=<hex HMAC-SHA256>",
+// подписывается строка "<t>.<тело>".
+const SignatureHeader = "Payment-Signature"
+
+// SignatureTolerance — насколько старую подпись ещё принимаем (защита от повторов).
+const SignatureTolerance = 5 * time.Minute
+
+// FakeCheckoutPath — страница оплаты тестового провайдера; к пути добавляется id намерения.
+const FakeCheckoutPath = "/payments/fake/"
+
+// Notifier доставляет подписанное событие магазину.
+type Notifier func(ctx context.Context, payload []byte, header http.Header)
+
+// Fake — тестовый провайдер для локальной разработки: намерения живут в памяти
+// (после перезапуска их нет), «оплата» — кнопка на странице FakeCheckoutPath,
+// события подписываются так же, как у настоящего провайдера, и доставляются Notifier'у.
+type Fake struct {
+	secret []byte
+
+	mu      sync.Mutex
+	intents map[string]*fakeIntent
+	notify  Notifier
+}
+
+type fakeIntent struct {
+	Intent
+	manualCapture bool
+}
+
+// NewFake создаёт тестовый провайдер; пустой secret — случайный ключ подписи.
+func NewFake(secret string) *Fake {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = []byte(randomID(""))
+	}
+	return &Fake{secret: key, intents: map[string]*fakeIntent{}}
+}
+
+// SetNotifier задаёт получателя событий.
+func (f *Fake) SetNotifier(n Notifier) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.notify = n
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) CreateIntent(ctx context.Context, p IntentParams) (Intent, error) {
+	if p.Amount.IsNegative() || !p.Amount.Currency.Valid() {
+		return Intent{}, ErrInvalidAmount
+	}
+	in := Intent{
+		ID:        randomID("pi_fake_"),
+		OrderID:   p.OrderID,
+		Status:    StatusRequiresConfirmation,
+		Amount:    p.Amount,
+		Refunded:  money.New(0, p.Amount.Currency),
+		ReturnURL: p.ReturnURL,
+	}
+	in.RedirectURL = FakeCheckoutPath + in.ID
+	f.mu.Lock()
+	f.intents[in.ID] = &fakeIntent{Intent: in, manualCapture: p.ManualCapture}
+	f.mu.Unlock()
+	return in, nil
+}
+
+func (f *Fake) Intent(ctx context.Context, id string) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	in, ok := f.intents[id]
+	if !ok {
+		return Intent{}, ErrUnknownIntent
+	}
+	return in.Intent, nil
+}
+
+// transition меняет статус намерения from → to (to вычисляется по намерению) и возвращает его копию.
+func (f *Fake) transition(id string, from Status, to func(*fakeIntent) Status) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	in, ok := f.intents[id]
+	if !ok {
+		return Intent{}, ErrUnknownIntent
+	}
+	if in.Status != from {
+		return in.Intent, fmt.Errorf("%w: %s", ErrInvalidState, in.Status)
+	}
+	in.Status = to(in)
+	return in.Intent, nil
+}
+
+func always(s Status) func(*fakeIntent) Status {
+	return func(*fakeIntent) Status { return s }
+}
+
+func (f *Fake) Confirm(ctx context.Context, intentID string) (Intent, error) {
+	in, err := f.transition(intentID, StatusRequiresConfirmation, func(in *fakeIntent) Status {
+		if in.manualCapture {
+			return StatusRequiresCapture
+		}
+		return StatusSucceeded
+	})
+	if err != nil {
+		return in, err
+	}
+	if in.Status == StatusSucceeded {
+		f.emit(ctx, Event{Type: EventPaymentSucceeded, IntentID: in.ID, Amount: in.Amount})
+	}
+	return in, nil
+}
+
+// Decline — покупатель отказался платить или «банк» отклонил карту (есть только у Fake).
+func (f *Fake) Decline(ctx context.Context, intentID, reason string) (Intent, error) {
+	in, err := f.transition(intentID, StatusRequiresConfirmation, always(StatusFailed))
+	if err != nil {
+		return in, err
+	}
+	f.emit(ctx, Event{Type: EventPaymentFailed, IntentID: in.ID, Amount: in.Amount, Reason: reason})
+	return in, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, intentID string) (Intent, error) {
+	in, err := f.transition(intentID, StatusRequiresCapture, always(StatusSucceeded))
+	if err != nil {
+		return in, err
+	}
+	f.emit(ctx, Event{Type: EventPaymentSucceeded, IntentID: in.ID, Amount: in.Amount})
+	return in, nil
+}
+
+func (f *Fake) Cancel(ctx context.Context, intentID string) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	in, ok := f.intents[intentID]
+	if !ok {
+		return Intent{}, ErrUnknownIntent
+	}
+	switch in.Status {
+	case StatusRequiresConfirmation, StatusRequiresCapture, StatusFailed:
+		in.Status = StatusCanceled
+	case StatusCanceled:
+	default:
+		return in.Intent, fmt.Errorf("%w: %s", ErrInvalidState, in.Status)
+	}
+	return in.Intent, nil
+}
+
+func (f *Fake) Refund(ctx context.Context, intentID string, amount money.Amount) (Refund, error) {
+	f.mu.Lock()
+	in, ok := f.intents[intentID]
+	if !ok {
+		f.mu.Unlock()
+		return Refund{}, ErrUnknownIntent
+	}
+	if in.Status != StatusSucceeded {
+		f.mu.Unlock()
+		return Refund{}, fmt.Errorf("%w: %s", ErrInvalidState, in.Status)
+	}
+	if amount.Currency != in.Amount.Currency || amount.Minor <= 0 || in.Refunded.Minor+amount.Minor > in.Amount.Minor {
+		f.mu.Unlock()
+		return Refund{}, ErrInvalidAmount
+	}
+	in.Refunded.Minor += amount.Minor
+	f.mu.Unlock()
+
+	rf := Refund{ID: randomID("re_fake_"), IntentID: intentID, Amount: amount}
+	f.emit(ctx, Event{Type: EventRefundSucceeded, IntentID: intentID, Amount: amount})
+	return rf, nil
+}
+
+func (f *Fake) VerifyWebhook(payload []byte, header http.Header) (Event, error) {
+	var ev Event
+	if err := verifySignature(f.secret, payload, header.Get(SignatureHeader), time.Now()); err != nil {
+		return ev, err
+	}
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return ev, fmt.Errorf("payment: bad event payload: %w", err)
+	}
+	return ev, nil
+}
+
+// emit подписывает событие и отдаёт его Notifier'у.
+func (f *Fake) emit(ctx context.Context, ev Event) {
+	ev.ID = randomID("evt_fake_")
+	ev.Created = time.Now().UTC().Truncate(time.Second)
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("payment: marshal event error %v", err)
+		return
+	}
+	f.mu.Lock()
+	notify := f.notify
+	f.mu.Unlock()
+	if notify == nil {
+		log.Printf("payment: no notifier, event %s %s dropped", ev.ID, ev.Type)
+		return
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set(SignatureHeader, Sign(f.secret, payload, time.Now()))
+	notify(ctx, payload, header)
+}
+
+// Sign — значение SignatureHeader для тела payload.
+func Sign(secret, payload []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(signature(secret, ts, payload))
+}
+
+func signature(secret []byte, ts string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts + "."))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// verifySignature проверяет подпись и её свежесть (не старше SignatureTolerance).
+func verifySignature(secret, payload []byte, header string, now time.Time) error {
+	var ts string
+	var sigs [][]byte
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			if b, err := hex.DecodeString(v); err == nil {
+				sigs = append(sigs, b)
+			}
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrInvalidSignature
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > SignatureTolerance || d < -SignatureTolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+	want := signature(secret, ts, payload)
+	for _, s := range sigs {
+		if hmac.Equal(s, want) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func randomID(prefix string) string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("payment: crypto/rand failed: " + err.Error())
+	}
+	return prefix + hex.EncodeToString(b)
+}
@@ -0,0 +1,68 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// notifyAttempts и notifyBackoff — сколько раз и с какой паузой (удваивается)
+// повторять доставку, как делают настоящие провайдеры.
+const (
+	notifyAttempts = 5
+	notifyBackoff  = time.Second
+)
+
+// HTTPNotifier доставляет события POST-запросом на url (вебхук магазина) асинхронно:
+// вызывающий не ждёт ответа. Сетевые ошибки, 404 и 5xx повторяются с паузой,
+// 2xx — доставлено, прочие 4xx — событие отвергнуто и больше не отправляется.
+func HTTPNotifier(url string) Notifier {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(_ context.Context, payload []byte, header http.Header) {
+		// контекст вызывающего (запроса покупателя) к этому моменту уже может быть отменён
+		go func() {
+			wait := notifyBackoff
+			for attempt := 1; ; attempt++ {
+				err := deliver(client, url, payload, header)
+				if err == nil {
+					return
+				}
+				if attempt == notifyAttempts || !retryable(err) {
+					log.Printf("payment: webhook delivery to %s failed after %d attempt(s): %v", url, attempt, err)
+					return
+				}
+				time.Sleep(wait)
+				wait *= 2
+			}
+		}()
+	}
+}
+
+type statusError int
+
+func (e statusError) Error() string { return fmt.Sprintf("webhook responded %d", int(e)) }
+
+func retryable(err error) bool {
+	code, ok := err.(statusError)
+	return !ok || code == http.StatusNotFound || code >= 500
+}
+
+func deliver(client *http.Client, url string, payload []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header = header.Clone()
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return statusError(resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Package payment — абстракция платёжного провайдера. Магазин создаёт платёжное
+// намерение (intent) на сумму заказа и отправляет покупателя на страницу провайдера;
+// о результате провайдер сообщает подписанными событиями (вебхуками), и только
+// они меняют состояние заказа.
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aml-709/game-store/internal/money"
+)
+
+// Status — состояние платёжного намерения у провайдера.
+type Status string
+
+const (
+	StatusRequiresConfirmation Status = "requires_confirmation" // ждём подтверждения покупателем
+	StatusRequiresCapture      Status = "requires_capture"      // деньги заблокированы, ждут списания
+	StatusSucceeded            Status = "succeeded"
+	StatusFailed               Status = "failed"
+	StatusCanceled             Status = "canceled" // отменено магазином: оплатить уже нельзя
+)
+
+// EventType — тип события от провайдера.
+type EventType string
+
+const (
+	EventPaymentSucceeded EventType = "payment.succeeded"
+	EventPaymentFailed    EventType = "payment.failed"
+	EventRefundSucceeded  EventType = "refund.succeeded"
+)
+
+var (
+	ErrUnknownIntent    = errors.New("payment: unknown intent")
+	ErrInvalidState     = errors.New("payment: intent is in a wrong state")
+	ErrInvalidAmount    = errors.New("payment: invalid amount")
+	ErrInvalidSignature = errors.New("payment: invalid webhook signature")
+)
+
+// IntentParams — параметры нового платёжного намерения.
+type IntentParams struct {
+	OrderID   int
+	Amount    money.Amount
+	ReturnURL string // куда провайдер вернёт покупателя после оплаты
+	// ManualCapture — только заблокировать деньги при подтверждении; списывает Capture.
+	// По умолчанию списание сразу: игры выдаются моментально.
+	ManualCapture bool
+}
+
+// Intent — платёжное намерение у провайдера.
+type Intent struct {
+	ID          string       `json:"id"`
+	OrderID     int          `json:"order_id"`
+	Status      Status       `json:"status"`
+	Amount      money.Amount `json:"amount"`
+	Refunded    money.Amount `json:"refunded"`
+	RedirectURL string       `json:"redirect_url"` // страница оплаты провайдера
+	ReturnURL   string       `json:"-"`
+}
+
+// Refund — возврат по платежу.
+type Refund struct {
+	ID       string       `json:"id"`
+	IntentID string       `json:"intent_id"`
+	Amount   money.Amount `json:"amount"`
+}
+
+// Event — проверенное событие провайдера.
+type Event struct {
+	ID       string       `json:"id"`
+	Type     EventType    `json:"type"`
+	IntentID string       `json:"intent_id"`
+	Amount   money.Amount `json:"amount"`           // сумма платежа или возврата
+	Reason   string       `json:"reason,omitempty"` // причина отказа
+	Created  time.Time    `json:"created"`
+}
+
+// Provider — платёжный провайдер.
+type Provider interface {
+	// Name — код провайдера, хранится в payments.provider.
+	Name() string
+	CreateIntent(ctx context.Context, p IntentParams) (Intent, error)
+	// Intent — текущее состояние намерения; неизвестное — ErrUnknownIntent.
+	Intent(ctx context.Context, intentID string) (Intent, error)
+	// Confirm подтверждает оплату от имени покупателя.
+	Confirm(ctx context.Context, intentID string) (Intent, error)
+	// Capture списывает заблокированные деньги (для IntentParams.ManualCapture).
+	Capture(ctx context.Context, intentID string) (Intent, error)
+	// Cancel отменяет неоплаченное намерение (и снимает блокировку денег): после отмены
+	// Confirm и Capture — ErrInvalidState. Повторная отмена ничего не меняет; уже списанный
+	// платёж не отменить — ErrInvalidState (его возвращают через Refund).
+	Cancel(ctx context.Context, intentID string) (Intent, error)
+	// Refund возвращает amount по успешному платежу (частично или полностью).
+	Refund(ctx context.Context, intentID string, amount money.Amount) (Refund, error)
+	// VerifyWebhook проверяет подпись тела вебхука и разбирает событие;
+	// неверная подпись — ErrInvalidSignature.
+	VerifyWebhook(payload []byte, header http.Header) (Event, error)
+}
@@ -0,0 +1,163 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+)
+
+// CookieName — имя cookie, в которой хранится непрозрачный токен сессии.
+const CookieName = "session_id"
+
+// ErrNotFound возвращается, если сессии нет, она отозвана или истекла.
+var ErrNotFound = errors.New("session: not found")
+
+// Session — серверная сессия пользователя.
+type Session struct {
+	Token     string // открытый токен; известен только при создании
+	UserID    int
+	CreatedAt time.Time
+	LastSeen  time.Time
+	ExpiresAt time.Time
+	UserAgent string
+	IP        string
+}
+
+// Store хранит сессии в таблице sessions. В базе лежит только
+// sha256 от токена, поэтому утечка games.db не даёт угнать сессию.
+type Store struct {
+	DB  *sql.DB
+	TTL time.Duration
+}
+
+func NewStore(db *sql.DB, ttl time.Duration) *Store {
+	return &Store{DB: db, TTL: ttl}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Create заводит новую сессию для пользователя и возвращает её с открытым токеном.
+func (s *Store) Create(userID int, userAgent, ip string) (*Session, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	sess := &Session{
+		Token:     token,
+		UserID:    userID,
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: now.Add(s.TTL),
+		UserAgent: userAgent,
+		IP:        ip,
+	}
+	_, err = s.DB.Exec(`
+        INSERT INTO sessions (token_hash, user_id, created_at, last_seen_at, expires_at, user_agent, ip)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+    `, hashToken(token), userID, formatTime(sess.CreatedAt), formatTime(sess.LastSeen), formatTime(sess.ExpiresAt), userAgent, ip)
+	if err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Get ищет действующую сессию по токену и обновляет время последнего обращения.
+func (s *Store) Get(token string) (*Session, error) {
+	if token == "" {
+		return nil, ErrNotFound
+	}
+	th := hashToken(token)
+	var sess Session
+	var createdAt, lastSeen, expiresAt string
+	err := s.DB.QueryRow(`
+        SELECT user_id, created_at, last_seen_at, expires_at, user_agent, ip
+        FROM sessions
+        WHERE token_hash = ?
+    `, th).Scan(&sess.UserID, &createdAt, &lastSeen, &expiresAt, &sess.UserAgent, &sess.IP)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	sess.Token = token
+	sess.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	sess.LastSeen, _ = time.Parse(time.RFC3339, lastSeen)
+	sess.ExpiresAt, _ = time.Parse(time.RFC3339, expiresAt)
+
+	now := time.Now().UTC()
+	if !now.Before(sess.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	// не пишем в базу на каждый запрос — достаточно раз в минуту
+	if now.Sub(sess.LastSeen) > time.Minute {
+		sess.LastSeen = now.Truncate(time.Second)
+		if _, err := s.DB.Exec("UPDATE sessions SET last_seen_at = ? WHERE token_hash = ?", formatTime(sess.LastSeen), th); err != nil {
+			log.Printf("session: touch error: %v", err)
+		}
+	}
+	return &sess, nil
+}
+
+// Revoke удаляет сессию (logout). Отсутствие сессии ошибкой не считается.
+func (s *Store) Revoke(token string) error {
+	if token == "" {
+		return nil
+	}
+	_, err := s.DB.Exec("DELETE FROM sessions WHERE token_hash = ?", hashToken(token))
+	return err
+}
+
+// DeleteExpired удаляет все истёкшие сессии и возвращает их количество.
+func (s *Store) DeleteExpired() (int64, error) {
+	res, err := s.DB.Exec("DELETE FROM sessions WHERE expires_at <= ?", formatTime(time.Now()))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// StartSweeper периодически чистит истёкшие сессии в фоне.
+// Возвращает функцию остановки.
+func (s *Store) StartSweeper(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				n, err := s.DeleteExpired()
+				if err != nil {
+					log.Printf("session sweeper: %v", err)
+				} else if n > 0 {
+					log.Printf("session sweeper: removed %d expired sessions", n)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+)
+
+// GameFilter — фильтры каталога. Внутри фасета значения объединяются через ИЛИ,
+// разные фасеты — через И. Нулевые значения означают «не фильтровать».
+type GameFilter struct {
+	Genres    []string // slug'и жанров
+	Tags      []string // slug'и тегов
+	MinPrice  int64    // в минорных единицах Currency, включительно
+	MaxPrice  int64
+	MinRating int            // средняя оценка отзывов не ниже, 1..5
+	Currency  money.Currency // валюта цен, фильтра и сортировки; пусто — базовые цены
+}
+
+// GameSort — порядок выдачи каталога.
+type GameSort string
+
+const (
+	SortNewest      GameSort = "newest"
+	SortPriceAsc    GameSort = "price_asc"
+	SortPriceDesc   GameSort = "price_desc"
+	SortTitle       GameSort = "title"
+	SortRating      GameSort = "rating"
+	SortBestselling GameSort = "bestselling"
+)
+
+// GameSorts — все режимы сортировки в порядке показа.
+var GameSorts = []GameSort{SortNewest, SortPriceAsc, SortPriceDesc, SortTitle, SortRating, SortBestselling}
+
+func (s GameSort) Valid() bool {
+	for _, x := range GameSorts {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Размер страницы каталога: по умолчанию и максимальный.
+const (
+	DefaultPerPage = 24
+	MaxPerPage     = 96
+)
+
+// GameQuery — фильтр, сортировка и страница каталога (Page считается с 1).
+type GameQuery struct {
+	GameFilter
+	Sort    GameSort
+	Page    int
+	PerPage int
+}
+
+// normalize подставляет значения по умолчанию и ограничивает размер страницы.
+func (q GameQuery) normalize() GameQuery {
+	if !q.Sort.Valid() {
+		q.Sort = SortNewest
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PerPage < 1 {
+		q.PerPage = DefaultPerPage
+	}
+	if q.PerPage > MaxPerPage {
+		q.PerPage = MaxPerPage
+	}
+	return q
+}
+
+// soldSubquery — сколько копий игры продано в оплаченных заказах (и в составе наборов).
+const soldSubquery = `SELECT ig.game_id, SUM(COALESCE(pi.quantity, 1)) AS sold
+    FROM (` + itemGames + `) ig JOIN purchase_items pi ON pi.id = ig.item_id JOIN purchases p ON p.id = pi.purchase_id
+    WHERE p.status = 'paid' GROUP BY ig.game_id`
+
+// orderBy — JOIN и ORDER BY для сортировки; при равенстве новые игры первыми.
+func (s GameSort) orderBy() (join, order string) {
+	switch s {
+	case SortPriceAsc:
+		return "", "g.price_minor IS NULL, g.price_minor ASC, g.id DESC"
+	case SortPriceDesc:
+		return "", "g.price_minor IS NULL, g.price_minor DESC, g.id DESC"
+	case SortTitle:
+		return "", "g.title COLLATE NOCASE ASC, g.id DESC"
+	case SortRating:
+		return " LEFT JOIN (" + ratingSubquery + ") rt ON rt.game_id = g.id", "rt.avg_rating IS NULL, rt.avg_rating DESC, g.id DESC"
+	case SortBestselling:
+		return " LEFT JOIN (" + soldSubquery + ") s ON s.game_id = g.id", "COALESCE(s.sold, 0) DESC, g.id DESC"
+	}
+	return "", "g.id DESC"
+}
+
+// priceBuckets — границы диапазонов фасета цены по валютам, в минорных единицах;
+// верхняя граница 0 — без ограничения.
+var priceBuckets = map[money.Currency][][2]int64{
+	money.USD: {{0, 999}, {1000, 2999}, {3000, 5999}, {6000, 0}},
+	money.EUR: {{0, 999}, {1000, 2999}, {3000, 5999}, {6000, 0}},
+	money.RUB: {{0, 49999}, {50000, 149999}, {150000, 299999}, {300000, 0}},
+}
+
+// PriceBuckets — ценовые диапазоны фасета цены в валюте c; Max == 0 — без верхней границы.
+// Для пустой или неизвестной валюты — диапазоны валюты по умолчанию.
+func PriceBuckets(c money.Currency) []models.PriceFacet {
+	bounds, ok := priceBuckets[c]
+	if !ok {
+		c = money.Default
+		bounds = priceBuckets[c]
+	}
+	out := make([]models.PriceFacet, len(bounds))
+	for i, b := range bounds {
+		out[i] = models.PriceFacet{Min: money.New(b[0], c)}
+		if b[1] > 0 {
+			out[i].Max = money.New(b[1], c)
+		}
+	}
+	return out
+}
+
+// RatingSteps — пороги фасета оценки («от 4 и выше» и т.д.).
+var RatingSteps = []int{4, 3, 2, 1}
+
+type facet int
+
+const (
+	facetNone facet = iota
+	facetGenre
+	facetTag
+	facetPrice
+	facetRating
+)
+
+// qualifiedGameColumns — gameColumns с алиасом g, для запросов с JOIN.
+const qualifiedGameColumns = "g.id, g.title, g.description, g.price_minor, g.currency, g.image_url, g.published, g.list_price_minor"
+
+// ratingSubquery — средняя оценка по отзывам; игры без оценок в него не попадают.
+const ratingSubquery = "SELECT game_id, AVG(rating) AS avg_rating FROM comments WHERE rating IS NOT NULL GROUP BY game_id"
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func stringArgs(ss []string) []any {
+	out := make([]any, len(ss))
+	for i, s := range ss {
+		out[i] = s
+	}
+	return out
+}
+
+// where строит условие для games g по фильтру, пропуская фасет skip
+// (так считаются счётчики: выбор внутри фасета не обнуляет соседние значения).
+func (f GameFilter) where(skip facet) (string, []any) {
+	conds := []string{"g.published = 1"}
+	var args []any
+	if len(f.Genres) > 0 && skip != facetGenre {
+		conds = append(conds, `g.id IN (SELECT l.game_id FROM game_genres l JOIN genres t ON t.id = l.genre_id
+            WHERE t.slug IN (`+placeholders(len(f.Genres))+`))`)
+		args = append(args, stringArgs(f.Genres)...)
+	}
+	if len(f.Tags) > 0 && skip != facetTag {
+		conds = append(conds, `g.id IN (SELECT l.game_id FROM game_tags l JOIN tags t ON t.id = l.tag_id
+            WHERE t.slug IN (`+placeholders(len(f.Tags))+`))`)
+		args = append(args, stringArgs(f.Tags)...)
+	}
+	if skip != facetPrice {
+		if f.MinPrice > 0 {
+			conds = append(conds, "g.price_minor >= ?")
+			args = append(args, f.MinPrice)
+		}
+		if f.MaxPrice > 0 {
+			conds = append(conds, "g.price_minor <= ?")
+			args = append(args, f.MaxPrice)
+		}
+	}
+	if f.MinRating > 0 && skip != facetRating {
+		conds = append(conds, "g.id IN (SELECT game_id FROM ("+ratingSubquery+") WHERE avg_rating >= ?)")
+		args = append(args, f.MinRating)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func (r *gameRepo) Browse(ctx context.Context, q GameQuery) ([]models.Game, int, error) {
+	q = q.normalize()
+	from, args := pricedGames(q.Currency, priceTime(ctx))
+	where, whereArgs := q.where(facetNone)
+	args = append(args, whereArgs...)
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+from+" WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	join, order := q.Sort.orderBy()
+	games, err := r.query(ctx, "SELECT "+qualifiedGameColumns+" FROM "+from+join+" WHERE "+where+" ORDER BY "+order+" LIMIT ? OFFSET ?",
+		append(args, q.PerPage, (q.Page-1)*q.PerPage)...)
+	return games, total, err
+}
+
+func (r *gameRepo) Facets(ctx context.Context, f GameFilter) (models.Facets, error) {
+	var out models.Facets
+	var err error
+	if out.Genres, err = r.termFacets(ctx, genreTables, f, facetGenre); err != nil {
+		return out, err
+	}
+	if out.Tags, err = r.termFacets(ctx, tagTables, f, facetTag); err != nil {
+		return out, err
+	}
+
+	from, fromArgs := pricedGames(f.Currency, priceTime(ctx))
+	where, args := f.where(facetPrice)
+	var cols []string
+	var bucketArgs []any
+	buckets := PriceBuckets(f.Currency)
+	for _, b := range buckets {
+		if !b.Max.IsZero() {
+			cols = append(cols, "COALESCE(SUM(g.price_minor >= ? AND g.price_minor <= ?), 0)")
+			bucketArgs = append(bucketArgs, b.Min.Minor, b.Max.Minor)
+		} else {
+			cols = append(cols, "COALESCE(SUM(g.price_minor >= ?), 0)")
+			bucketArgs = append(bucketArgs, b.Min.Minor)
+		}
+	}
+	out.Prices = buckets
+	dest := make([]any, len(out.Prices))
+	for i := range out.Prices {
+		dest[i] = &out.Prices[i].Count
+	}
+	q := "SELECT " + strings.Join(cols, ", ") + " FROM " + from + " WHERE " + where
+	if err := r.db.QueryRowContext(ctx, q, append(append(bucketArgs, fromArgs...), args...)...).Scan(dest...); err != nil {
+		return out, err
+	}
+
+	where, args = f.where(facetRating)
+	cols, bucketArgs = cols[:0], bucketArgs[:0]
+	out.Ratings = make([]models.RatingFacet, len(RatingSteps))
+	dest = make([]any, len(RatingSteps))
+	for i, min := range RatingSteps {
+		cols = append(cols, "COALESCE(SUM(rt.avg_rating >= ?), 0)")
+		bucketArgs = append(bucketArgs, min)
+		out.Ratings[i].Min = min
+		dest[i] = &out.Ratings[i].Count
+	}
+	q = "SELECT " + strings.Join(cols, ", ") + " FROM " + from + " JOIN (" + ratingSubquery + ") rt ON rt.game_id = g.id WHERE " + where
+	err = r.db.QueryRowContext(ctx, q, append(append(bucketArgs, fromArgs...), args...)...).Scan(dest...)
+	return out, err
+}
+
+// termFacets — все жанры (или теги) с числом игр, подходящих под остальные фильтры.
+func (r *gameRepo) termFacets(ctx context.Context, t termTables, f GameFilter, self facet) ([]models.TermFacet, error) {
+	from, args := pricedGames(f.Currency, priceTime(ctx))
+	where, whereArgs := f.where(self)
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT t.id, t.name, t.slug, COUNT(g.id)
+        FROM `+t.table+` t
+        LEFT JOIN `+t.link+` l ON l.`+t.fk+` = t.id
+        LEFT JOIN `+from+` ON g.id = l.game_id AND `+where+`
+        GROUP BY t.id
+        ORDER BY t.name`, append(args, whereArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.TermFacet
+	for rows.Next() {
+		var tf models.TermFacet
+		if err := rows.Scan(&tf.ID, &tf.Name, &tf.Slug, &tf.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, tf)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+type bundleRepo struct {
+	db *sql.DB
+}
+
+func NewBundleRepo(db *sql.DB) BundleRepo {
+	return &bundleRepo{db: db}
+}
+
+const bundleSelect = "SELECT b.id, b.title, b.description, b.image_url, b.price_minor, b.currency, b.published, b.created_at FROM bundles b"
+
+func scanBundle(s rowScanner) (models.Bundle, error) {
+	var b models.Bundle
+	var created string
+	err := s.Scan(&b.ID, &b.Title, &b.Description, &b.ImageURL, &b.Price.Minor, &b.Price.Currency, &b.Published, &created)
+	if err == sql.ErrNoRows {
+		return b, ErrNotFound
+	}
+	b.CreatedAt = parseTime(created)
+	return b, err
+}
+
+// itemGames — какие игры выдаёт каждая позиция заказа: свою игру или игры набора,
+// которых у покупателя не было при оформлении.
+const itemGames = `SELECT id AS item_id, game_id FROM purchase_items WHERE game_id IS NOT NULL
+    UNION ALL SELECT purchase_item_id, game_id FROM purchase_bundle_games`
+
+// bundleGames загружает игры набора b с обычными ценами в валюте набора и отмечает те,
+// что уже есть в библиотеке userID (0 — никого).
+func bundleGames(ctx context.Context, q dbtx, b *models.Bundle, userID int) error {
+	from, fromArgs := pricedGames(b.Price.Currency, time.Now())
+	args := append([]any{userID}, fromArgs...)
+	rows, err := q.QueryContext(ctx, `
+        SELECT g.id, g.title, COALESCE(g.list_price_minor, 0),
+               EXISTS(SELECT 1 FROM user_games ug WHERE ug.user_id = ? AND ug.game_id = g.id)
+        FROM bundle_games bg
+        JOIN `+from+` ON g.id = bg.game_id
+        WHERE bg.bundle_id = ?
+        ORDER BY g.title COLLATE NOCASE`, append(args, b.ID)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	b.Games = nil
+	for rows.Next() {
+		bg := models.BundleGame{}
+		if err := rows.Scan(&bg.ID, &bg.Title, &bg.Price.Minor, &bg.Owned); err != nil {
+			return err
+		}
+		bg.Price.Currency = b.Price.Currency
+		b.Games = append(b.Games, bg)
+	}
+	return rows.Err()
+}
+
+func (r *bundleRepo) list(ctx context.Context, where string, args ...any) ([]models.Bundle, error) {
+	rows, err := r.db.QueryContext(ctx, bundleSelect+" WHERE "+where+" ORDER BY b.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	var out []models.Bundle
+	for rows.Next() {
+		b, err := scanBundle(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		if err := bundleGames(ctx, r.db, &out[i], 0); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (r *bundleRepo) List(ctx context.Context, all bool) ([]models.Bundle, error) {
+	if all {
+		return r.list(ctx, "1 = 1")
+	}
+	return r.list(ctx, "b.published = 1")
+}
+
+func (r *bundleRepo) ByGame(ctx context.Context, gameID int) ([]models.Bundle, error) {
+	return r.list(ctx, "b.published = 1 AND b.id IN (SELECT bundle_id FROM bundle_games WHERE game_id = ?)", gameID)
+}
+
+func (r *bundleRepo) Get(ctx context.Context, id, userID int) (models.Bundle, error) {
+	return getBundle(ctx, r.db, id, userID)
+}
+
+// getBundle — набор с играми (см. bundleGames); работает и внутри транзакции оформления.
+func getBundle(ctx context.Context, q dbtx, id, userID int) (models.Bundle, error) {
+	b, err := scanBundle(q.QueryRowContext(ctx, bundleSelect+" WHERE b.id = ?", id))
+	if err != nil {
+		return b, err
+	}
+	return b, bundleGames(ctx, q, &b, userID)
+}
+
+// saveBundleGames заменяет состав набора на игры из b.Games (важны только ID).
+func saveBundleGames(ctx context.Context, tx dbtx, b models.Bundle) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM bundle_games WHERE bundle_id = ?", b.ID); err != nil {
+		return err
+	}
+	for _, g := range b.Games {
+		if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO bundle_games (bundle_id, game_id) VALUES (?, ?)", b.ID, g.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *bundleRepo) Create(ctx context.Context, b *models.Bundle) error {
+	b.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "INSERT INTO bundles (title, description, image_url, price_minor, currency, published, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			b.Title, b.Description, b.ImageURL, b.Price.Minor, b.Price.Currency, b.Published, formatTime(b.CreatedAt))
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		b.ID = int(id)
+		return saveBundleGames(ctx, tx, *b)
+	})
+}
+
+func (r *bundleRepo) Update(ctx context.Context, b models.Bundle) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE bundles SET title = ?, description = ?, image_url = ?, price_minor = ?, currency = ?, published = ? WHERE id = ?",
+			b.Title, b.Description, b.ImageURL, b.Price.Minor, b.Price.Currency, b.Published, b.ID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		if !b.Published {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM cart_items WHERE bundle_id = ?", b.ID); err != nil {
+				return err
+			}
+		}
+		return saveBundleGames(ctx, tx, b)
+	})
+}
+
+func (r *bundleRepo) SetPublished(ctx context.Context, id int, published bool) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE bundles SET published = ? WHERE id = ?", published, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		if !published {
+			// снятый набор нельзя купить — убираем его из корзин
+			_, err = tx.ExecContext(ctx, "DELETE FROM cart_items WHERE bundle_id = ?", id)
+		}
+		return err
+	})
+}
+
+func (r *bundleRepo) Delete(ctx context.Context, id int) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		var sold bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM purchase_items WHERE bundle_id = ?)", id).Scan(&sold); err != nil {
+			return err
+		}
+		if sold {
+			return ErrBundleSold
+		}
+		for _, q := range []string{
+			"DELETE FROM cart_items WHERE bundle_id = ?",
+			"DELETE FROM bundle_games WHERE bundle_id = ?",
+		} {
+			if _, err := tx.ExecContext(ctx, q, id); err != nil {
+				return err
+			}
+		}
+		res, err := tx.ExecContext(ctx, "DELETE FROM bundles WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
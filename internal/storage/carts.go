@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+)
+
+type cartRepo struct {
+	db *sql.DB
+}
+
+func NewCartRepo(db *sql.DB) CartRepo {
+	return &cartRepo{db: db}
+}
+
+func (r *cartRepo) Items(ctx context.Context, userID int, cur money.Currency) ([]models.CartItem, error) {
+	items, _, _, err := quoteCart(ctx, r.db, userID, cur, "", priceTime(ctx))
+	return items, err
+}
+
+func (r *cartRepo) Quote(ctx context.Context, userID int, cur money.Currency, coupon string) ([]models.CartItem, []models.AppliedPromotion, error) {
+	items, _, applied, err := quoteCart(ctx, r.db, userID, cur, coupon, priceTime(ctx))
+	return items, applied, err
+}
+
+// quoteCart — строки корзины по ценам и со скидками, действующими в момент at, сами эти скидки
+// и то, сколько каждая из них дала. Купон, который ничего не снизил, — ErrCouponNotApplicable.
+func quoteCart(ctx context.Context, q dbtx, userID int, cur money.Currency, coupon string, at time.Time) ([]models.CartItem, []models.Promotion, []models.AppliedPromotion, error) {
+	items, err := cartItems(ctx, q, userID, cur, at)
+	if err != nil || len(items) == 0 {
+		return items, nil, nil, err
+	}
+	promos, err := applicablePromotions(ctx, q, userID, coupon, at)
+	if err != nil {
+		return items, nil, nil, err
+	}
+	applied := models.ApplyPromotions(items, promos)
+	if strings.TrimSpace(coupon) == "" {
+		return items, promos, applied, nil
+	}
+	for _, ap := range applied {
+		if ap.Code != "" {
+			return items, promos, applied, nil
+		}
+	}
+	return items, promos, applied, ErrCouponNotApplicable
+}
+
+// cartItems работает и с *sql.DB, и внутри транзакции оформления заказа.
+func cartItems(ctx context.Context, q dbtx, userID int, cur money.Currency, at time.Time) ([]models.CartItem, error) {
+	from, args := pricedGames(cur, at)
+	rows, err := q.QueryContext(ctx, `
+        SELECT c.id, g.id, g.title, g.price_minor, g.list_price_minor, g.currency, g.image_url, c.quantity, c.gift,
+               c.gift = 0 AND EXISTS(SELECT 1 FROM user_games ug WHERE ug.user_id = c.user_id AND ug.game_id = c.game_id)
+        FROM cart_items c
+        JOIN `+from+` ON g.id = c.game_id
+        WHERE c.user_id = ?
+        ORDER BY c.id
+    `, append(args, userID)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []models.CartItem
+	for rows.Next() {
+		var it models.CartItem
+		var image sql.NullString
+		var price, list sql.NullInt64
+		if err := rows.Scan(&it.ID, &it.GameID, &it.Title, &price, &list, &it.Price.Currency, &image, &it.Quantity, &it.Gift, &it.Owned); err != nil {
+			return nil, err
+		}
+		it.ImageURL = image.String
+		it.Price.Minor, it.Unavailable = price.Int64, !price.Valid
+		it.OriginalPrice = originalPrice(it.Price, list)
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return cartBundles(ctx, q, userID, cur, items)
+}
+
+// cartBundles дописывает к строкам корзины items наборы из неё (в порядке строк корзины).
+// Игры набора, которые уже есть в библиотеке, лежат в корзине отдельно (личной копией)
+// или входят в набор выше, считаются купленными: вычитаются из цены и не выдаются дважды.
+func cartBundles(ctx context.Context, q dbtx, userID int, cur money.Currency, items []models.CartItem) ([]models.CartItem, error) {
+	rows, err := q.QueryContext(ctx, "SELECT c.id, c.bundle_id FROM cart_items c WHERE c.user_id = ? AND c.bundle_id IS NOT NULL ORDER BY c.id", userID)
+	if err != nil {
+		return nil, err
+	}
+	type line struct{ id, bundleID int }
+	var lines []line
+	for rows.Next() {
+		var l line
+		if err := rows.Scan(&l.id, &l.bundleID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(lines) == 0 {
+		return items, err
+	}
+
+	taken := map[int]bool{}
+	for _, it := range items {
+		if !it.Gift {
+			taken[it.GameID] = true
+		}
+	}
+	for _, l := range lines {
+		b, err := getBundle(ctx, q, l.bundleID, userID)
+		if err != nil {
+			return nil, err
+		}
+		for i, g := range b.Games {
+			b.Games[i].Owned = g.Owned || taken[g.ID]
+			taken[g.ID] = true
+		}
+		it := models.CartItem{
+			ID: l.id, BundleID: b.ID, Title: b.Title, ImageURL: b.ImageURL, Quantity: 1,
+			Owned: b.OwnedAll(), BundleGames: b.Granted(),
+		}
+		if b.Price.Currency != cur {
+			it.Price, it.Unavailable = money.New(0, cur), true
+		} else if it.Price = b.NetPrice(); it.Price != b.Price {
+			it.OriginalPrice = b.Price
+		}
+		items = append(items, it)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items, nil
+}
+
+func (r *cartRepo) Add(ctx context.Context, userID, gameID, qty int, gift bool) error {
+	if gift {
+		// upsert: если есть — увеличить, но не больше MaxGiftCopies (UNIQUE(user_id, game_id, gift) с миграции 0013)
+		_, err := r.db.ExecContext(ctx, `
+            INSERT INTO cart_items (user_id, game_id, quantity, gift)
+            VALUES (?, ?, MIN(?, ?), 1)
+            ON CONFLICT(user_id, game_id, gift) DO UPDATE SET quantity = MIN(quantity + excluded.quantity, ?)
+        `, userID, gameID, qty, models.MaxGiftCopies, models.MaxGiftCopies)
+		return err
+	}
+	// личная копия — всегда одна и только если игры ещё нет в библиотеке
+	res, err := r.db.ExecContext(ctx, `
+        INSERT INTO cart_items (user_id, game_id, quantity, gift)
+        SELECT ?, ?, 1, 0
+        WHERE NOT EXISTS (SELECT 1 FROM user_games WHERE user_id = ? AND game_id = ?)
+        ON CONFLICT(user_id, game_id, gift) DO UPDATE SET quantity = 1
+    `, userID, gameID, userID, gameID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAlreadyOwned
+	}
+	return nil
+}
+
+func (r *cartRepo) AddBundle(ctx context.Context, userID, bundleID int) error {
+	b, err := getBundle(ctx, r.db, bundleID, userID)
+	if err != nil {
+		return err
+	}
+	if b.OwnedAll() {
+		return ErrAlreadyOwned
+	}
+	_, err = r.db.ExecContext(ctx, `
+        INSERT INTO cart_items (user_id, bundle_id, quantity, gift) VALUES (?, ?, 1, 0)
+        ON CONFLICT(user_id, bundle_id) DO NOTHING
+    `, userID, bundleID)
+	return err
+}
+
+func (r *cartRepo) Remove(ctx context.Context, userID, itemID int) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM cart_items WHERE id = ? AND user_id = ?", itemID, userID)
+	return err
+}
+
+func (r *cartRepo) RemoveGame(ctx context.Context, userID, gameID int) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM cart_items WHERE user_id = ? AND game_id = ?", userID, gameID)
+	return err
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aml-709/game-store/internal/money"
+)
+
+func TestAddOwnedGame(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	game := addGame(t, r, "Doom", 1999)
+	payOrder(t, r, placeOrder(t, r, uid, game))
+
+	if err := r.Carts.Add(ctx, uid, game, 1, false); !errors.Is(err, ErrAlreadyOwned) {
+		t.Errorf("personal copy of an owned game: err = %v, want ErrAlreadyOwned", err)
+	}
+	// подарить купленную игру можно, копии складываются
+	for range 2 {
+		if err := r.Carts.Add(ctx, uid, game, 2, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := r.Carts.Items(ctx, uid, money.USD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || !items[0].Gift || items[0].Quantity != 4 {
+		t.Errorf("cart = %+v, want one gift line for 4 copies", items)
+	}
+}
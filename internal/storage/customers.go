@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+)
+
+type customerRepo struct {
+	db *sql.DB
+}
+
+func NewCustomerRepo(db *sql.DB) CustomerRepo {
+	return &customerRepo{db: db}
+}
+
+const customerColumns = "id, username, password, role, COALESCE(currency, ''), COALESCE(email, '')"
+
+func scanCustomer(s rowScanner) (models.Customer, error) {
+	var c models.Customer
+	err := s.Scan(&c.ID, &c.Username, &c.PasswordHash, &c.Role, &c.Currency, &c.Email)
+	if err == sql.ErrNoRows {
+		return c, ErrNotFound
+	}
+	return c, err
+}
+
+func (r *customerRepo) Create(ctx context.Context, username, passwordHash string) (models.Customer, error) {
+	res, err := r.db.ExecContext(ctx, "INSERT INTO customers (username, password) VALUES (?, ?)", username, passwordHash)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return models.Customer{}, ErrUsernameTaken
+		}
+		return models.Customer{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.Customer{}, err
+	}
+	return models.Customer{ID: int(id), Username: username, PasswordHash: passwordHash, Role: models.RoleCustomer}, nil
+}
+
+func (r *customerRepo) Get(ctx context.Context, id int) (models.Customer, error) {
+	return scanCustomer(r.db.QueryRowContext(ctx, "SELECT "+customerColumns+" FROM customers WHERE id = ?", id))
+}
+
+func (r *customerRepo) GetByUsername(ctx context.Context, username string) (models.Customer, error) {
+	return scanCustomer(r.db.QueryRowContext(ctx, "SELECT "+customerColumns+" FROM customers WHERE username = ?", username))
+}
+
+func (r *customerRepo) GetByEmail(ctx context.Context, email string) (models.Customer, error) {
+	return scanCustomer(r.db.QueryRowContext(ctx, "SELECT "+customerColumns+" FROM customers WHERE email = ?", strings.ToLower(email)))
+}
+
+func (r *customerRepo) List(ctx context.Context) ([]models.Customer, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+customerColumns+" FROM customers ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Customer
+	for rows.Next() {
+		c, err := scanCustomer(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (r *customerRepo) UpdatePassword(ctx context.Context, id int, passwordHash string) error {
+	return r.exec(ctx, "UPDATE customers SET password = ? WHERE id = ?", passwordHash, id)
+}
+
+func (r *customerRepo) SetRole(ctx context.Context, id int, role models.Role) error {
+	return r.exec(ctx, "UPDATE customers SET role = ? WHERE id = ?", string(role), id)
+}
+
+func (r *customerRepo) SetCurrency(ctx context.Context, id int, cur money.Currency) error {
+	return r.exec(ctx, "UPDATE customers SET currency = ? WHERE id = ?", string(cur), id)
+}
+
+func (r *customerRepo) SetEmail(ctx context.Context, id int, email string) error {
+	// email хранится в нижнем регистре — так уникальный индекс не пропустит тот же адрес иначе написанным
+	err := r.exec(ctx, "UPDATE customers SET email = ? WHERE id = ?", nullable(strings.ToLower(email)), id)
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+func (r *customerRepo) exec(ctx context.Context, q string, args ...any) error {
+	res, err := r.db.ExecContext(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
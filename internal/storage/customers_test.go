@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+func TestCustomerRepo(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	id := addCustomer(t, r, "eve")
+
+	if _, err := r.Customers.Create(ctx, "eve", "other"); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("duplicate username: err = %v, want ErrUsernameTaken", err)
+	}
+	c, err := r.Customers.GetByUsername(ctx, "eve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ID != id || c.PasswordHash != "hash" || c.Role != models.RoleCustomer {
+		t.Errorf("GetByUsername = %+v", c)
+	}
+	if err := r.Customers.SetRole(ctx, id, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := r.Customers.Get(ctx, id); err != nil || c.Role != models.RoleAdmin {
+		t.Errorf("Get after SetRole = %+v, %v; want admin", c, err)
+	}
+	if _, err := r.Customers.Get(ctx, id+100); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing customer: err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// maxExpiryInterval — как часто (не реже) проверять неоплаченные заказы.
+const maxExpiryInterval = 5 * time.Minute
+
+// StartOrderExpiry в фоне переводит в «просрочен» заказы, не оплаченные за ttl с создания или
+// последней попытки оплаты (и при restoreCart возвращает их позиции в корзину), отменяя через void
+// их намерения у провайдера. Первая проверка — сразу, чтобы догнать заказы, просроченные, пока
+// сервер не работал. Возвращает функцию остановки.
+func StartOrderExpiry(orders OrderRepo, ttl time.Duration, restoreCart bool, void VoidFunc) (stop func()) {
+	interval := min(ttl, maxExpiryInterval)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			expired, err := orders.ExpireUnpaid(context.Background(), time.Now().Add(-ttl), restoreCart, void)
+			if err != nil {
+				log.Printf("order expiry: %v", err)
+			}
+			if len(expired) > 0 {
+				log.Printf("order expiry: expired %d unpaid orders %v", len(expired), expired)
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
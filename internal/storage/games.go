@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+)
+
+type gameRepo struct {
+	db *sql.DB
+}
+
+func NewGameRepo(db *sql.DB) GameRepo {
+	return &gameRepo{db: db}
+}
+
+// gameColumns — для запросов к самой games: обычная цена без календаря цен (list_price_minor совпадает с ней).
+const gameColumns = "id, title, description, price_minor, currency, image_url, published, price_minor"
+
+// pricedGames — источник «games g», в котором price_minor и currency — цена в валюте cur
+// на момент at: региональная из game_prices, иначе базовая, если она в той же валюте,
+// иначе NULL (в этой валюте игра не продаётся), сниженная по изменениям цены из price_changes,
+// которые идут в этот момент. list_price_minor — цена без изменений. Пустая cur — базовые цены.
+func pricedGames(cur money.Currency, at time.Time) (string, []any) {
+	base, args := "games", []any(nil)
+	if cur != "" {
+		base = `(SELECT g.id, g.title, g.description, g.image_url, g.published,
+                COALESCE(gp.price_minor, CASE WHEN g.currency = ? THEN g.price_minor END) AS price_minor,
+                ? AS currency
+            FROM games g LEFT JOIN game_prices gp ON gp.game_id = g.id AND gp.currency = ?)`
+		args = []any{cur, cur, cur}
+	}
+	// MIN(NULL, ...) — NULL: игра без цены в валюте так и остаётся без цены
+	t := formatTime(at)
+	return `(SELECT b.id, b.title, b.description, b.image_url, b.published, b.currency,
+            b.price_minor AS list_price_minor,
+            MIN(b.price_minor, COALESCE((
+                SELECT MIN(CASE WHEN pc.percent > 0 THEN b.price_minor - b.price_minor * pc.percent / 100
+                                WHEN pc.currency = b.currency THEN pc.price_minor END)
+                FROM price_changes pc
+                WHERE pc.game_id = b.id AND pc.starts_at <= ? AND pc.ends_at > ?), b.price_minor)) AS price_minor
+        FROM ` + base + ` b) g`, append([]any{t, t}, args...)
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanGame(s rowScanner) (models.Game, error) {
+	var g models.Game
+	var description, image sql.NullString
+	var price, list sql.NullInt64
+	if err := s.Scan(&g.ID, &g.Title, &description, &price, &g.Price.Currency, &image, &g.Published, &list); err != nil {
+		return g, err
+	}
+	g.Description = description.String
+	g.ImageURL = image.String
+	g.Price.Minor, g.Unavailable = price.Int64, !price.Valid
+	g.OriginalPrice = originalPrice(g.Price, list)
+	return g, nil
+}
+
+// originalPrice — обычная цена list, если цена price снижена по календарю цен; иначе нулевая.
+func originalPrice(price money.Amount, list sql.NullInt64) money.Amount {
+	if !list.Valid || list.Int64 <= price.Minor {
+		return money.Amount{}
+	}
+	return money.New(list.Int64, price.Currency)
+}
+
+func (r *gameRepo) query(ctx context.Context, q string, args ...any) ([]models.Game, error) {
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var games []models.Game
+	for rows.Next() {
+		g, err := scanGame(rows)
+		if err != nil {
+			return nil, err
+		}
+		games = append(games, g)
+	}
+	return games, rows.Err()
+}
+
+func (r *gameRepo) Latest(ctx context.Context, cur money.Currency, limit int) ([]models.Game, error) {
+	from, args := pricedGames(cur, priceTime(ctx))
+	return r.query(ctx, "SELECT "+qualifiedGameColumns+" FROM "+from+" WHERE g.published = 1 ORDER BY g.id DESC LIMIT ?", append(args, limit)...)
+}
+
+func (r *gameRepo) ListAll(ctx context.Context) ([]models.Game, error) {
+	return r.query(ctx, "SELECT "+gameColumns+" FROM games ORDER BY id DESC")
+}
+
+func (r *gameRepo) Get(ctx context.Context, id int, cur money.Currency) (models.Game, error) {
+	from, args := pricedGames(cur, priceTime(ctx))
+	g, err := scanGame(r.db.QueryRowContext(ctx, "SELECT "+qualifiedGameColumns+" FROM "+from+" WHERE g.id = ?", append(args, id)...))
+	if err == sql.ErrNoRows {
+		return g, ErrNotFound
+	}
+	if err != nil {
+		return g, err
+	}
+	if g.Genres, err = gameTerms(ctx, r.db, genreTables, id); err != nil {
+		return g, err
+	}
+	if g.Tags, err = gameTerms(ctx, r.db, tagTables, id); err != nil {
+		return g, err
+	}
+	g.Prices, err = gamePrices(ctx, r.db, id)
+	return g, err
+}
+
+func gamePrices(ctx context.Context, q dbtx, gameID int) ([]money.Amount, error) {
+	rows, err := q.QueryContext(ctx, "SELECT price_minor, currency FROM game_prices WHERE game_id = ? ORDER BY currency", gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []money.Amount
+	for rows.Next() {
+		var a money.Amount
+		if err := rows.Scan(&a.Minor, &a.Currency); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// saveTerms записывает жанры, теги и региональные цены игры.
+func saveTerms(ctx context.Context, tx dbtx, g models.Game) error {
+	if err := setGameTerms(ctx, tx, genreTables, g.ID, g.Genres); err != nil {
+		return err
+	}
+	if err := setGameTerms(ctx, tx, tagTables, g.ID, g.Tags); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM game_prices WHERE game_id = ?", g.ID); err != nil {
+		return err
+	}
+	for _, p := range g.Prices {
+		if p.Currency == g.Price.Currency {
+			continue // цена в базовой валюте хранится в games
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT OR REPLACE INTO game_prices (game_id, currency, price_minor) VALUES (?, ?, ?)",
+			g.ID, p.Currency, p.Minor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *gameRepo) Create(ctx context.Context, g *models.Game) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "INSERT INTO games (title, description, price_minor, currency, image_url, published) VALUES (?, ?, ?, ?, ?, ?)",
+			g.Title, g.Description, g.Price.Minor, g.Price.Currency, g.ImageURL, g.Published)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		g.ID = int(id)
+		return saveTerms(ctx, tx, *g)
+	})
+}
+
+func (r *gameRepo) Update(ctx context.Context, g models.Game) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE games SET title = ?, description = ?, price_minor = ?, currency = ?, image_url = ?, published = ? WHERE id = ?",
+			g.Title, g.Description, g.Price.Minor, g.Price.Currency, g.ImageURL, g.Published, g.ID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		return saveTerms(ctx, tx, g)
+	})
+}
+
+func (r *gameRepo) SetPublished(ctx context.Context, id int, published bool) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE games SET published = ? WHERE id = ?", published, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		if !published {
+			// снятую игру нельзя купить — убираем её из корзин
+			_, err = tx.ExecContext(ctx, "DELETE FROM cart_items WHERE game_id = ?", id)
+		}
+		return err
+	})
+}
+
+func (r *gameRepo) Delete(ctx context.Context, id int) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		var sold bool
+		err := tx.QueryRowContext(ctx, `
+            SELECT EXISTS(SELECT 1 FROM purchase_items WHERE game_id = ?)
+                OR EXISTS(SELECT 1 FROM purchase_bundle_games WHERE game_id = ?)
+                OR EXISTS(SELECT 1 FROM user_games WHERE game_id = ?)
+                OR EXISTS(SELECT 1 FROM activation_keys WHERE game_id = ?)
+                OR EXISTS(SELECT 1 FROM gifts WHERE game_id = ?)
+        `, id, id, id, id, id).Scan(&sold)
+		if err != nil {
+			return err
+		}
+		if sold {
+			return ErrGameSold
+		}
+		// foreign_keys не включены — каскадов нет, зависимые строки удаляем здесь же
+		for _, q := range []string{
+			"DELETE FROM cart_items WHERE game_id = ?",
+			"DELETE FROM comments WHERE game_id = ?",
+			"DELETE FROM game_genres WHERE game_id = ?",
+			"DELETE FROM game_tags WHERE game_id = ?",
+			"DELETE FROM game_prices WHERE game_id = ?",
+			"DELETE FROM price_changes WHERE game_id = ?",
+			"DELETE FROM bundle_games WHERE game_id = ?",
+			"DELETE FROM wishlist_items WHERE game_id = ?",
+			"DELETE FROM notifications WHERE game_id = ?",
+			"DELETE FROM promotions WHERE game_id = ?",
+		} {
+			if _, err := tx.ExecContext(ctx, q, id); err != nil {
+				return err
+			}
+		}
+		res, err := tx.ExecContext(ctx, "DELETE FROM games WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+)
+
+func TestDeleteGame(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	sold := addGame(t, r, "Doom", 1999)
+	carted := addGame(t, r, "Quake", 999)
+	placeOrder(t, r, uid, sold)
+	if err := r.Carts.Add(ctx, uid, carted, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	sale := models.Promotion{Name: "Quake sale", Kind: models.PromotionPercent, Percent: 50, GameID: carted, Active: true}
+	storewide := models.Promotion{Name: "Storewide", Kind: models.PromotionPercent, Percent: 10, Active: true}
+	for _, p := range []*models.Promotion{&sale, &storewide} {
+		if err := r.Promotions.Create(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := r.Games.Delete(ctx, sold); !errors.Is(err, ErrGameSold) {
+		t.Errorf("delete ordered game: err = %v, want ErrGameSold", err)
+	}
+	if err := r.Games.Delete(ctx, carted); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Games.Get(ctx, carted, money.USD); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted game: err = %v, want ErrNotFound", err)
+	}
+	if items, err := r.Carts.Items(ctx, uid, money.USD); err != nil || len(items) != 0 {
+		t.Errorf("cart after delete = %v, %v; want empty", items, err)
+	}
+	// скидка на удалённую игру исчезает вместе с ней, остальные остаются
+	promos, err := r.Promotions.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(promos) != 1 || promos[0].ID != storewide.ID {
+		t.Errorf("promotions after delete = %+v, want only the storewide one", promos)
+	}
+	if err := r.Games.Delete(ctx, carted); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second delete: err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+type giftRepo struct {
+	db *sql.DB
+}
+
+func NewGiftRepo(db *sql.DB) GiftRepo {
+	return &giftRepo{db: db}
+}
+
+const giftSelect = `SELECT gf.id, gf.purchase_id, gf.purchase_item_id, gf.sender_id, COALESCE(s.username, ''),
+        gf.recipient_id, COALESCE(rc.username, ''), gf.game_id, COALESCE(g.title, ''), gf.message, gf.status,
+        ` + giftDelivered + `, gf.created_at, COALESCE(gf.decided_at, '')
+    FROM gifts gf
+    JOIN purchases p ON p.id = gf.purchase_id
+    LEFT JOIN customers s ON s.id = gf.sender_id
+    LEFT JOIN customers rc ON rc.id = gf.recipient_id
+    LEFT JOIN games g ON g.id = gf.game_id`
+
+func scanGift(s rowScanner) (models.Gift, error) {
+	var gf models.Gift
+	var created, decided string
+	err := s.Scan(&gf.ID, &gf.OrderID, &gf.ItemID, &gf.SenderID, &gf.Sender, &gf.RecipientID, &gf.Recipient,
+		&gf.GameID, &gf.GameTitle, &gf.Message, &gf.Status, &gf.Delivered, &created, &decided)
+	if err == sql.ErrNoRows {
+		return gf, ErrNotFound
+	}
+	gf.CreatedAt, gf.DecidedAt = parseTime(created), parseTime(decided)
+	return gf, err
+}
+
+// listGifts — подарки по условию where, новые первыми.
+func (r *giftRepo) listGifts(ctx context.Context, where string, args ...any) ([]models.Gift, error) {
+	rows, err := r.db.QueryContext(ctx, giftSelect+" WHERE "+where+" ORDER BY gf.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Gift
+	for rows.Next() {
+		gf, err := scanGift(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, gf)
+	}
+	return out, rows.Err()
+}
+
+// giftDelivered — подарок виден получателю: заказ оплачен (или был оплачен, а подарок уже решён).
+const giftDelivered = "(p.status = 'paid' OR gf.status <> 'pending')"
+
+func (r *giftRepo) Inbox(ctx context.Context, userID int) ([]models.Gift, error) {
+	return r.listGifts(ctx, "gf.recipient_id = ? AND "+giftDelivered, userID)
+}
+
+func (r *giftRepo) Sent(ctx context.Context, userID int) ([]models.Gift, error) {
+	return r.listGifts(ctx, "gf.sender_id = ?", userID)
+}
+
+func (r *giftRepo) PendingCount(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `
+        SELECT COUNT(*) FROM gifts gf JOIN purchases p ON p.id = gf.purchase_id
+        WHERE gf.recipient_id = ? AND gf.status = ? AND p.status = ?`,
+		userID, models.GiftPending, models.OrderPaid).Scan(&n)
+	return n, err
+}
+
+func (r *giftRepo) Accept(ctx context.Context, id, userID int) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		_, err := decideGift(ctx, tx, id, userID, models.GiftAccepted)
+		return err
+	})
+}
+
+func (r *giftRepo) Decline(ctx context.Context, id, userID int) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		gameID, err := decideGift(ctx, tx, id, userID, models.GiftDeclined)
+		if err != nil {
+			return err
+		}
+		return dropUngranted(ctx, tx, "user_id = ? AND game_id = ?", userID, gameID)
+	})
+}
+
+// decideGift переводит ожидающий оплаченный подарок получателя userID в status и возвращает его игру.
+func decideGift(ctx context.Context, tx dbtx, id, userID int, status models.GiftStatus) (int, error) {
+	var gameID int
+	var cur models.GiftStatus
+	var paid bool
+	err := tx.QueryRowContext(ctx, "SELECT gf.game_id, gf.status, p.status = ? FROM gifts gf JOIN purchases p ON p.id = gf.purchase_id WHERE gf.id = ? AND gf.recipient_id = ?",
+		models.OrderPaid, id, userID).Scan(&gameID, &cur, &paid)
+	if err == sql.ErrNoRows || (err == nil && cur == models.GiftPending && !paid) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, "UPDATE gifts SET status = ?, decided_at = ? WHERE id = ? AND status = ?",
+		status, formatTime(time.Now()), id, models.GiftPending)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, fmt.Errorf("%w: gift %d already %s", ErrInvalidTransition, id, cur)
+	}
+	return gameID, nil
+}
+
+// libraryGrants — что даёт покупателям игры в библиотеке: оплаченные и не возвращённые личные
+// позиции (с играми наборов), не отклонённые подарки из таких позиций и активированные
+// неотозванные ключи.
+const libraryGrants = `
+    SELECT p.user_id, ig.game_id FROM purchase_items pi
+    JOIN purchases p ON p.id = pi.purchase_id
+    JOIN (` + itemGames + `) ig ON ig.item_id = pi.id
+    WHERE p.status = 'paid' AND pi.gift = 0 AND pi.id NOT IN (` + refundedItems + `)
+    UNION ALL
+    SELECT gf.recipient_id, gf.game_id FROM gifts gf
+    JOIN purchases p ON p.id = gf.purchase_id
+    WHERE p.status = 'paid' AND gf.status IN ('pending', 'accepted') AND gf.purchase_item_id NOT IN (` + refundedItems + `)
+    UNION ALL
+    SELECT redeemed_by, game_id FROM activation_keys WHERE redeemed_by IS NOT NULL AND revoked_at IS NULL`
+
+// refundedItems — позиции заказов, возврат которых одобрен.
+const refundedItems = `SELECT ri.purchase_item_id FROM refund_items ri JOIN refunds x ON x.id = ri.refund_id WHERE x.status = 'approved'`
+
+// dropUngranted удаляет из библиотек строки user_games под условием where, если игру
+// покупателю больше ничего не даёт (см. libraryGrants).
+func dropUngranted(ctx context.Context, tx dbtx, where string, args ...any) error {
+	_, err := tx.ExecContext(ctx, `
+        DELETE FROM user_games
+        WHERE (`+where+`)
+          AND NOT EXISTS (SELECT 1 FROM (`+libraryGrants+`) lg
+                          WHERE lg.user_id = user_games.user_id AND lg.game_id = user_games.game_id)`, args...)
+	return err
+}
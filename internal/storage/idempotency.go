@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+// claimKey занимает ключ идемпотентности. Это должна быть первая запись в транзакции:
+// параллельный повтор с тем же ключом ждёт её завершения, а не создаёт вторую копию.
+// Ключ, уже выполненный раньше, возвращается вместе с ErrIdempotentReplay.
+func claimKey(ctx context.Context, tx dbtx, k models.IdempotencyKey) (models.IdempotencyKey, error) {
+	res, err := tx.ExecContext(ctx, `
+        INSERT OR IGNORE INTO idempotency_keys (user_id, operation, key, purchase_id, payment_id, created_at)
+        VALUES (?, ?, ?, ?, NULLIF(?, 0), ?)`,
+		k.UserID, k.Op, k.Key, k.OrderID, k.PaymentID, formatTime(time.Now()))
+	if err != nil {
+		return k, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return k, nil
+	}
+	prev, err := lookupKey(ctx, tx, k.UserID, k.Op, k.Key)
+	if err != nil {
+		return prev, err
+	}
+	return prev, ErrIdempotentReplay
+}
+
+// setKeyResult запоминает результат операции под занятым ключом (в той же транзакции).
+func setKeyResult(ctx context.Context, tx dbtx, k models.IdempotencyKey) error {
+	_, err := tx.ExecContext(ctx, "UPDATE idempotency_keys SET purchase_id = ?, payment_id = NULLIF(?, 0) WHERE user_id = ? AND operation = ? AND key = ?",
+		k.OrderID, k.PaymentID, k.UserID, k.Op, k.Key)
+	return err
+}
+
+func lookupKey(ctx context.Context, q dbtx, userID int, op models.IdempotencyOp, key string) (models.IdempotencyKey, error) {
+	k := models.IdempotencyKey{UserID: userID, Op: op, Key: key}
+	var created string
+	err := q.QueryRowContext(ctx, "SELECT purchase_id, COALESCE(payment_id, 0), created_at FROM idempotency_keys WHERE user_id = ? AND operation = ? AND key = ?",
+		userID, op, key).Scan(&k.OrderID, &k.PaymentID, &created)
+	if err == sql.ErrNoRows {
+		return k, ErrNotFound
+	}
+	k.CreatedAt = parseTime(created)
+	return k, err
+}
+
+type idempotencyRepo struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepo(db *sql.DB) IdempotencyRepo {
+	return &idempotencyRepo{db: db}
+}
+
+func (r *idempotencyRepo) Lookup(ctx context.Context, userID int, op models.IdempotencyOp, key string) (models.IdempotencyKey, error) {
+	return lookupKey(ctx, r.db, userID, op, key)
+}
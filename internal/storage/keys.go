@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+type keyRepo struct {
+	db *sql.DB
+}
+
+func NewKeyRepo(db *sql.DB) KeyRepo {
+	return &keyRepo{db: db}
+}
+
+const keySelect = `SELECT k.id, k.game_id, COALESCE(g.title, ''), k.code, k.batch, k.created_at,
+        COALESCE(k.redeemed_by, 0), COALESCE(c.username, ''), COALESCE(k.redeemed_at, ''),
+        COALESCE(pi.purchase_id, 0), COALESCE(k.revoked_at, '')
+    FROM activation_keys k
+    LEFT JOIN games g ON g.id = k.game_id
+    LEFT JOIN customers c ON c.id = k.redeemed_by
+    LEFT JOIN purchase_items pi ON pi.id = k.purchase_item_id`
+
+func scanKey(s rowScanner) (models.ActivationKey, error) {
+	var k models.ActivationKey
+	var created, redeemed, revoked string
+	err := s.Scan(&k.ID, &k.GameID, &k.GameTitle, &k.Code, &k.Batch, &created, &k.RedeemedBy, &k.Redeemer, &redeemed,
+		&k.OrderID, &revoked)
+	if err == sql.ErrNoRows {
+		return k, ErrNotFound
+	}
+	k.CreatedAt, k.RedeemedAt, k.RevokedAt = parseTime(created), parseTime(redeemed), parseTime(revoked)
+	return k, err
+}
+
+// listKeys — ключи по условию where в порядке order.
+func (r *keyRepo) listKeys(ctx context.Context, where, order string, args ...any) ([]models.ActivationKey, error) {
+	rows, err := r.db.QueryContext(ctx, keySelect+" WHERE "+where+" ORDER BY "+order, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.ActivationKey
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+func (r *keyRepo) Add(ctx context.Context, gameID int, codes []string, batch string, adminID int) ([]models.ActivationKey, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	var added []models.ActivationKey
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		var title string
+		if err := tx.QueryRowContext(ctx, "SELECT title FROM games WHERE id = ?", gameID).Scan(&title); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+		for _, code := range codes {
+			// code UNIQUE: повтор в импорте или уже выпущенный код пропускается
+			res, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO activation_keys (game_id, code, batch, created_by, created_at) VALUES (?, ?, ?, ?, ?)",
+				gameID, code, batch, nullable(adminID), formatTime(now))
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				continue
+			}
+			id, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			added = append(added, models.ActivationKey{ID: int(id), GameID: gameID, GameTitle: title, Code: code, Batch: batch, CreatedAt: now})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+func (r *keyRepo) Stock(ctx context.Context) ([]models.KeyStock, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT k.game_id, COALESCE(g.title, ''), COUNT(*), COUNT(k.redeemed_by)
+        FROM activation_keys k
+        LEFT JOIN games g ON g.id = k.game_id
+        WHERE k.purchase_item_id IS NULL
+        GROUP BY k.game_id
+        ORDER BY g.title, k.game_id
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.KeyStock
+	for rows.Next() {
+		var s models.KeyStock
+		if err := rows.Scan(&s.GameID, &s.GameTitle, &s.Total, &s.Redeemed); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func (r *keyRepo) List(ctx context.Context, gameID int, batch string) ([]models.ActivationKey, error) {
+	if batch == "" {
+		return r.listKeys(ctx, "k.game_id = ?", "k.id", gameID)
+	}
+	return r.listKeys(ctx, "k.game_id = ? AND k.batch = ?", "k.id", gameID, batch)
+}
+
+func (r *keyRepo) Redemptions(ctx context.Context, limit int) ([]models.ActivationKey, error) {
+	return r.listKeys(ctx, "k.redeemed_by IS NOT NULL", "k.redeemed_at DESC, k.id DESC LIMIT ?", limit)
+}
+
+func (r *keyRepo) Redeem(ctx context.Context, userID int, code string) (models.ActivationKey, error) {
+	var k models.ActivationKey
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		var err error
+		k, err = scanKey(tx.QueryRowContext(ctx, keySelect+" WHERE k.code = ?", code))
+		if err != nil {
+			return err
+		}
+		if k.Revoked() {
+			return ErrKeyRevoked
+		}
+		if k.Redeemed() {
+			return ErrKeyRedeemed
+		}
+		var owned bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM user_games WHERE user_id = ? AND game_id = ?)", userID, k.GameID).Scan(&owned); err != nil {
+			return err
+		}
+		if owned {
+			return ErrAlreadyOwned
+		}
+		now := time.Now().UTC().Truncate(time.Second)
+		// redeemed_by IS NULL — ключ одноразовый, даже если его вводят одновременно двое
+		res, err := tx.ExecContext(ctx, "UPDATE activation_keys SET redeemed_by = ?, redeemed_at = ? WHERE id = ? AND redeemed_by IS NULL AND revoked_at IS NULL",
+			userID, formatTime(now), k.ID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrKeyRedeemed
+		}
+		k.RedeemedBy, k.RedeemedAt = userID, now
+		if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO user_games (user_id, game_id) VALUES (?, ?)", userID, k.GameID); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM cart_items WHERE user_id = ? AND game_id = ? AND gift = 0", userID, k.GameID)
+		return err
+	})
+	return k, err
+}
+
+// issueGiftKeys выпускает для оплаченного заказа orderID по ключу активации на каждую копию
+// в подарок без получателя (внутри транзакции оплаты). Строки, по которым ключи уже есть, пропускаются.
+func issueGiftKeys(ctx context.Context, tx dbtx, orderID int) error {
+	rows, err := tx.QueryContext(ctx, `
+        SELECT pi.id, pi.game_id, COALESCE(pi.quantity, 1) FROM purchase_items pi
+        WHERE pi.purchase_id = ? AND pi.gift = 1 AND pi.game_id IS NOT NULL
+          AND NOT EXISTS (SELECT 1 FROM gifts gf WHERE gf.purchase_item_id = pi.id)
+          AND NOT EXISTS (SELECT 1 FROM activation_keys k WHERE k.purchase_item_id = pi.id)`, orderID)
+	if err != nil {
+		return err
+	}
+	type line struct{ id, gameID, qty int }
+	var lines []line
+	for rows.Next() {
+		var l line
+		if err := rows.Scan(&l.id, &l.gameID, &l.qty); err != nil {
+			rows.Close()
+			return err
+		}
+		lines = append(lines, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := formatTime(time.Now())
+	batch := fmt.Sprintf("order-%d", orderID)
+	for _, l := range lines {
+		for range l.qty {
+			code, err := models.NewKeyCode()
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, "INSERT INTO activation_keys (game_id, code, batch, created_at, purchase_item_id) VALUES (?, ?, ?, ?, ?)",
+				l.gameID, code, batch, now, l.id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// orderKeys — ключи копий в подарок заказов под условием where (по pi.purchase_id), сгруппированные по заказу.
+func orderKeys(ctx context.Context, q dbtx, where string, args ...any) (map[int][]models.ActivationKey, error) {
+	rows, err := q.QueryContext(ctx, keySelect+" WHERE k.purchase_item_id IS NOT NULL AND "+where+" ORDER BY k.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int][]models.ActivationKey{}
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out[k.OrderID] = append(out[k.OrderID], k)
+	}
+	return out, rows.Err()
+}
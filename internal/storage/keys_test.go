@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+)
+
+func TestRedeemKey(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	admin := addCustomer(t, r, "admin")
+	bob := addCustomer(t, r, "bob")
+	game := addGame(t, r, "Doom", 1999)
+	keys, err := r.Keys.Add(ctx, game, []string{"AAAAABBBBBCCCCC", "DDDDDEEEEEFFFFF"}, "partner", admin)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("Add = %v, %v", keys, err)
+	}
+
+	if _, err := r.Keys.Redeem(ctx, bob, "ZZZZZ"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown key: err = %v, want ErrNotFound", err)
+	}
+	k, err := r.Keys.Redeem(ctx, bob, keys[0].Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.RedeemedBy != bob || !owns(t, r, bob, game) {
+		t.Errorf("redeemed key %+v did not grant the game", k)
+	}
+	if _, err := r.Keys.Redeem(ctx, addCustomer(t, r, "eve"), keys[0].Code); !errors.Is(err, ErrKeyRedeemed) {
+		t.Errorf("second redemption: err = %v, want ErrKeyRedeemed", err)
+	}
+	if _, err := r.Keys.Redeem(ctx, bob, keys[1].Code); !errors.Is(err, ErrAlreadyOwned) {
+		t.Errorf("key for an owned game: err = %v, want ErrAlreadyOwned", err)
+	}
+}
+
+func TestGiftCopiesIssueKeys(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	eve := addCustomer(t, r, "eve")
+	bob := addCustomer(t, r, "bob")
+	admin := addCustomer(t, r, "admin")
+	game := addGame(t, r, "Doom", 1999)
+
+	if err := r.Carts.Add(ctx, eve, game, 2, true); err != nil {
+		t.Fatal(err)
+	}
+	o, err := r.Orders.CreateFromCart(ctx, eve, money.USD, "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := payOrder(t, r, o)
+	if owns(t, r, eve, game) {
+		t.Error("gift copy went to the buyer's library")
+	}
+
+	// по ключу на каждую копию — на заказе и в списке заказов покупателя
+	got, err := r.Orders.Get(ctx, o.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.GiftKeys) != 2 {
+		t.Fatalf("order has %d gift keys, want 2", len(got.GiftKeys))
+	}
+	list, err := r.Orders.ListByUser(ctx, eve)
+	if err != nil || len(list) != 1 || len(list[0].GiftKeys) != 2 {
+		t.Fatalf("ListByUser = %+v, %v; want one order with 2 keys", list, err)
+	}
+	// ключи из заказов не считаются запасом для партнёров
+	if stock, err := r.Keys.Stock(ctx); err != nil || len(stock) != 0 {
+		t.Errorf("Stock = %v, %v; want empty", stock, err)
+	}
+
+	if _, err := r.Keys.Redeem(ctx, bob, got.GiftKeys[0].Code); err != nil {
+		t.Fatal(err)
+	}
+	if !owns(t, r, bob, game) {
+		t.Fatal("redeemed gift key did not grant the game")
+	}
+
+	// возврат строки отзывает оба ключа и забирает игру у активировавшего
+	rf := requestRefund(t, r, o)
+	if err := r.Refunds.Claim(ctx, rf.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Refunds.Approve(ctx, rf.ID, admin, "", p.ID, "re_1"); err != nil {
+		t.Fatal(err)
+	}
+	if owns(t, r, bob, game) {
+		t.Error("game from a refunded gift key is still in the library")
+	}
+	if _, err := r.Keys.Redeem(ctx, addCustomer(t, r, "carol"), got.GiftKeys[1].Code); !errors.Is(err, ErrKeyRevoked) {
+		t.Errorf("key of a refunded copy: err = %v, want ErrKeyRevoked", err)
+	}
+	got, err = r.Orders.Get(ctx, o.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range got.GiftKeys {
+		if !k.Revoked() {
+			t.Errorf("key %d is not revoked after refund", k.ID)
+		}
+	}
+}
+
+func TestGiftWithRecipientIssuesNoKey(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	eve := addCustomer(t, r, "eve")
+	bob := addCustomer(t, r, "bob")
+	game := addGame(t, r, "Doom", 1999)
+
+	if err := r.Carts.Add(ctx, eve, game, 1, true); err != nil {
+		t.Fatal(err)
+	}
+	items, err := r.Carts.Items(ctx, eve, money.USD)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("cart = %v, %v", items, err)
+	}
+	gifts := map[int]models.Gift{items[0].ID: {RecipientID: bob}}
+	o, err := r.Orders.CreateFromCart(ctx, eve, money.USD, "", "", gifts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payOrder(t, r, o)
+
+	if !owns(t, r, bob, game) {
+		t.Error("gift did not reach the recipient")
+	}
+	got, err := r.Orders.Get(ctx, o.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.GiftKeys) != 0 {
+		t.Errorf("gift with a recipient got %d keys", len(got.GiftKeys))
+	}
+}
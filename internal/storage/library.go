@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+type libraryRepo struct {
+	db *sql.DB
+}
+
+func NewLibraryRepo(db *sql.DB) LibraryRepo {
+	return &libraryRepo{db: db}
+}
+
+func (r *libraryRepo) List(ctx context.Context, userID int) ([]models.Game, error) {
+	from, args := pricedGames("", priceTime(ctx))
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT `+qualifiedGameColumns+`
+        FROM user_games ug
+        JOIN `+from+` ON g.id = ug.game_id
+        WHERE ug.user_id = ?
+        ORDER BY ug.id
+    `, append(args, userID)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Game
+	for rows.Next() {
+		g, err := scanGame(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+func (r *libraryRepo) Owns(ctx context.Context, userID, gameID int) (bool, error) {
+	var owned bool
+	err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM user_games WHERE user_id = ? AND game_id = ?)", userID, gameID).Scan(&owned)
+	return owned, err
+}
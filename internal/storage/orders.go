@@ -0,0 +1,440 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+)
+
+type orderRepo struct {
+	db *sql.DB
+}
+
+func NewOrderRepo(db *sql.DB) OrderRepo {
+	return &orderRepo{db: db}
+}
+
+const orderColumns = "id, user_id, total_minor, currency, created_at, status, COALESCE(updated_at, created_at), discount_minor, coupon_code"
+
+func scanOrder(s rowScanner) (models.Order, error) {
+	var o models.Order
+	var created, updated string
+	err := s.Scan(&o.ID, &o.UserID, &o.Total.Minor, &o.Total.Currency, &created, &o.Status, &updated, &o.Discount.Minor, &o.Coupon)
+	if err == sql.ErrNoRows {
+		return o, ErrNotFound
+	}
+	o.Discount.Currency = o.Total.Currency
+	o.CreatedAt, o.UpdatedAt = parseTime(created), parseTime(updated)
+	o.Paid = o.Status == models.OrderPaid
+	return o, err
+}
+
+func (r *orderRepo) CreateFromCart(ctx context.Context, userID int, cur money.Currency, coupon, idemKey string, gifts map[int]models.Gift) (models.Order, error) {
+	var order models.Order
+	var replayOf int
+	idem := models.IdempotencyKey{UserID: userID, Op: models.OpCheckout, Key: idemKey}
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		if idemKey != "" {
+			prev, err := claimKey(ctx, tx, idem)
+			if errors.Is(err, ErrIdempotentReplay) {
+				replayOf = prev.OrderID
+			}
+			if err != nil {
+				return err
+			}
+		}
+		now := time.Now().UTC().Truncate(time.Second)
+		items, promos, applied, err := quoteCart(ctx, tx, userID, cur, coupon, now)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return ErrEmptyCart
+		}
+		if models.HasUnavailable(items) {
+			return ErrPriceUnavailable
+		}
+		if models.HasOwned(items) {
+			return ErrAlreadyOwned
+		}
+		if err := checkGiftLines(items, gifts); err != nil {
+			return err
+		}
+		order = models.Order{UserID: userID, CreatedAt: now, UpdatedAt: now, Status: models.OrderPending, Promotions: applied}
+		if order.Total, err = models.CartTotal(items); err != nil {
+			return err
+		}
+		order.Total.Currency = cur // заказ в валюте оплаты, даже если все игры бесплатные
+		order.Discount = money.New(0, cur)
+		for _, it := range items {
+			order.Discount.Minor += it.Discount.Minor
+		}
+		for _, ap := range applied {
+			if ap.Code != "" {
+				order.Coupon = ap.Code // код как он заведён, а не как его ввёл покупатель
+			}
+		}
+		res, err := tx.ExecContext(ctx, "INSERT INTO purchases (user_id, total_minor, currency, status, created_at, updated_at, discount_minor, coupon_code) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			userID, order.Total.Minor, order.Total.Currency, order.Status, formatTime(now), formatTime(now), order.Discount.Minor, order.Coupon)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		order.ID = int(id)
+		if err := addOrderEvent(ctx, tx, order.ID, "", order.Status, "Заказ оформлен", now); err != nil {
+			return err
+		}
+		for _, it := range items {
+			res, err := tx.ExecContext(ctx, "INSERT INTO purchase_items (purchase_id, game_id, bundle_id, price_minor, quantity, gift, discount_minor) VALUES (?, ?, ?, ?, ?, ?, ?)",
+				order.ID, nullable(it.GameID), nullable(it.BundleID), it.Price.Minor, it.Quantity, it.Gift, it.Discount.Minor)
+			if err != nil {
+				return err
+			}
+			itemID, _ := res.LastInsertId()
+			// набор выдаёт при оплате те игры, которых у покупателя нет сейчас
+			for _, gameID := range it.BundleGames {
+				if _, err := tx.ExecContext(ctx, "INSERT INTO purchase_bundle_games (purchase_item_id, game_id) VALUES (?, ?)", itemID, gameID); err != nil {
+					return err
+				}
+			}
+			oi := models.OrderItem{
+				ID: int(itemID), OrderID: order.ID, GameID: it.GameID, BundleID: it.BundleID, Title: it.Title,
+				Price: it.Price, Quantity: it.Quantity, Gift: it.Gift, Discount: it.Discount,
+			}
+			if g, ok := gifts[it.ID]; ok {
+				if _, err := tx.ExecContext(ctx, `
+                    INSERT INTO gifts (purchase_item_id, purchase_id, sender_id, recipient_id, game_id, message, status, created_at)
+                    VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+					itemID, order.ID, userID, g.RecipientID, it.GameID, g.Message, models.GiftPending, formatTime(now)); err != nil {
+					return err
+				}
+				oi.Recipient = g.Recipient
+			}
+			order.Items = append(order.Items, oi)
+		}
+		if err := redeemPromotions(ctx, tx, order, promos); err != nil {
+			return err
+		}
+		if idemKey != "" {
+			idem.OrderID = order.ID
+			if err := setKeyResult(ctx, tx, idem); err != nil {
+				return err
+			}
+		}
+		// clear cart
+		_, err = tx.ExecContext(ctx, "DELETE FROM cart_items WHERE user_id = ?", userID)
+		return err
+	})
+	if replayOf != 0 {
+		order, gerr := r.Get(ctx, replayOf)
+		if gerr != nil {
+			return order, gerr
+		}
+		return order, err
+	}
+	return order, err
+}
+
+func (r *orderRepo) Get(ctx context.Context, id int) (models.Order, error) {
+	o, err := scanOrder(r.db.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM purchases WHERE id = ?", id))
+	if err != nil {
+		return o, err
+	}
+	if o.Items, err = orderItems(ctx, r.db, id); err != nil {
+		return o, err
+	}
+	promos, err := orderPromotions(ctx, r.db, "pr.purchase_id = ?", id)
+	if err != nil {
+		return o, err
+	}
+	o.Promotions = promos[id]
+	keys, err := orderKeys(ctx, r.db, "pi.purchase_id = ?", id)
+	if err != nil {
+		return o, err
+	}
+	o.GiftKeys = keys[id]
+	events, err := orderEvents(ctx, r.db, "purchase_id = ?", id)
+	o.Events = events[id]
+	return o, err
+}
+
+func orderItems(ctx context.Context, q dbtx, orderID int) ([]models.OrderItem, error) {
+	rows, err := q.QueryContext(ctx, `
+        SELECT pi.id, pi.purchase_id, COALESCE(pi.game_id, 0), COALESCE(pi.bundle_id, 0), COALESCE(g.title, b.title, ''), pi.price_minor, p.currency, COALESCE(pi.quantity, 1), pi.gift, pi.discount_minor,
+               COALESCE(rc.username, ''),
+               COALESCE((SELECT r.status FROM refund_items ri JOIN refunds r ON r.id = ri.refund_id
+                         WHERE ri.purchase_item_id = pi.id AND r.status IN ('pending', 'processing', 'approved')
+                         ORDER BY r.id DESC LIMIT 1), '')
+        FROM purchase_items pi
+        JOIN purchases p ON p.id = pi.purchase_id
+        LEFT JOIN games g ON g.id = pi.game_id
+        LEFT JOIN bundles b ON b.id = pi.bundle_id
+        LEFT JOIN gifts gf ON gf.purchase_item_id = pi.id
+        LEFT JOIN customers rc ON rc.id = gf.recipient_id
+        WHERE pi.purchase_id = ?
+        ORDER BY pi.id
+    `, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []models.OrderItem
+	for rows.Next() {
+		var it models.OrderItem
+		if err := rows.Scan(&it.ID, &it.OrderID, &it.GameID, &it.BundleID, &it.Title, &it.Price.Minor, &it.Price.Currency, &it.Quantity, &it.Gift, &it.Discount.Minor, &it.Recipient, &it.RefundStatus); err != nil {
+			return nil, err
+		}
+		it.Discount.Currency = it.Price.Currency
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func (r *orderRepo) ListByUser(ctx context.Context, userID int) ([]models.Order, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+orderColumns+" FROM purchases WHERE user_id = ? ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// скидки, ключи подарков и история всех заказов покупателя — тремя запросами
+	promos, err := orderPromotions(ctx, r.db, "pr.user_id = ?", userID)
+	if err != nil {
+		return out, err
+	}
+	keys, err := orderKeys(ctx, r.db, "pi.purchase_id IN (SELECT id FROM purchases WHERE user_id = ?)", userID)
+	if err != nil {
+		return out, err
+	}
+	events, err := orderEvents(ctx, r.db, "purchase_id IN (SELECT id FROM purchases WHERE user_id = ?)", userID)
+	for i := range out {
+		out[i].Promotions = promos[out[i].ID]
+		out[i].GiftKeys = keys[out[i].ID]
+		out[i].Events = events[out[i].ID]
+	}
+	return out, err
+}
+
+func (r *orderRepo) Transition(ctx context.Context, id int, to models.OrderStatus, reason string) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		return transitionOrder(ctx, tx, id, to, reason)
+	})
+}
+
+func (r *orderRepo) ExpireUnpaid(ctx context.Context, idleBefore time.Time, restoreCart bool, void VoidFunc) ([]int, error) {
+	// возраст — от последней попытки оплаты: заказ, который покупатель только что пошёл
+	// оплачивать, не просрочивается у него на глазах
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT p.id FROM purchases p
+        WHERE p.status IN (?, ?)
+          AND COALESCE((SELECT MAX(py.created_at) FROM payments py WHERE py.purchase_id = p.id), p.created_at) < ?
+        ORDER BY p.id`,
+		models.OrderPending, models.OrderFailed, formatTime(idleBefore))
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// каждый заказ — своя транзакция: заказ, который успели оплатить или отменить
+	// между выборкой и переходом, просто пропускается
+	var expired []int
+	for _, id := range ids {
+		if void != nil {
+			if err := void(ctx, id); err != nil {
+				log.Printf("order expiry: order %d skipped: %v", id, err)
+				continue
+			}
+		}
+		err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+			if err := transitionOrder(ctx, tx, id, models.OrderExpired, "Не оплачен вовремя"); err != nil {
+				return err
+			}
+			if !restoreCart {
+				return nil
+			}
+			return restoreOrderToCart(ctx, tx, id)
+		})
+		if errors.Is(err, ErrInvalidTransition) {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired = append(expired, id)
+	}
+	return expired, nil
+}
+
+// restoreOrderToCart возвращает позиции заказа в корзину покупателя; строки, которые уже
+// есть в корзине, личные копии игр из библиотеки и снятые с публикации наборы пропускаются.
+func restoreOrderToCart(ctx context.Context, tx dbtx, orderID int) error {
+	_, err := tx.ExecContext(ctx, `
+        INSERT INTO cart_items (user_id, game_id, quantity, gift)
+        SELECT p.user_id, pi.game_id, COALESCE(pi.quantity, 1), pi.gift
+        FROM purchase_items pi
+        JOIN purchases p ON p.id = pi.purchase_id
+        WHERE pi.purchase_id = ? AND pi.game_id IS NOT NULL
+          AND (pi.gift = 1 OR NOT EXISTS (SELECT 1 FROM user_games ug WHERE ug.user_id = p.user_id AND ug.game_id = pi.game_id))
+        ON CONFLICT(user_id, game_id, gift) DO NOTHING
+    `, orderID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO cart_items (user_id, bundle_id, quantity, gift)
+        SELECT p.user_id, pi.bundle_id, 1, 0
+        FROM purchase_items pi
+        JOIN purchases p ON p.id = pi.purchase_id
+        JOIN bundles b ON b.id = pi.bundle_id AND b.published = 1
+        WHERE pi.purchase_id = ?
+        ON CONFLICT(user_id, bundle_id) DO NOTHING
+    `, orderID)
+	return err
+}
+
+// orderEvents — переходы заказов по условию where, сгруппированные по заказу, в порядке времени.
+func orderEvents(ctx context.Context, q dbtx, where string, args ...any) (map[int][]models.OrderEvent, error) {
+	rows, err := q.QueryContext(ctx, "SELECT id, purchase_id, from_status, to_status, reason, created_at FROM order_events WHERE "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int][]models.OrderEvent{}
+	for rows.Next() {
+		var e models.OrderEvent
+		var created string
+		if err := rows.Scan(&e.ID, &e.OrderID, &e.From, &e.To, &e.Reason, &created); err != nil {
+			return nil, err
+		}
+		e.CreatedAt = parseTime(created)
+		out[e.OrderID] = append(out[e.OrderID], e)
+	}
+	return out, rows.Err()
+}
+
+func addOrderEvent(ctx context.Context, tx dbtx, orderID int, from, to models.OrderStatus, reason string, at time.Time) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO order_events (purchase_id, from_status, to_status, reason, created_at) VALUES (?, ?, ?, ?, ?)",
+		orderID, from, to, reason, formatTime(at))
+	return err
+}
+
+// orderStatus — текущий статус заказа (внутри транзакции).
+func orderStatus(ctx context.Context, tx dbtx, id int) (models.OrderStatus, error) {
+	var st models.OrderStatus
+	err := tx.QueryRowContext(ctx, "SELECT status FROM purchases WHERE id = ?", id).Scan(&st)
+	if err == sql.ErrNoRows {
+		return st, ErrNotFound
+	}
+	return st, err
+}
+
+// transitionOrder переводит заказ в статус to и пишет переход в историю (внутри транзакции вызывающего).
+// Переход в тот же статус ничего не делает; недопустимый — ErrInvalidTransition.
+func transitionOrder(ctx context.Context, tx dbtx, id int, to models.OrderStatus, reason string) error {
+	from, err := orderStatus(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	if !from.CanTransition(to) {
+		return fmt.Errorf("%w: order %d %s -> %s", ErrInvalidTransition, id, from, to)
+	}
+	now := time.Now()
+	// status = from — на случай, если заказ успели перевести параллельно
+	res, err := tx.ExecContext(ctx, "UPDATE purchases SET status = ?, updated_at = ? WHERE id = ? AND status = ?",
+		to, formatTime(now), id, from)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: order %d changed concurrently", ErrInvalidTransition, id)
+	}
+	if to == models.OrderCancelled || to == models.OrderExpired {
+		// закрытый заказ больше не оплатить: ожидающие попытки отменены (намерения у провайдера
+		// отменяет вызывающий до перехода, оплату, которая всё же придёт, вернут)
+		if _, err := tx.ExecContext(ctx, "UPDATE payments SET status = ?, updated_at = ? WHERE purchase_id = ? AND status = ?",
+			models.PaymentCancelled, formatTime(now), id, models.PaymentPending); err != nil {
+			return err
+		}
+	}
+	return addOrderEvent(ctx, tx, id, from, to, reason, now)
+}
+
+// markPaid отмечает заказ оплаченным и выдаёт личные копии игр в библиотеку покупателя
+// (внутри транзакции платежа): набор — каждой своей игрой. Подарки с получателем попадают
+// в его библиотеку, а на копии в подарок без получателя выпускаются ключи активации.
+func markPaid(ctx context.Context, tx dbtx, id int) error {
+	if err := transitionOrder(ctx, tx, id, models.OrderPaid, "Оплата получена"); err != nil {
+		return err
+	}
+	var userID int
+	if err := tx.QueryRowContext(ctx, "SELECT user_id FROM purchases WHERE id = ?", id).Scan(&userID); err != nil {
+		return err
+	}
+	// add to user_games (ignore duplicates)
+	_, err := tx.ExecContext(ctx, `
+        INSERT OR IGNORE INTO user_games (user_id, game_id)
+        SELECT ?, ig.game_id FROM (`+itemGames+`) ig JOIN purchase_items pi ON pi.id = ig.item_id
+        WHERE pi.purchase_id = ? AND pi.gift = 0
+    `, userID, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT OR IGNORE INTO user_games (user_id, game_id) SELECT recipient_id, game_id FROM gifts WHERE purchase_id = ? AND status = ?",
+		id, models.GiftPending)
+	if err != nil {
+		return err
+	}
+	return issueGiftKeys(ctx, tx, id)
+}
+
+// checkGiftLines проверяет, что каждый получатель из gifts относится к строке корзины с одной
+// копией игры в подарок; иначе — ErrInvalidGift.
+func checkGiftLines(items []models.CartItem, gifts map[int]models.Gift) error {
+	for cartID := range gifts {
+		ok := false
+		for _, it := range items {
+			if it.ID == cartID {
+				ok = it.Gift && it.GameID != 0 && it.Quantity == 1
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%w: cart item %d", ErrInvalidGift, cartID)
+		}
+	}
+	return nil
+}
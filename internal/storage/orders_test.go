@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+)
+
+func TestCreateFromCart(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	doom, quake := addGame(t, r, "Doom", 1999), addGame(t, r, "Quake", 999)
+
+	if _, err := r.Orders.CreateFromCart(ctx, uid, money.USD, "", "", nil); !errors.Is(err, ErrEmptyCart) {
+		t.Fatalf("empty cart: err = %v, want ErrEmptyCart", err)
+	}
+	o := placeOrder(t, r, uid, doom, quake)
+	if len(o.Items) != 2 || o.Total != money.New(2998, money.USD) {
+		t.Errorf("order = %+v, want 2 items for 29.98", o)
+	}
+	if items, err := r.Carts.Items(ctx, uid, money.USD); err != nil || len(items) != 0 {
+		t.Errorf("cart after checkout = %v, %v; want empty", items, err)
+	}
+	if owns(t, r, uid, doom) {
+		t.Error("unpaid game is in the library")
+	}
+
+	payOrder(t, r, o)
+	if st := orderStatusOf(t, r, o.ID); st != models.OrderPaid {
+		t.Errorf("order is %s, want paid", st)
+	}
+	if !owns(t, r, uid, doom) || !owns(t, r, uid, quake) {
+		t.Error("paid games are not in the library")
+	}
+}
+
+func TestCreateFromCartIdempotent(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	if err := r.Carts.Add(ctx, uid, addGame(t, r, "Doom", 1999), 1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := r.Orders.CreateFromCart(ctx, uid, money.USD, "", "k1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := r.Orders.CreateFromCart(ctx, uid, money.USD, "", "k1", nil)
+	if !errors.Is(err, ErrIdempotentReplay) {
+		t.Fatalf("repeated key: err = %v, want ErrIdempotentReplay", err)
+	}
+	if again.ID != first.ID {
+		t.Errorf("replay returned order %d, want %d", again.ID, first.ID)
+	}
+	if orders, err := r.Orders.ListByUser(ctx, uid); err != nil || len(orders) != 1 {
+		t.Errorf("ListByUser = %d orders, %v; want 1", len(orders), err)
+	}
+}
+
+func TestOrderTransitions(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	o := placeOrder(t, r, uid, addGame(t, r, "Doom", 1999))
+
+	if o.Status != models.OrderPending {
+		t.Fatalf("new order is %s, want pending", o.Status)
+	}
+	if err := r.Orders.Transition(ctx, o.ID, models.OrderCancelled, "test"); err != nil {
+		t.Fatalf("pending → cancelled: %v", err)
+	}
+	for _, to := range []models.OrderStatus{models.OrderPending, models.OrderExpired, models.OrderRefunded} {
+		if err := r.Orders.Transition(ctx, o.ID, to, "test"); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("cancelled → %s: err = %v, want ErrInvalidTransition", to, err)
+		}
+	}
+
+	got, err := r.Orders.Get(ctx, o.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var path []models.OrderStatus
+	for _, e := range got.Events {
+		path = append(path, e.To)
+	}
+	if want := []models.OrderStatus{models.OrderPending, models.OrderCancelled}; !slices.Equal(path, want) {
+		t.Errorf("events = %v, want %v", path, want)
+	}
+}
+
+func TestCancelClosesPendingPayments(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	o := placeOrder(t, r, uid, addGame(t, r, "Doom", 1999))
+	p := startPayment(t, r, o, "pi_1")
+
+	if err := r.Orders.Transition(ctx, o.ID, models.OrderCancelled, "test"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Payments.Get(ctx, p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.PaymentCancelled {
+		t.Errorf("payment is %s, want cancelled", got.Status)
+	}
+	if pending, err := r.Payments.Pending(ctx, o.ID); err != nil || len(pending) != 0 {
+		t.Errorf("Pending = %v, %v; want none", pending, err)
+	}
+}
+
+func TestExpireUnpaid(t *testing.T) {
+	r, db := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	idle := placeOrder(t, r, uid, addGame(t, r, "Doom", 1999))
+	paying := placeOrder(t, r, uid, addGame(t, r, "Quake", 999))
+	startPayment(t, r, paying, "pi_1")
+
+	// оба заказа оформлены давно, но по второму только что начали оплату
+	old := formatTime(time.Now().Add(-2 * time.Hour))
+	if _, err := db.Exec("UPDATE purchases SET created_at = ?", old); err != nil {
+		t.Fatal(err)
+	}
+	var voided []int
+	void := func(ctx context.Context, orderID int) error {
+		voided = append(voided, orderID)
+		return nil
+	}
+	expired, err := r.Orders.ExpireUnpaid(ctx, time.Now().Add(-time.Hour), true, void)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(expired, []int{idle.ID}) || !slices.Equal(voided, []int{idle.ID}) {
+		t.Fatalf("expired %v, voided %v; want only order %d", expired, voided, idle.ID)
+	}
+	if st := orderStatusOf(t, r, paying.ID); st != models.OrderPending {
+		t.Errorf("order with a fresh payment attempt is %s, want pending", st)
+	}
+	items, err := r.Carts.Items(ctx, uid, money.USD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Title != "Doom" {
+		t.Errorf("cart after expiry = %+v, want Doom restored", items)
+	}
+
+	// попытка оплаты тоже устарела, но провайдер не дал её отменить — заказ не трогаем
+	if _, err := db.Exec("UPDATE payments SET created_at = ?", old); err != nil {
+		t.Fatal(err)
+	}
+	inFlight := func(ctx context.Context, orderID int) error { return errors.New("payment in flight") }
+	expired, err = r.Orders.ExpireUnpaid(ctx, time.Now().Add(-time.Hour), false, inFlight)
+	if err != nil || len(expired) != 0 {
+		t.Fatalf("ExpireUnpaid with failing void = %v, %v; want nothing expired", expired, err)
+	}
+	if st := orderStatusOf(t, r, paying.ID); st != models.OrderPending {
+		t.Errorf("order whose payment could not be voided is %s, want pending", st)
+	}
+
+	expired, err = r.Orders.ExpireUnpaid(ctx, time.Now().Add(-time.Hour), false, void)
+	if err != nil || !slices.Equal(expired, []int{paying.ID}) {
+		t.Fatalf("ExpireUnpaid = %v, %v; want [%d]", expired, err, paying.ID)
+	}
+	if pending, err := r.Payments.Pending(ctx, paying.ID); err != nil || len(pending) != 0 {
+		t.Errorf("Pending after expiry = %v, %v; want none", pending, err)
+	}
+}
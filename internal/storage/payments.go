@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+)
+
+type paymentRepo struct {
+	db *sql.DB
+}
+
+func NewPaymentRepo(db *sql.DB) PaymentRepo {
+	return &paymentRepo{db: db}
+}
+
+const paymentColumns = "id, purchase_id, provider, intent_id, status, amount_minor, refunded_minor, currency, failure_reason, created_at, updated_at"
+
+func scanPayment(s rowScanner) (models.Payment, error) {
+	var p models.Payment
+	var created, updated string
+	err := s.Scan(&p.ID, &p.OrderID, &p.Provider, &p.IntentID, &p.Status, &p.Amount.Minor, &p.Refunded.Minor, &p.Amount.Currency,
+		&p.FailureReason, &created, &updated)
+	if err == sql.ErrNoRows {
+		return p, ErrNotFound
+	}
+	p.Refunded.Currency = p.Amount.Currency
+	p.CreatedAt, p.UpdatedAt = parseTime(created), parseTime(updated)
+	return p, err
+}
+
+// recordEvent запоминает событие провайдера в транзакции, которая его применяет;
+// уже обработанное событие — ErrDuplicateEvent, и транзакция откатывается.
+func recordEvent(ctx context.Context, tx dbtx, ev models.ProcessedEvent) error {
+	res, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO processed_events (provider, event_id, event_type, processed_at) VALUES (?, ?, ?, ?)",
+		ev.Provider, ev.ID, ev.Type, formatTime(time.Now()))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDuplicateEvent
+	}
+	return nil
+}
+
+// paymentOrder — заказ платежа (и проверка, что платёж есть).
+func paymentOrder(ctx context.Context, tx dbtx, id int) (int, error) {
+	var orderID int
+	err := tx.QueryRowContext(ctx, "SELECT purchase_id FROM payments WHERE id = ?", id).Scan(&orderID)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return orderID, err
+}
+
+func (r *paymentRepo) Create(ctx context.Context, p *models.Payment, idem models.IdempotencyKey) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	if p.Status == "" {
+		p.Status = models.PaymentPending
+	}
+	var replayOf int
+	idem.Op, idem.OrderID = models.OpPay, p.OrderID
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		if idem.Key != "" {
+			prev, err := claimKey(ctx, tx, idem)
+			if errors.Is(err, ErrIdempotentReplay) {
+				replayOf = prev.PaymentID
+			}
+			if err != nil {
+				return err
+			}
+		}
+		st, err := orderStatus(ctx, tx, p.OrderID)
+		if err != nil {
+			return err
+		}
+		if !st.Payable() {
+			return fmt.Errorf("%w: order %d is %s", ErrInvalidTransition, p.OrderID, st)
+		}
+		// после неудачной попытки заказ снова ждёт оплаты
+		if err := transitionOrder(ctx, tx, p.OrderID, models.OrderPending, "Повторная оплата"); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, `
+            INSERT INTO payments (purchase_id, provider, intent_id, status, amount_minor, currency, created_at, updated_at)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			p.OrderID, p.Provider, p.IntentID, p.Status, p.Amount.Minor, p.Amount.Currency, formatTime(now), formatTime(now))
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		p.ID, p.CreatedAt, p.UpdatedAt = int(id), now, now
+		if idem.Key == "" {
+			return nil
+		}
+		idem.PaymentID = p.ID
+		return setKeyResult(ctx, tx, idem)
+	})
+	if replayOf != 0 {
+		prev, gerr := r.Get(ctx, replayOf)
+		if gerr != nil {
+			return gerr
+		}
+		*p = prev
+	}
+	return err
+}
+
+func (r *paymentRepo) Get(ctx context.Context, id int) (models.Payment, error) {
+	return scanPayment(r.db.QueryRowContext(ctx, "SELECT "+paymentColumns+" FROM payments WHERE id = ?", id))
+}
+
+func (r *paymentRepo) GetByIntent(ctx context.Context, provider, intentID string) (models.Payment, error) {
+	return scanPayment(r.db.QueryRowContext(ctx, "SELECT "+paymentColumns+" FROM payments WHERE provider = ? AND intent_id = ?", provider, intentID))
+}
+
+func (r *paymentRepo) LatestForOrder(ctx context.Context, orderID int) (models.Payment, error) {
+	return scanPayment(r.db.QueryRowContext(ctx, "SELECT "+paymentColumns+" FROM payments WHERE purchase_id = ? ORDER BY id DESC LIMIT 1", orderID))
+}
+
+func (r *paymentRepo) Pending(ctx context.Context, orderID int) ([]models.Payment, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+paymentColumns+" FROM payments WHERE purchase_id = ? AND status = ? ORDER BY id",
+		orderID, models.PaymentPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Payment
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (r *paymentRepo) Succeeded(ctx context.Context, orderID int) (models.Payment, error) {
+	return scanPayment(r.db.QueryRowContext(ctx, "SELECT "+paymentColumns+" FROM payments WHERE purchase_id = ? AND status = ? ORDER BY id DESC LIMIT 1",
+		orderID, models.PaymentSucceeded))
+}
+
+func (r *paymentRepo) MarkSucceeded(ctx context.Context, id int, ev models.ProcessedEvent) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		if err := recordEvent(ctx, tx, ev); err != nil {
+			return err
+		}
+		orderID, err := paymentOrder(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		// оплата по отменённому, просроченному или уже оплаченному заказу: игры не выдаём,
+		// событие не отмечаем — пока деньги не вернули, повтор события снова придёт сюда
+		st, err := orderStatus(ctx, tx, orderID)
+		if err != nil {
+			return err
+		}
+		if !st.Payable() {
+			return fmt.Errorf("%w: order %d is %s, payment %d", ErrOrderClosed, orderID, st, id)
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE payments SET status = ?, updated_at = ? WHERE id = ? AND status IN (?, ?)",
+			models.PaymentSucceeded, formatTime(time.Now()), id, models.PaymentPending, models.PaymentFailed); err != nil {
+			return err
+		}
+		return markPaid(ctx, tx, orderID)
+	})
+}
+
+func (r *paymentRepo) MarkFailed(ctx context.Context, id int, reason string, ev models.ProcessedEvent) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		if err := recordEvent(ctx, tx, ev); err != nil {
+			return err
+		}
+		orderID, err := paymentOrder(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		// отказ после успеха (события пришли не по порядку) ничего не меняет
+		res, err := tx.ExecContext(ctx, "UPDATE payments SET status = ?, failure_reason = ?, updated_at = ? WHERE id = ? AND status = ?",
+			models.PaymentFailed, reason, formatTime(time.Now()), id, models.PaymentPending)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		// заказ не трогаем, если его уже оплатили другой попыткой или закрыли
+		if st, err := orderStatus(ctx, tx, orderID); err != nil || st != models.OrderPending {
+			return err
+		}
+		return transitionOrder(ctx, tx, orderID, models.OrderFailed, reason)
+	})
+}
+
+func (r *paymentRepo) AddRefund(ctx context.Context, id int, amount money.Amount, ev models.ProcessedEvent) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		if err := recordEvent(ctx, tx, ev); err != nil {
+			return err
+		}
+		var p models.Payment
+		err := tx.QueryRowContext(ctx, "SELECT purchase_id, amount_minor, refunded_minor, currency FROM payments WHERE id = ?", id).
+			Scan(&p.OrderID, &p.Amount.Minor, &p.Refunded.Minor, &p.Amount.Currency)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		refunded := p.Refunded.Minor + amount.Minor
+		if amount.Currency != p.Amount.Currency || amount.Minor <= 0 || refunded > p.Amount.Minor {
+			return ErrInvalidRefund
+		}
+		status := models.PaymentSucceeded
+		if refunded == p.Amount.Minor {
+			status = models.PaymentRefunded
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE payments SET refunded_minor = ?, status = ?, updated_at = ? WHERE id = ?",
+			refunded, status, formatTime(time.Now()), id); err != nil {
+			return err
+		}
+		if status != models.PaymentRefunded {
+			return nil
+		}
+		// возврат оплаты, пришедшей по уже закрытому заказу, статус заказа не меняет
+		if st, err := orderStatus(ctx, tx, p.OrderID); err != nil || st != models.OrderPaid {
+			return err
+		}
+		return transitionOrder(ctx, tx, p.OrderID, models.OrderRefunded, "Платёж возвращён")
+	})
+}
+
+func (r *paymentRepo) RecordEvent(ctx context.Context, ev models.ProcessedEvent) error {
+	return recordEvent(ctx, r.db, ev)
+}
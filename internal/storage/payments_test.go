@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+func TestMarkSucceeded(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	game := addGame(t, r, "Doom", 1999)
+	o := placeOrder(t, r, uid, game)
+	p := startPayment(t, r, o, "pi_1")
+
+	ev := event("evt_1")
+	if err := r.Payments.MarkSucceeded(ctx, p.ID, ev); err != nil {
+		t.Fatal(err)
+	}
+	if st := orderStatusOf(t, r, o.ID); st != models.OrderPaid {
+		t.Errorf("order is %s, want paid", st)
+	}
+	if !owns(t, r, uid, game) {
+		t.Error("paid game is not in the library")
+	}
+	latest, err := r.Payments.LatestForOrder(ctx, o.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.ID != p.ID || latest.Status != models.PaymentSucceeded {
+		t.Errorf("LatestForOrder = %d (%s), want %d (succeeded)", latest.ID, latest.Status, p.ID)
+	}
+	if err := r.Payments.MarkSucceeded(ctx, p.ID, ev); !errors.Is(err, ErrDuplicateEvent) {
+		t.Errorf("repeated event: err = %v, want ErrDuplicateEvent", err)
+	}
+}
+
+func TestMarkFailed(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	o := placeOrder(t, r, uid, addGame(t, r, "Doom", 1999))
+	p := startPayment(t, r, o, "pi_1")
+
+	if err := r.Payments.MarkFailed(ctx, p.ID, "card declined", event("evt_1")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Payments.GetByIntent(ctx, "fake", "pi_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.PaymentFailed || got.FailureReason != "card declined" {
+		t.Errorf("payment = %s (%q), want failed (card declined)", got.Status, got.FailureReason)
+	}
+	// отклонённый платёж второй раз не меняется
+	if err := r.Payments.MarkFailed(ctx, p.ID, "again", event("evt_2")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := r.Payments.GetByIntent(ctx, "fake", "pi_1"); err != nil || got.FailureReason != "card declined" {
+		t.Errorf("payment after second failure = %+v, %v", got, err)
+	}
+}
+
+func TestMarkSucceededClosedOrder(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	game := addGame(t, r, "Doom", 1999)
+	o := placeOrder(t, r, uid, game)
+	p := startPayment(t, r, o, "pi_1")
+	if err := r.Orders.Transition(ctx, o.ID, models.OrderCancelled, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := event("evt_late")
+	if err := r.Payments.MarkSucceeded(ctx, p.ID, ev); !errors.Is(err, ErrOrderClosed) {
+		t.Fatalf("payment for a cancelled order: err = %v, want ErrOrderClosed", err)
+	}
+	if st := orderStatusOf(t, r, o.ID); st != models.OrderCancelled {
+		t.Errorf("order is %s, want cancelled", st)
+	}
+	if owns(t, r, uid, game) {
+		t.Error("game of a cancelled order was granted")
+	}
+	// событие не отмечено: после возврата денег его записывает вызывающий
+	if err := r.Payments.RecordEvent(ctx, ev); err != nil {
+		t.Errorf("event of a rejected payment was recorded: %v", err)
+	}
+
+	// возврат такой оплаты заказ не трогает
+	if err := r.Payments.AddRefund(ctx, p.ID, p.Amount, event("evt_refund")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Payments.Get(ctx, p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.PaymentRefunded {
+		t.Errorf("payment is %s, want refunded", got.Status)
+	}
+	if st := orderStatusOf(t, r, o.ID); st != models.OrderCancelled {
+		t.Errorf("order after refund is %s, want cancelled", st)
+	}
+}
+
+func TestSucceededIgnoresLaterAttempts(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	o := placeOrder(t, r, uid, addGame(t, r, "Doom", 1999))
+
+	if _, err := r.Payments.Succeeded(ctx, o.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unpaid order: err = %v, want ErrNotFound", err)
+	}
+	// покупатель начал оплату второй раз, а прошла первая попытка
+	paid := startPayment(t, r, o, "pi_1")
+	late := startPayment(t, r, o, "pi_2")
+	if err := r.Payments.MarkSucceeded(ctx, paid.ID, event("evt_1")); err != nil {
+		t.Fatal(err)
+	}
+	if latest, err := r.Payments.LatestForOrder(ctx, o.ID); err != nil || latest.ID != late.ID {
+		t.Fatalf("LatestForOrder = %d, %v; want %d", latest.ID, err, late.ID)
+	}
+	got, err := r.Payments.Succeeded(ctx, o.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != paid.ID {
+		t.Errorf("Succeeded = payment %d, want %d", got.ID, paid.ID)
+	}
+}
+
+func TestAddRefund(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	o := placeOrder(t, r, uid, addGame(t, r, "Doom", 1999))
+	p := payOrder(t, r, o)
+
+	half := p.Amount
+	half.Minor /= 2
+	if err := r.Payments.AddRefund(ctx, p.ID, half, event("evt_r1")); err != nil {
+		t.Fatal(err)
+	}
+	if st := orderStatusOf(t, r, o.ID); st != models.OrderPaid {
+		t.Errorf("order after partial refund is %s, want paid", st)
+	}
+	if err := r.Payments.AddRefund(ctx, p.ID, p.Amount, event("evt_r2")); !errors.Is(err, ErrInvalidRefund) {
+		t.Errorf("refund above the rest: err = %v, want ErrInvalidRefund", err)
+	}
+	rest := p.Amount
+	rest.Minor -= half.Minor
+	if err := r.Payments.AddRefund(ctx, p.ID, rest, event("evt_r3")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Payments.LatestForOrder(ctx, o.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.PaymentRefunded || got.Refunded != p.Amount {
+		t.Errorf("payment after full refund = %s (%s refunded), want refunded", got.Status, got.Refunded)
+	}
+	if st := orderStatusOf(t, r, o.ID); st != models.OrderRefunded {
+		t.Errorf("order after full refund is %s, want refunded", st)
+	}
+}
+
+func TestCreatePaymentIdempotent(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	o := placeOrder(t, r, uid, addGame(t, r, "Doom", 1999))
+
+	idem := models.IdempotencyKey{UserID: uid, Key: "k1"}
+	first := models.Payment{OrderID: o.ID, Provider: "fake", IntentID: "pi_1", Amount: o.Total}
+	if err := r.Payments.Create(ctx, &first, idem); err != nil {
+		t.Fatal(err)
+	}
+	again := models.Payment{OrderID: o.ID, Provider: "fake", IntentID: "pi_2", Amount: o.Total}
+	if err := r.Payments.Create(ctx, &again, idem); !errors.Is(err, ErrIdempotentReplay) {
+		t.Fatalf("repeated key: err = %v, want ErrIdempotentReplay", err)
+	}
+	if again.ID != first.ID || again.IntentID != "pi_1" {
+		t.Errorf("replay returned payment %d (%s), want %d (pi_1)", again.ID, again.IntentID, first.ID)
+	}
+	if pending, err := r.Payments.Pending(ctx, o.ID); err != nil || len(pending) != 1 {
+		t.Errorf("Pending = %v, %v; want one payment", pending, err)
+	}
+}
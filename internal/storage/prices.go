@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+type priceTimeKey struct{}
+
+// WithPriceTime — контекст, в котором каталог и корзина считают цены и скидки на момент at,
+// а не на текущий: так администратор смотрит на магазин в будущую дату. Заказы всегда
+// оформляются по текущим ценам.
+func WithPriceTime(ctx context.Context, at time.Time) context.Context {
+	return context.WithValue(ctx, priceTimeKey{}, at)
+}
+
+// priceTime — момент, на который считаются цены в ctx (по умолчанию — сейчас).
+func priceTime(ctx context.Context) time.Time {
+	if at, ok := ctx.Value(priceTimeKey{}).(time.Time); ok {
+		return at
+	}
+	return time.Now()
+}
+
+type priceChangeRepo struct {
+	db *sql.DB
+}
+
+func NewPriceChangeRepo(db *sql.DB) PriceChangeRepo {
+	return &priceChangeRepo{db: db}
+}
+
+func (r *priceChangeRepo) List(ctx context.Context) ([]models.PriceChange, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT pc.id, pc.game_id, COALESCE(g.title, ''), COALESCE(pc.price_minor, 0), pc.currency, pc.percent,
+               pc.starts_at, pc.ends_at, pc.note, pc.created_at
+        FROM price_changes pc LEFT JOIN games g ON g.id = pc.game_id
+        ORDER BY pc.starts_at DESC, pc.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.PriceChange
+	for rows.Next() {
+		var pc models.PriceChange
+		var starts, ends, created string
+		if err := rows.Scan(&pc.ID, &pc.GameID, &pc.GameTitle, &pc.Price.Minor, &pc.Price.Currency, &pc.Percent,
+			&starts, &ends, &pc.Note, &created); err != nil {
+			return nil, err
+		}
+		pc.StartsAt, pc.EndsAt, pc.CreatedAt = parseTime(starts), parseTime(ends), parseTime(created)
+		out = append(out, pc)
+	}
+	return out, rows.Err()
+}
+
+func (r *priceChangeRepo) Create(ctx context.Context, pc *models.PriceChange) error {
+	pc.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	var price any
+	if pc.Percent == 0 {
+		price = pc.Price.Minor
+	}
+	res, err := r.db.ExecContext(ctx, `
+        INSERT INTO price_changes (game_id, price_minor, currency, percent, starts_at, ends_at, note, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		pc.GameID, price, pc.Price.Currency, pc.Percent, formatTime(pc.StartsAt), formatTime(pc.EndsAt), pc.Note, formatTime(pc.CreatedAt))
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	pc.ID = int(id)
+	return err
+}
+
+func (r *priceChangeRepo) Delete(ctx context.Context, id int) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM price_changes WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+type promotionRepo struct {
+	db *sql.DB
+}
+
+func NewPromotionRepo(db *sql.DB) PromotionRepo {
+	return &promotionRepo{db: db}
+}
+
+// usedBy — заказы, которые занимают скидку: отменённые и просроченные её освобождают.
+const usedBy = `SELECT COUNT(*) FROM promotion_redemptions pr JOIN purchases p ON p.id = pr.purchase_id
+        WHERE pr.promotion_id = pm.id AND p.status NOT IN ('cancelled', 'expired')`
+
+const promotionSelect = `SELECT pm.id, pm.name, COALESCE(pm.code, ''), pm.kind, pm.percent, pm.amount_minor, pm.currency,
+        COALESCE(pm.game_id, 0), COALESCE(g.title, ''), COALESCE(pm.starts_at, ''), COALESCE(pm.ends_at, ''),
+        pm.max_uses, pm.max_uses_per_customer, pm.active, pm.created_at, (` + usedBy + `)
+    FROM promotions pm LEFT JOIN games g ON g.id = pm.game_id`
+
+func scanPromotion(s rowScanner) (models.Promotion, error) {
+	var p models.Promotion
+	var starts, ends, created string
+	err := s.Scan(&p.ID, &p.Name, &p.Code, &p.Kind, &p.Percent, &p.Amount.Minor, &p.Amount.Currency,
+		&p.GameID, &p.GameTitle, &starts, &ends, &p.MaxUses, &p.MaxUsesPerCustomer, &p.Active, &created, &p.Uses)
+	if err == sql.ErrNoRows {
+		return p, ErrNotFound
+	}
+	p.StartsAt, p.EndsAt, p.CreatedAt = parseTime(starts), parseTime(ends), parseTime(created)
+	return p, err
+}
+
+func listPromotions(ctx context.Context, q dbtx, where string, args ...any) ([]models.Promotion, error) {
+	rows, err := q.QueryContext(ctx, promotionSelect+" WHERE "+where+" ORDER BY pm.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Promotion
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (r *promotionRepo) List(ctx context.Context) ([]models.Promotion, error) {
+	return listPromotions(ctx, r.db, "1 = 1")
+}
+
+func (r *promotionRepo) Get(ctx context.Context, id int) (models.Promotion, error) {
+	return scanPromotion(r.db.QueryRowContext(ctx, promotionSelect+" WHERE pm.id = ?", id))
+}
+
+// nullable — пустые значения в NULL (код распродажи, игра у скидки на весь магазин, открытые даты).
+func nullable[T comparable](v T) any {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return v
+}
+
+func nullableTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return formatTime(t)
+}
+
+func (r *promotionRepo) Create(ctx context.Context, p *models.Promotion) error {
+	p.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	if p.StartsAt.IsZero() {
+		p.StartsAt = p.CreatedAt
+	}
+	res, err := r.db.ExecContext(ctx, `
+        INSERT INTO promotions (name, code, kind, percent, amount_minor, currency, game_id, starts_at, ends_at,
+                                max_uses, max_uses_per_customer, active, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.Name, nullable(p.Code), p.Kind, p.Percent, p.Amount.Minor, p.Amount.Currency, nullable(p.GameID),
+		nullableTime(p.StartsAt), nullableTime(p.EndsAt), p.MaxUses, p.MaxUsesPerCustomer, p.Active, formatTime(p.CreatedAt))
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return ErrCouponCodeTaken
+		}
+		return err
+	}
+	id, err := res.LastInsertId()
+	p.ID = int(id)
+	return err
+}
+
+func (r *promotionRepo) SetActive(ctx context.Context, id int, active bool) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE promotions SET active = ? WHERE id = ?", active, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *promotionRepo) Applicable(ctx context.Context, userID int, code string, at time.Time) ([]models.Promotion, error) {
+	return applicablePromotions(ctx, r.db, userID, code, at)
+}
+
+// applicablePromotions — распродажи, которые идут в момент at и не исчерпаны для покупателя,
+// и купон code (если задан). Купон, которого нет или который сейчас не действует, —
+// ErrCouponNotFound, исчерпанный — ErrPromotionUsedUp.
+func applicablePromotions(ctx context.Context, q dbtx, userID int, code string, at time.Time) ([]models.Promotion, error) {
+	promos, err := listPromotions(ctx, q, "pm.active = 1 AND (pm.code IS NULL OR pm.code = ?)", strings.TrimSpace(code))
+	if err != nil {
+		return nil, err
+	}
+	var out []models.Promotion
+	couponFound := false
+	for _, p := range promos {
+		if !p.Running(at) {
+			continue
+		}
+		total, mine, err := promotionUses(ctx, q, p.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if exhausted(p, total, mine) {
+			if p.IsCoupon() {
+				return nil, ErrPromotionUsedUp
+			}
+			continue // исчерпанная распродажа просто не применяется
+		}
+		couponFound = couponFound || p.IsCoupon()
+		out = append(out, p)
+	}
+	if strings.TrimSpace(code) != "" && !couponFound {
+		return nil, ErrCouponNotFound
+	}
+	return out, nil
+}
+
+// promotionUses — сколько заказов всего и заказов покупателя занимают скидку (см. usedBy).
+func promotionUses(ctx context.Context, q dbtx, promotionID, userID int) (total, mine int, err error) {
+	err = q.QueryRowContext(ctx, `
+        SELECT COUNT(*), COALESCE(SUM(pr.user_id = ?), 0)
+        FROM promotion_redemptions pr JOIN purchases p ON p.id = pr.purchase_id
+        WHERE pr.promotion_id = ? AND p.status NOT IN (?, ?)`,
+		userID, promotionID, models.OrderCancelled, models.OrderExpired).Scan(&total, &mine)
+	return total, mine, err
+}
+
+// exhausted — скидку уже получили все разрешённые заказы (всего или у покупателя).
+func exhausted(p models.Promotion, total, mine int) bool {
+	return p.MaxUses > 0 && total >= p.MaxUses || p.MaxUsesPerCustomer > 0 && mine >= p.MaxUsesPerCustomer
+}
+
+// redeemPromotions записывает скидки заказа (внутри транзакции оформления) и ещё раз проверяет
+// лимиты: параллельное оформление могло занять последнее использование, пока считалась корзина.
+func redeemPromotions(ctx context.Context, tx dbtx, order models.Order, promos []models.Promotion) error {
+	limits := map[int]models.Promotion{}
+	for _, p := range promos {
+		limits[p.ID] = p
+	}
+	for _, ap := range order.Promotions {
+		if _, err := tx.ExecContext(ctx, `
+            INSERT INTO promotion_redemptions (promotion_id, purchase_id, user_id, discount_minor, currency, created_at)
+            VALUES (?, ?, ?, ?, ?, ?)`,
+			ap.PromotionID, order.ID, order.UserID, ap.Discount.Minor, ap.Discount.Currency, formatTime(order.CreatedAt)); err != nil {
+			return err
+		}
+		total, mine, err := promotionUses(ctx, tx, ap.PromotionID, order.UserID)
+		if err != nil {
+			return err
+		}
+		// своё использование уже записано — без него лимит не должен быть исчерпан
+		if exhausted(limits[ap.PromotionID], total-1, mine-1) {
+			return fmt.Errorf("%w: promotion %d", ErrPromotionUsedUp, ap.PromotionID)
+		}
+	}
+	return nil
+}
+
+// orderPromotions — скидки заказов по условию where, сгруппированные по заказу.
+func orderPromotions(ctx context.Context, q dbtx, where string, args ...any) (map[int][]models.AppliedPromotion, error) {
+	rows, err := q.QueryContext(ctx, `
+        SELECT pr.purchase_id, pr.promotion_id, pm.name, COALESCE(pm.code, ''), pr.discount_minor, pr.currency
+        FROM promotion_redemptions pr JOIN promotions pm ON pm.id = pr.promotion_id
+        WHERE `+where+` ORDER BY pm.code IS NOT NULL, pr.promotion_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int][]models.AppliedPromotion{}
+	for rows.Next() {
+		var orderID int
+		var ap models.AppliedPromotion
+		if err := rows.Scan(&orderID, &ap.PromotionID, &ap.Name, &ap.Code, &ap.Discount.Minor, &ap.Discount.Currency); err != nil {
+			return nil, err
+		}
+		out[orderID] = append(out[orderID], ap)
+	}
+	return out, rows.Err()
+}
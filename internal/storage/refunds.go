@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+type refundRepo struct {
+	db *sql.DB
+}
+
+func NewRefundRepo(db *sql.DB) RefundRepo {
+	return &refundRepo{db: db}
+}
+
+const refundSelect = `SELECT r.id, r.purchase_id, r.user_id, COALESCE(c.username, ''), r.status, r.reason,
+        r.amount_minor, r.currency, COALESCE(r.payment_id, 0), r.provider_refund_id, r.admin_note,
+        r.created_at, COALESCE(r.decided_at, '')
+    FROM refunds r LEFT JOIN customers c ON c.id = r.user_id`
+
+func scanRefund(s rowScanner) (models.Refund, error) {
+	var rf models.Refund
+	var created, decided string
+	err := s.Scan(&rf.ID, &rf.OrderID, &rf.UserID, &rf.Username, &rf.Status, &rf.Reason,
+		&rf.Amount.Minor, &rf.Amount.Currency, &rf.PaymentID, &rf.ProviderRefundID, &rf.AdminNote, &created, &decided)
+	if err == sql.ErrNoRows {
+		return rf, ErrNotFound
+	}
+	rf.CreatedAt, rf.DecidedAt = parseTime(created), parseTime(decided)
+	return rf, err
+}
+
+// listRefunds — заявки по условию where вместе с позициями, новые первыми.
+func (r *refundRepo) listRefunds(ctx context.Context, where string, args ...any) ([]models.Refund, error) {
+	rows, err := r.db.QueryContext(ctx, refundSelect+" WHERE "+where+" ORDER BY r.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	var out []models.Refund
+	for rows.Next() {
+		rf, err := scanRefund(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out = append(out, rf)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		if out[i].Items, err = refundItems(ctx, r.db, out[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func refundItems(ctx context.Context, q dbtx, refundID int) ([]models.OrderItem, error) {
+	rows, err := q.QueryContext(ctx, `
+        SELECT pi.id, pi.purchase_id, COALESCE(pi.game_id, 0), COALESCE(pi.bundle_id, 0), COALESCE(g.title, b.title, ''),
+               pi.price_minor, p.currency, COALESCE(pi.quantity, 1), pi.gift, pi.discount_minor
+        FROM refund_items ri
+        JOIN purchase_items pi ON pi.id = ri.purchase_item_id
+        JOIN purchases p ON p.id = pi.purchase_id
+        LEFT JOIN games g ON g.id = pi.game_id
+        LEFT JOIN bundles b ON b.id = pi.bundle_id
+        WHERE ri.refund_id = ?
+        ORDER BY pi.id
+    `, refundID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []models.OrderItem
+	for rows.Next() {
+		var it models.OrderItem
+		if err := rows.Scan(&it.ID, &it.OrderID, &it.GameID, &it.BundleID, &it.Title, &it.Price.Minor, &it.Price.Currency, &it.Quantity, &it.Gift, &it.Discount.Minor); err != nil {
+			return nil, err
+		}
+		it.Discount.Currency = it.Price.Currency
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func (r *refundRepo) Create(ctx context.Context, rf *models.Refund, itemIDs []int) error {
+	if len(itemIDs) == 0 {
+		return ErrNotFound
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		var owner int
+		var status models.OrderStatus
+		err := tx.QueryRowContext(ctx, "SELECT user_id, status, currency FROM purchases WHERE id = ?", rf.OrderID).
+			Scan(&owner, &status, &rf.Amount.Currency)
+		if err == sql.ErrNoRows || (err == nil && owner != rf.UserID) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if status != models.OrderPaid {
+			return fmt.Errorf("%w: order %d is %s", ErrInvalidTransition, rf.OrderID, status)
+		}
+
+		rf.Amount.Minor = 0
+		seen := map[int]bool{}
+		for _, id := range itemIDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			var price, discount int64
+			var qty int
+			var taken bool
+			err := tx.QueryRowContext(ctx, `
+                SELECT pi.price_minor, COALESCE(pi.quantity, 1), pi.discount_minor,
+                       EXISTS(SELECT 1 FROM refund_items ri JOIN refunds x ON x.id = ri.refund_id
+                              WHERE ri.purchase_item_id = pi.id AND x.status IN (?, ?, ?))
+                FROM purchase_items pi WHERE pi.id = ? AND pi.purchase_id = ?`,
+				models.RefundPending, models.RefundProcessing, models.RefundApproved, id, rf.OrderID).Scan(&price, &qty, &discount, &taken)
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if taken {
+				return ErrAlreadyRefunded
+			}
+			rf.Amount.Minor += price*int64(qty) - discount // возвращается то, что заплачено
+		}
+
+		rf.Status, rf.CreatedAt = models.RefundPending, now
+		res, err := tx.ExecContext(ctx, `
+            INSERT INTO refunds (purchase_id, user_id, status, reason, amount_minor, currency, created_at)
+            VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			rf.OrderID, rf.UserID, rf.Status, rf.Reason, rf.Amount.Minor, rf.Amount.Currency, formatTime(now))
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		rf.ID = int(id)
+		for _, itemID := range itemIDs {
+			if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO refund_items (refund_id, purchase_item_id) VALUES (?, ?)", rf.ID, itemID); err != nil {
+				return err
+			}
+		}
+		rf.Items, err = refundItems(ctx, tx, rf.ID)
+		return err
+	})
+}
+
+func (r *refundRepo) Get(ctx context.Context, id int) (models.Refund, error) {
+	rf, err := scanRefund(r.db.QueryRowContext(ctx, refundSelect+" WHERE r.id = ?", id))
+	if err != nil {
+		return rf, err
+	}
+	rf.Items, err = refundItems(ctx, r.db, id)
+	return rf, err
+}
+
+func (r *refundRepo) ListByUser(ctx context.Context, userID int) ([]models.Refund, error) {
+	return r.listRefunds(ctx, "r.user_id = ?", userID)
+}
+
+func (r *refundRepo) List(ctx context.Context, status models.RefundStatus) ([]models.Refund, error) {
+	if status == "" {
+		return r.listRefunds(ctx, "1 = 1")
+	}
+	return r.listRefunds(ctx, "r.status = ?", status)
+}
+
+// decide переводит заявку из from в status; заявка в другом статусе — ErrInvalidTransition.
+func decide(ctx context.Context, tx dbtx, id int, from, status models.RefundStatus, adminID int, note string, paymentID int, providerRefundID string) error {
+	var payment any
+	if paymentID != 0 {
+		payment = paymentID
+	}
+	res, err := tx.ExecContext(ctx, `
+        UPDATE refunds SET status = ?, decided_by = ?, admin_note = ?, payment_id = ?, provider_refund_id = ?, decided_at = ?
+        WHERE id = ? AND status = ?`,
+		status, adminID, note, payment, providerRefundID, formatTime(time.Now()), id, from)
+	if err != nil {
+		return err
+	}
+	return refundMoved(ctx, tx, res, id, from)
+}
+
+// refundMoved проверяет, что условный UPDATE заявки id из статуса from затронул строку:
+// иначе заявки нет (ErrNotFound) или она уже не в from (ErrInvalidTransition).
+func refundMoved(ctx context.Context, q dbtx, res sql.Result, id int, from models.RefundStatus) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	var status models.RefundStatus
+	err = q.QueryRowContext(ctx, "SELECT status FROM refunds WHERE id = ?", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: refund %d is %s, not %s", ErrInvalidTransition, id, status, from)
+}
+
+func (r *refundRepo) Claim(ctx context.Context, id int) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE refunds SET status = ? WHERE id = ? AND status = ?",
+		models.RefundProcessing, id, models.RefundPending)
+	if err != nil {
+		return err
+	}
+	return refundMoved(ctx, r.db, res, id, models.RefundPending)
+}
+
+func (r *refundRepo) Release(ctx context.Context, id int) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE refunds SET status = ? WHERE id = ? AND status = ? AND provider_refund_id = ''",
+		models.RefundPending, id, models.RefundProcessing)
+	if err != nil {
+		return err
+	}
+	return refundMoved(ctx, r.db, res, id, models.RefundProcessing)
+}
+
+func (r *refundRepo) Issued(ctx context.Context, id, paymentID int, providerRefundID string) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE refunds SET payment_id = ?, provider_refund_id = ? WHERE id = ? AND status = ?",
+		paymentID, providerRefundID, id, models.RefundProcessing)
+	if err != nil {
+		return err
+	}
+	return refundMoved(ctx, r.db, res, id, models.RefundProcessing)
+}
+
+func (r *refundRepo) Approve(ctx context.Context, id, adminID int, note string, paymentID int, providerRefundID string) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		err := decide(ctx, tx, id, models.RefundProcessing, models.RefundApproved, adminID, note, paymentID, providerRefundID)
+		if errors.Is(err, ErrInvalidTransition) && providerRefundID != "" {
+			// повтор одобрения, которое уже записалось
+			var status models.RefundStatus
+			var issued string
+			if err := tx.QueryRowContext(ctx, "SELECT status, provider_refund_id FROM refunds WHERE id = ?", id).Scan(&status, &issued); err != nil {
+				return err
+			}
+			if status == models.RefundApproved && issued == providerRefundID {
+				return nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+		var userID, orderID int
+		if err := tx.QueryRowContext(ctx, "SELECT user_id, purchase_id FROM refunds WHERE id = ?", id).Scan(&userID, &orderID); err != nil {
+			return err
+		}
+		// подарки из возвращённых позиций отзываются (кроме уже отклонённых)
+		if _, err := tx.ExecContext(ctx, `
+            UPDATE gifts SET status = ?, decided_at = ?
+            WHERE purchase_item_id IN (SELECT purchase_item_id FROM refund_items WHERE refund_id = ?) AND status IN (?, ?)`,
+			models.GiftRevoked, formatTime(time.Now()), id, models.GiftPending, models.GiftAccepted); err != nil {
+			return err
+		}
+		// ключи копий в подарок отзываются — и неактивированные, и активированные
+		if _, err := tx.ExecContext(ctx, `
+            UPDATE activation_keys SET revoked_at = ?
+            WHERE purchase_item_id IN (SELECT purchase_item_id FROM refund_items WHERE refund_id = ?) AND revoked_at IS NULL`,
+			formatTime(time.Now()), id); err != nil {
+			return err
+		}
+		// забираем из библиотеки личные копии (и игры возвращённых наборов), а у получателей
+		// и активировавших ключи — подаренные, если игру не даёт что-то ещё
+		if err := dropUngranted(ctx, tx, `user_id = ?
+              AND game_id IN (SELECT ig.game_id FROM refund_items ri JOIN purchase_items pi ON pi.id = ri.purchase_item_id
+                              JOIN (`+itemGames+`) ig ON ig.item_id = pi.id
+                              WHERE ri.refund_id = ? AND pi.gift = 0)`, userID, id); err != nil {
+			return err
+		}
+		if err := dropUngranted(ctx, tx, `EXISTS (
+                  SELECT 1 FROM refund_items ri JOIN gifts gf ON gf.purchase_item_id = ri.purchase_item_id
+                  WHERE ri.refund_id = ? AND gf.recipient_id = user_games.user_id AND gf.game_id = user_games.game_id)`, id); err != nil {
+			return err
+		}
+		if err := dropUngranted(ctx, tx, `EXISTS (
+                  SELECT 1 FROM refund_items ri JOIN activation_keys k ON k.purchase_item_id = ri.purchase_item_id
+                  WHERE ri.refund_id = ? AND k.redeemed_by = user_games.user_id AND k.game_id = user_games.game_id)`, id); err != nil {
+			return err
+		}
+		// все позиции возвращены — возвращён и заказ
+		var left int
+		if err := tx.QueryRowContext(ctx, `
+            SELECT COUNT(*) FROM purchase_items pi
+            WHERE pi.purchase_id = ?
+              AND pi.id NOT IN (SELECT ri.purchase_item_id FROM refund_items ri JOIN refunds x ON x.id = ri.refund_id
+                                WHERE x.status = ?)`,
+			orderID, models.RefundApproved).Scan(&left); err != nil {
+			return err
+		}
+		if left > 0 {
+			return nil
+		}
+		return transitionOrder(ctx, tx, orderID, models.OrderRefunded, "Возвращены все позиции")
+	})
+}
+
+func (r *refundRepo) Deny(ctx context.Context, id, adminID int, note string) error {
+	return decide(ctx, r.db, id, models.RefundPending, models.RefundDenied, adminID, note, 0, "")
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+// requestRefund просит вернуть все позиции оплаченного заказа.
+func requestRefund(t *testing.T, r Repos, o models.Order) models.Refund {
+	t.Helper()
+	ctx := context.Background()
+	full, err := r.Orders.Get(ctx, o.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, it := range full.Items {
+		ids = append(ids, it.ID)
+	}
+	rf := models.Refund{OrderID: o.ID, UserID: o.UserID, Reason: "test"}
+	if err := r.Refunds.Create(ctx, &rf, ids); err != nil {
+		t.Fatalf("create refund: %v", err)
+	}
+	return rf
+}
+
+func refundStatusOf(t *testing.T, r Repos, id int) models.RefundStatus {
+	t.Helper()
+	rf, err := r.Refunds.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rf.Status
+}
+
+func TestRefundClaim(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	admin := addCustomer(t, r, "admin")
+	game := addGame(t, r, "Doom", 1999)
+	o := placeOrder(t, r, uid, game)
+	p := payOrder(t, r, o)
+	rf := requestRefund(t, r, o)
+
+	// одобрить можно только занятую заявку
+	if err := r.Refunds.Approve(ctx, rf.ID, admin, "", p.ID, "re_1"); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("approve without claim: err = %v, want ErrInvalidTransition", err)
+	}
+	if err := r.Refunds.Claim(ctx, rf.ID); err != nil {
+		t.Fatal(err)
+	}
+	// второе одобрение той же заявки до провайдера не доходит
+	if err := r.Refunds.Claim(ctx, rf.ID); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("second claim: err = %v, want ErrInvalidTransition", err)
+	}
+	if err := r.Refunds.Deny(ctx, rf.ID, admin, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("deny while processing: err = %v, want ErrInvalidTransition", err)
+	}
+	if st := refundStatusOf(t, r, rf.ID); st != models.RefundProcessing {
+		t.Errorf("claimed refund is %s, want processing", st)
+	}
+	// позиция в проводимой заявке второй раз не возвращается
+	again := models.Refund{OrderID: o.ID, UserID: uid}
+	if err := r.Refunds.Create(ctx, &again, []int{rf.Items[0].ID}); !errors.Is(err, ErrAlreadyRefunded) {
+		t.Errorf("second request for a processing item: err = %v, want ErrAlreadyRefunded", err)
+	}
+
+	// провайдер отказал — заявка снова ждёт решения
+	if err := r.Refunds.Release(ctx, rf.ID); err != nil {
+		t.Fatal(err)
+	}
+	if st := refundStatusOf(t, r, rf.ID); st != models.RefundPending {
+		t.Errorf("released refund is %s, want pending", st)
+	}
+
+	if err := r.Refunds.Claim(ctx, rf.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Refunds.Approve(ctx, rf.ID, admin, "ok", p.ID, "re_1"); err != nil {
+		t.Fatal(err)
+	}
+	if st := refundStatusOf(t, r, rf.ID); st != models.RefundApproved {
+		t.Errorf("approved refund is %s", st)
+	}
+	if st := orderStatusOf(t, r, o.ID); st != models.OrderRefunded {
+		t.Errorf("fully refunded order is %s, want refunded", st)
+	}
+	if owns(t, r, uid, game) {
+		t.Error("refunded game is still in the library")
+	}
+	if err := r.Refunds.Release(ctx, rf.ID); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("release of an approved refund: err = %v, want ErrInvalidTransition", err)
+	}
+}
+
+func TestRefundClaimUnknown(t *testing.T) {
+	r, _ := newTestRepos(t)
+	if err := r.Refunds.Claim(context.Background(), 42); !errors.Is(err, ErrNotFound) {
+		t.Errorf("claim of a missing refund: err = %v, want ErrNotFound", err)
+	}
+}
+
+// Деньги вернули, а одобрение не записалось: заявка хранит возврат и одобряется повторно.
+func TestRefundApproveRetry(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	admin := addCustomer(t, r, "admin")
+	game := addGame(t, r, "Doom", 1999)
+	o := placeOrder(t, r, uid, game)
+	p := payOrder(t, r, o)
+	rf := requestRefund(t, r, o)
+
+	if err := r.Refunds.Issued(ctx, rf.ID, p.ID, "re_1"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("issued without claim: err = %v, want ErrInvalidTransition", err)
+	}
+	if err := r.Refunds.Claim(ctx, rf.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Refunds.Issued(ctx, rf.ID, p.ID, "re_1"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Refunds.Get(ctx, rf.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.RefundProcessing || got.PaymentID != p.ID || got.ProviderRefundID != "re_1" {
+		t.Errorf("issued refund = %s, payment %d, %q; want processing, %d, re_1", got.Status, got.PaymentID, got.ProviderRefundID, p.ID)
+	}
+	// деньги уже у покупателя — заявку нельзя вернуть в ожидание
+	if err := r.Refunds.Release(ctx, rf.ID); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("release of an issued refund: err = %v, want ErrInvalidTransition", err)
+	}
+
+	for range 2 {
+		if err := r.Refunds.Approve(ctx, rf.ID, admin, "", got.PaymentID, got.ProviderRefundID); err != nil {
+			t.Fatalf("approve: %v", err)
+		}
+	}
+	if st := refundStatusOf(t, r, rf.ID); st != models.RefundApproved {
+		t.Errorf("refund is %s, want approved", st)
+	}
+	if owns(t, r, uid, game) {
+		t.Error("refunded game is still in the library")
+	}
+	if err := r.Refunds.Approve(ctx, rf.ID, admin, "", p.ID, "re_2"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("approve with another provider refund: err = %v, want ErrInvalidTransition", err)
+	}
+}
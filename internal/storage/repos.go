@@ -0,0 +1,429 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+)
+
+var (
+	ErrNotFound      = errors.New("storage: not found")
+	ErrUsernameTaken = errors.New("storage: username taken")
+	ErrEmailTaken    = errors.New("storage: email taken")
+	ErrGameSold      = errors.New("storage: game has been sold")
+	ErrBundleSold    = errors.New("storage: bundle has been sold")
+	ErrEmptyCart     = errors.New("storage: cart is empty")
+	ErrTermExists    = errors.New("storage: genre or tag already exists")
+	// ErrPriceUnavailable — у игры из корзины нет цены в валюте покупателя.
+	ErrPriceUnavailable = errors.New("storage: game has no price in this currency")
+	// ErrDuplicateEvent — событие провайдера уже обработано (повтор вебхука).
+	ErrDuplicateEvent = errors.New("storage: payment event already processed")
+	ErrInvalidRefund  = errors.New("storage: refund exceeds payment")
+	// ErrOrderClosed — оплата пришла по заказу, который уже нельзя оплатить (отменён, просрочен
+	// или оплачен другой попыткой): заказ не меняется, деньги нужно вернуть покупателю.
+	ErrOrderClosed = errors.New("storage: order no longer accepts payment")
+	// ErrInvalidTransition — такой смены статуса заказа не бывает (см. models.OrderStatus).
+	ErrInvalidTransition = errors.New("storage: invalid order status transition")
+	// ErrAlreadyRefunded — позиция уже в ожидающей или одобренной заявке на возврат.
+	ErrAlreadyRefunded = errors.New("storage: order item already refunded")
+	// ErrIdempotentReplay — операция с этим ключом идемпотентности уже выполнялась;
+	// вместе с ошибкой возвращается её первый результат.
+	ErrIdempotentReplay = errors.New("storage: idempotency key already used")
+	// ErrAlreadyOwned — личная копия игры, которая уже есть в библиотеке покупателя
+	// (или набор, все игры которого уже есть).
+	ErrAlreadyOwned = errors.New("storage: game already owned")
+	// ErrCouponNotFound — купона с таким кодом нет, он выключен, ещё не начался или уже закончился.
+	ErrCouponNotFound = errors.New("storage: coupon not found")
+	// ErrCouponNotApplicable — купон не снижает цену ни одной строки корзины (другие игры или валюта).
+	ErrCouponNotApplicable = errors.New("storage: coupon does not apply to the cart")
+	// ErrPromotionUsedUp — лимит использований скидки исчерпан (всего или для покупателя).
+	ErrPromotionUsedUp = errors.New("storage: promotion usage limit reached")
+	ErrCouponCodeTaken = errors.New("storage: coupon code already exists")
+	// ErrKeyRedeemed — ключ активации уже активирован (ключ одноразовый).
+	ErrKeyRedeemed = errors.New("storage: activation key already redeemed")
+	// ErrKeyRevoked — ключ активации отозван: за копию в подарок вернули деньги.
+	ErrKeyRevoked = errors.New("storage: activation key revoked")
+	// ErrInvalidGift — получатель подарка указан не для одной копии игры в подарок
+	// (или строки корзины уже нет).
+	ErrInvalidGift = errors.New("storage: gift recipient needs a single gift copy")
+)
+
+// GameRepo — каталог игр. Методы с валютой cur отдают цены в ней (см. models.Game.Unavailable);
+// пустая cur — базовые цены.
+type GameRepo interface {
+	// Latest — последние limit опубликованных игр (рекомендации).
+	Latest(ctx context.Context, cur money.Currency, limit int) ([]models.Game, error)
+	// ListAll — все игры с базовыми ценами, включая снятые с публикации (для админки).
+	ListAll(ctx context.Context) ([]models.Game, error)
+	// Get возвращает игру вместе с жанрами, тегами и региональными ценами.
+	Get(ctx context.Context, id int, cur money.Currency) (models.Game, error)
+	// Browse — страница опубликованных игр по фильтру и сортировке и общее число подходящих игр.
+	Browse(ctx context.Context, q GameQuery) ([]models.Game, int, error)
+	// Facets считает игры по жанрам, тегам, ценам и оценкам для фильтра f.
+	Facets(ctx context.Context, f GameFilter) (models.Facets, error)
+	// Search — полнотекстовый поиск по опубликованным играм (название и описание),
+	// слова ищутся по префиксу, результаты отсортированы по релевантности.
+	Search(ctx context.Context, query string, cur money.Currency, limit int) ([]models.SearchHit, error)
+	// Create и Update сохраняют игру вместе с g.Genres и g.Tags (важны только ID)
+	// и региональными ценами g.Prices.
+	Create(ctx context.Context, g *models.Game) error
+	Update(ctx context.Context, g models.Game) error
+	// SetPublished снимает игру с публикации (и убирает её из корзин) или возвращает в каталог.
+	SetPublished(ctx context.Context, id int, published bool) error
+	// Delete удаляет игру вместе с корзинами и отзывами (и из наборов, списков желаемого и скидок на неё); купленную,
+	// подаренную или с выпущенными ключами активации — нельзя (ErrGameSold).
+	Delete(ctx context.Context, id int) error
+}
+
+// BundleRepo — наборы игр (bundles, bundle_games).
+type BundleRepo interface {
+	// List — опубликованные наборы (all — и снятые, для админки) с играми, новые первыми.
+	List(ctx context.Context, all bool) ([]models.Bundle, error)
+	// ByGame — опубликованные наборы, в которые входит игра.
+	ByGame(ctx context.Context, gameID int) ([]models.Bundle, error)
+	// Get возвращает набор с играми; у игр, которые уже есть в библиотеке userID, — Owned.
+	Get(ctx context.Context, id, userID int) (models.Bundle, error)
+	// Create и Update сохраняют набор вместе с составом b.Games (важны только ID).
+	// Снятый с публикации набор убирается из корзин.
+	Create(ctx context.Context, b *models.Bundle) error
+	Update(ctx context.Context, b models.Bundle) error
+	SetPublished(ctx context.Context, id int, published bool) error
+	// Delete удаляет набор; купленный — нельзя (ErrBundleSold).
+	Delete(ctx context.Context, id int) error
+}
+
+// CustomerRepo — покупатели.
+type CustomerRepo interface {
+	Create(ctx context.Context, username, passwordHash string) (models.Customer, error)
+	Get(ctx context.Context, id int) (models.Customer, error)
+	GetByUsername(ctx context.Context, username string) (models.Customer, error)
+	// GetByEmail ищет покупателя по email без учёта регистра.
+	GetByEmail(ctx context.Context, email string) (models.Customer, error)
+	List(ctx context.Context) ([]models.Customer, error)
+	UpdatePassword(ctx context.Context, id int, passwordHash string) error
+	SetRole(ctx context.Context, id int, role models.Role) error
+	// SetCurrency сохраняет валюту покупателя.
+	SetCurrency(ctx context.Context, id int, cur money.Currency) error
+	// SetEmail сохраняет email покупателя (пустой — убирает); занятый другим — ErrEmailTaken.
+	SetEmail(ctx context.Context, id int, email string) error
+}
+
+// CartRepo — корзины покупателей.
+type CartRepo interface {
+	// Items — строки корзины с ценами в валюте cur и скидками идущих распродаж
+	// (на момент из WithPriceTime, по умолчанию — сейчас).
+	Items(ctx context.Context, userID int, cur money.Currency) ([]models.CartItem, error)
+	// Quote — как Items, но ещё и с купоном coupon (пустой — без купона); возвращает и применённые
+	// скидки. Ошибки купона — ErrCouponNotFound, ErrPromotionUsedUp, ErrCouponNotApplicable.
+	Quote(ctx context.Context, userID int, cur money.Currency, coupon string) ([]models.CartItem, []models.AppliedPromotion, error)
+	// Add добавляет игру в корзину. Личная копия (gift == false) всегда одна, qty не важен;
+	// если игра уже в библиотеке — ErrAlreadyOwned. Копии в подарок складываются,
+	// но не больше models.MaxGiftCopies.
+	Add(ctx context.Context, userID, gameID, qty int, gift bool) error
+	// AddBundle кладёт набор в корзину (если его там ещё нет); если все игры набора уже
+	// в библиотеке — ErrAlreadyOwned.
+	AddBundle(ctx context.Context, userID, bundleID int) error
+	// Remove удаляет строку корзины по её id.
+	Remove(ctx context.Context, userID, itemID int) error
+	// RemoveGame удаляет игру из корзины по game_id.
+	RemoveGame(ctx context.Context, userID, gameID int) error
+}
+
+// VoidFunc отменяет у платёжного провайдера намерения ожидающих платежей заказа orderID.
+type VoidFunc func(ctx context.Context, orderID int) error
+
+// OrderRepo — заказы (purchases и purchase_items) и история их статусов (order_events).
+type OrderRepo interface {
+	// CreateFromCart превращает корзину в неоплаченный заказ в валюте cur со скидками
+	// распродаж и купона coupon (ошибки купона — как у CartRepo.Quote) и очищает её.
+	// Если у какой-то игры нет цены в cur — ErrPriceUnavailable, если личная копия
+	// уже в библиотеке — ErrAlreadyOwned. gifts — получатели подарков по id строк корзины
+	// (важны RecipientID и Message; строка должна быть одной копией в подарок). Непустой idemKey делает
+	// вызов идемпотентным: повтор с тем же ключом возвращает первый заказ и ErrIdempotentReplay.
+	CreateFromCart(ctx context.Context, userID int, cur money.Currency, coupon, idemKey string, gifts map[int]models.Gift) (models.Order, error)
+	// Get возвращает заказ вместе с позициями, скидками и историей.
+	Get(ctx context.Context, id int) (models.Order, error)
+	// ListByUser — заказы покупателя со скидками и историей (без позиций), новые первыми.
+	ListByUser(ctx context.Context, userID int) ([]models.Order, error)
+	// Transition переводит заказ в статус to с причиной reason; запрещённый переход —
+	// ErrInvalidTransition. Оплату (OrderPaid) проставляет только PaymentRepo.
+	Transition(ctx context.Context, id int, to models.OrderStatus, reason string) error
+	// ExpireUnpaid переводит в OrderExpired неоплаченные заказы, которые создали (или в последний
+	// раз пытались оплатить) раньше idleBefore, и при restoreCart возвращает их позиции в корзину.
+	// Перед переходом void отменяет намерения ожидающих платежей у провайдера; если не смог
+	// (например, оплата уже прошла), заказ пропускается. Возвращает id просроченных заказов.
+	ExpireUnpaid(ctx context.Context, idleBefore time.Time, restoreCart bool, void VoidFunc) ([]int, error)
+}
+
+// GiftRepo — подарки: копии игр, купленные для других покупателей. Заводятся при оформлении
+// заказа (OrderRepo.CreateFromCart), в библиотеку получателя попадают при оплате.
+type GiftRepo interface {
+	// Inbox — подарки из оплаченных заказов покупателю userID, новые первыми.
+	Inbox(ctx context.Context, userID int) ([]models.Gift, error)
+	// Sent — подарки, которые покупатель userID оформил другим, новые первыми.
+	Sent(ctx context.Context, userID int) ([]models.Gift, error)
+	// PendingCount — сколько подарков ждут ответа покупателя userID.
+	PendingCount(ctx context.Context, userID int) (int, error)
+	// Accept оставляет подарок в библиотеке получателя, Decline забирает его оттуда (если игру
+	// не даёт что-то ещё). Чужой или неоплаченный подарок — ErrNotFound, уже решённый — ErrInvalidTransition.
+	Accept(ctx context.Context, id, userID int) error
+	Decline(ctx context.Context, id, userID int) error
+}
+
+// KeyRepo — ключи активации игр (activation_keys) для продаж через партнёров и копий в подарок без получателя.
+type KeyRepo interface {
+	// Add сохраняет коды codes (в models.NormalizeKey-виде) как ключи игры gameID из партии batch,
+	// выпущенные администратором adminID. Уже существующие коды пропускаются; возвращает добавленные ключи.
+	Add(ctx context.Context, gameID int, codes []string, batch string, adminID int) ([]models.ActivationKey, error)
+	// Stock — запас ключей по играм: сколько выпущено и сколько активировано (без ключей из заказов).
+	Stock(ctx context.Context) ([]models.KeyStock, error)
+	// List — ключи игры gameID (непустой batch — только этой партии) по порядку выпуска.
+	List(ctx context.Context, gameID int, batch string) ([]models.ActivationKey, error)
+	// Redemptions — последние limit активаций, новые первыми.
+	Redemptions(ctx context.Context, limit int) ([]models.ActivationKey, error)
+	// Redeem активирует ключ code покупателем userID: игра попадает в его библиотеку, а личная копия
+	// этой игры убирается из корзины. Нет такого ключа — ErrNotFound, уже активирован — ErrKeyRedeemed,
+	// отозван — ErrKeyRevoked, игра уже в библиотеке — ErrAlreadyOwned (ключ остаётся неактивированным).
+	Redeem(ctx context.Context, userID int, code string) (models.ActivationKey, error)
+}
+
+// PromotionRepo — скидки: распродажи и купоны (promotions) и их использования в заказах.
+type PromotionRepo interface {
+	// List — все скидки с числом использований, новые первыми.
+	List(ctx context.Context) ([]models.Promotion, error)
+	Get(ctx context.Context, id int) (models.Promotion, error)
+	// Create сохраняет скидку и проставляет ID и CreatedAt (и StartsAt, если не задано);
+	// занятый код купона — ErrCouponCodeTaken.
+	Create(ctx context.Context, p *models.Promotion) error
+	// SetActive включает или выключает скидку.
+	SetActive(ctx context.Context, id int, active bool) error
+	// Applicable — распродажи, которые идут в момент at и не исчерпаны для покупателя userID,
+	// и купон code, если задан (иначе — ErrCouponNotFound или ErrPromotionUsedUp).
+	Applicable(ctx context.Context, userID int, code string, at time.Time) ([]models.Promotion, error)
+}
+
+// PriceChangeRepo — календарь цен (price_changes). Цены каталога и корзины учитывают его сами,
+// на момент из WithPriceTime или на текущий.
+type PriceChangeRepo interface {
+	// List — все изменения цен, поздние первыми.
+	List(ctx context.Context) ([]models.PriceChange, error)
+	// Create сохраняет изменение и проставляет ID и CreatedAt.
+	Create(ctx context.Context, pc *models.PriceChange) error
+	Delete(ctx context.Context, id int) error
+}
+
+// RefundRepo — заявки на возврат (refunds, refund_items).
+type RefundRepo interface {
+	// Create сохраняет заявку покупателя rf.UserID на позиции itemIDs его оплаченного заказа
+	// rf.OrderID и считает сумму. Чужой заказ или позиция — ErrNotFound, неоплаченный
+	// заказ — ErrInvalidTransition, позиция уже в заявке — ErrAlreadyRefunded.
+	Create(ctx context.Context, rf *models.Refund, itemIDs []int) error
+	Get(ctx context.Context, id int) (models.Refund, error)
+	ListByUser(ctx context.Context, userID int) ([]models.Refund, error)
+	// List — заявки в статусе status (пустой — все), новые первыми.
+	List(ctx context.Context, status models.RefundStatus) ([]models.Refund, error)
+	// Claim занимает ожидающую заявку под одобрение (RefundPending → RefundProcessing) до
+	// обращения к провайдеру: одну заявку не вернут дважды. Заявка не в RefundPending —
+	// ErrInvalidTransition.
+	Claim(ctx context.Context, id int) error
+	// Release возвращает занятую заявку в RefundPending, если провайдер деньги не вернул.
+	// Заявку с сохранённым через Issued возвратом не отпускает — ErrInvalidTransition.
+	Release(ctx context.Context, id int) error
+	// Issued запоминает у занятой заявки платёж и возврат у провайдера сразу после того, как
+	// провайдер вернул деньги: если одобрение не запишется, его можно повторить без второго
+	// возврата. Заявка не в RefundProcessing — ErrInvalidTransition.
+	Issued(ctx context.Context, id, paymentID int, providerRefundID string) error
+	// Approve одобряет занятую через Claim заявку, привязывает её к платежу и возврату у
+	// провайдера (paymentID 0 — заказ без платежа), отзывает ключи копий в подарок и забирает
+	// игры из библиотеки. Когда возвращены все позиции, заказ становится OrderRefunded.
+	// Повтор для уже одобренной заявки с тем же providerRefundID ничего не меняет;
+	// иначе заявка не в RefundProcessing — ErrInvalidTransition.
+	Approve(ctx context.Context, id, adminID int, note string, paymentID int, providerRefundID string) error
+	Deny(ctx context.Context, id, adminID int, note string) error
+}
+
+// IdempotencyRepo — выполненные операции по ключам идемпотентности (idempotency_keys).
+type IdempotencyRepo interface {
+	// Lookup — результат операции op с ключом key; ErrNotFound, если её не было.
+	Lookup(ctx context.Context, userID int, op models.IdempotencyOp, key string) (models.IdempotencyKey, error)
+}
+
+// PaymentRepo — платежи по заказам (payments). Оплаченным заказ делает только MarkSucceeded.
+// Методы с событием ev применяют его в одной транзакции с записью в processed_events:
+// повтор события — ErrDuplicateEvent без изменений.
+type PaymentRepo interface {
+	// Create сохраняет платёж и проставляет ID и даты. С непустым idem.Key (и idem.UserID)
+	// повтор с тем же ключом ничего не создаёт: в p — первый платёж, ошибка — ErrIdempotentReplay.
+	Create(ctx context.Context, p *models.Payment, idem models.IdempotencyKey) error
+	Get(ctx context.Context, id int) (models.Payment, error)
+	GetByIntent(ctx context.Context, provider, intentID string) (models.Payment, error)
+	// LatestForOrder — последняя попытка оплаты заказа; ErrNotFound, если оплату не начинали.
+	LatestForOrder(ctx context.Context, orderID int) (models.Payment, error)
+	// Succeeded — платёж, которым оплачен заказ (в том числе частично возвращённый);
+	// ErrNotFound, если такого нет.
+	Succeeded(ctx context.Context, orderID int) (models.Payment, error)
+	// Pending — ожидающие попытки оплаты заказа: их намерения ещё можно оплатить у провайдера.
+	Pending(ctx context.Context, orderID int) ([]models.Payment, error)
+	// MarkSucceeded отмечает платёж успешным, заказ — оплаченным и выдаёт игры
+	// в библиотеку покупателя. Если заказ уже нельзя оплатить — ErrOrderClosed без изменений
+	// (и без отметки события): деньги возвращает вызывающий.
+	MarkSucceeded(ctx context.Context, id int, ev models.ProcessedEvent) error
+	// MarkFailed отмечает отклонённым ожидающий платёж (другие не меняются).
+	MarkFailed(ctx context.Context, id int, reason string, ev models.ProcessedEvent) error
+	// AddRefund учитывает возврат; полностью возвращённый платёж — PaymentRefunded.
+	// Возврат больше остатка или в другой валюте — ErrInvalidRefund.
+	AddRefund(ctx context.Context, id int, amount money.Amount, ev models.ProcessedEvent) error
+	// RecordEvent запоминает событие, которое ничего не меняет (неизвестный тип).
+	RecordEvent(ctx context.Context, ev models.ProcessedEvent) error
+}
+
+// ReviewRepo — отзывы (таблица comments).
+type ReviewRepo interface {
+	ListByGame(ctx context.Context, gameID int) ([]models.Review, error)
+	Get(ctx context.Context, id int) (models.Review, error)
+	Create(ctx context.Context, rv *models.Review) error
+	Update(ctx context.Context, rv models.Review) error
+	Delete(ctx context.Context, id int) error
+}
+
+// LibraryRepo — купленные игры (user_games).
+type LibraryRepo interface {
+	List(ctx context.Context, userID int) ([]models.Game, error)
+	// Owns — есть ли игра в библиотеке покупателя.
+	Owns(ctx context.Context, userID, gameID int) (bool, error)
+}
+
+// WishlistRepo — список желаемого (wishlist_items) и уведомления покупателям о снижении цен
+// на игры из него (notifications).
+type WishlistRepo interface {
+	// Add кладёт игру в список желаемого; повтор ничего не меняет.
+	Add(ctx context.Context, userID, gameID int) error
+	// Remove убирает игру из списка; если её там нет — ErrNotFound.
+	Remove(ctx context.Context, userID, gameID int) error
+	// List — список желаемого с ценами в валюте cur (с календарём цен и распродажами), новые первыми.
+	List(ctx context.Context, userID int, cur money.Currency) ([]models.WishlistItem, error)
+	// GameIDs — какие игры покупатель уже добавил (для кнопок каталога).
+	GameIDs(ctx context.Context, userID int) (map[int]bool, error)
+	// Notifications — последние limit уведомлений покупателя, новые первыми.
+	Notifications(ctx context.Context, userID, limit int) ([]models.Notification, error)
+	UnreadCount(ctx context.Context, userID int) (int, error)
+	// MarkRead отмечает прочитанными все уведомления покупателя.
+	MarkRead(ctx context.Context, userID int) error
+	// CheckPrices сравнивает цены игр из списков желаемого на момент at с ценами, о которых
+	// покупатели уже знают, и записывает уведомления о снижении. Ошибка по одному покупателю
+	// пишется в лог и не мешает проверить остальных. Возвращает число новых уведомлений.
+	CheckPrices(ctx context.Context, at time.Time) (int, error)
+}
+
+// TermRepo — справочник жанров или тегов.
+type TermRepo interface {
+	List(ctx context.Context) ([]models.Term, error)
+	// Create добавляет запись, slug строится из названия; дубликат — ErrTermExists.
+	Create(ctx context.Context, name string) (models.Term, error)
+	// Delete удаляет запись вместе с её связями с играми.
+	Delete(ctx context.Context, id int) error
+	ForGame(ctx context.Context, gameID int) ([]models.Term, error)
+}
+
+// TokenRepo — персональные токены доступа (api_tokens). Хранится только хеш токена.
+type TokenRepo interface {
+	// Create сохраняет токен (с заполненными UserID, Name, Scopes) и проставляет ID и CreatedAt.
+	Create(ctx context.Context, t *models.APIToken, tokenHash string) error
+	ListByUser(ctx context.Context, userID int) ([]models.APIToken, error)
+	// GetActiveByHash ищет неотозванный токен по хешу.
+	GetActiveByHash(ctx context.Context, tokenHash string) (models.APIToken, error)
+	// Touch обновляет время последнего использования.
+	Touch(ctx context.Context, id int, at time.Time) error
+	// Revoke отзывает токен пользователя; чужой или уже отозванный — ErrNotFound.
+	Revoke(ctx context.Context, userID, id int) error
+}
+
+// Repos собирает все репозитории; встраивается в handlers.Handler.
+type Repos struct {
+	Games       GameRepo
+	Bundles     BundleRepo
+	Customers   CustomerRepo
+	Carts       CartRepo
+	Orders      OrderRepo
+	Gifts       GiftRepo
+	Keys        KeyRepo
+	Promotions  PromotionRepo
+	Prices      PriceChangeRepo
+	Refunds     RefundRepo
+	Payments    PaymentRepo
+	Idempotency IdempotencyRepo
+	Reviews     ReviewRepo
+	Libraries   LibraryRepo
+	Wishlists   WishlistRepo
+	Tokens      TokenRepo
+	Genres      TermRepo
+	Tags        TermRepo
+}
+
+// NewRepos — репозитории поверх SQLite.
+func NewRepos(db *sql.DB) Repos {
+	return Repos{
+		Games:       NewGameRepo(db),
+		Bundles:     NewBundleRepo(db),
+		Customers:   NewCustomerRepo(db),
+		Carts:       NewCartRepo(db),
+		Orders:      NewOrderRepo(db),
+		Gifts:       NewGiftRepo(db),
+		Keys:        NewKeyRepo(db),
+		Promotions:  NewPromotionRepo(db),
+		Prices:      NewPriceChangeRepo(db),
+		Refunds:     NewRefundRepo(db),
+		Payments:    NewPaymentRepo(db),
+		Idempotency: NewIdempotencyRepo(db),
+		Reviews:     NewReviewRepo(db),
+		Libraries:   NewLibraryRepo(db),
+		Wishlists:   NewWishlistRepo(db),
+		Tokens:      NewTokenRepo(db),
+		Genres:      NewGenreRepo(db),
+		Tags:        NewTagRepo(db),
+	}
+}
+
+// timeLayouts — форматы дат, которые встречаются в games.db:
+// RFC3339 из Go-кода и "YYYY-MM-DD HH:MM:SS" из CURRENT_TIMESTAMP.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+// parseTime разбирает дату из базы; нераспознанная дата превращается в нулевое время.
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// dbtx — общее у *sql.DB и *sql.Tx, чтобы запросы можно было выполнять и внутри транзакции.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// inTx выполняет fn в транзакции: коммит при nil, откат при ошибке.
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+type reviewRepo struct {
+	db *sql.DB
+}
+
+func NewReviewRepo(db *sql.DB) ReviewRepo {
+	return &reviewRepo{db: db}
+}
+
+// reviewSelect — join с customers, чтобы сразу получить имя автора
+const reviewSelect = `
+    SELECT c.id, c.game_id, c.user_id, COALESCE(co.username, ''), c.rating, COALESCE(c.text, ''), c.created_at
+    FROM comments c
+    LEFT JOIN customers co ON co.id = c.user_id`
+
+func scanReview(s rowScanner) (models.Review, error) {
+	var rv models.Review
+	var created string
+	if err := s.Scan(&rv.ID, &rv.GameID, &rv.UserID, &rv.Author, &rv.Rating, &rv.Text, &created); err != nil {
+		return rv, err
+	}
+	rv.CreatedAt = parseTime(created)
+	return rv, nil
+}
+
+func (r *reviewRepo) ListByGame(ctx context.Context, gameID int) ([]models.Review, error) {
+	rows, err := r.db.QueryContext(ctx, reviewSelect+" WHERE c.game_id = ? ORDER BY c.created_at DESC", gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Review
+	for rows.Next() {
+		rv, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rv)
+	}
+	return out, rows.Err()
+}
+
+func (r *reviewRepo) Get(ctx context.Context, id int) (models.Review, error) {
+	rv, err := scanReview(r.db.QueryRowContext(ctx, reviewSelect+" WHERE c.id = ?", id))
+	if err == sql.ErrNoRows {
+		return rv, ErrNotFound
+	}
+	return rv, err
+}
+
+func (r *reviewRepo) Create(ctx context.Context, rv *models.Review) error {
+	res, err := r.db.ExecContext(ctx, "INSERT INTO comments (game_id, user_id, rating, text, created_at) VALUES (?, ?, ?, ?, ?)",
+		rv.GameID, rv.UserID, rv.Rating, rv.Text, formatTime(rv.CreatedAt))
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	rv.ID = int(id)
+	return err
+}
+
+func (r *reviewRepo) Update(ctx context.Context, rv models.Review) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE comments SET rating = ?, text = ?, created_at = ? WHERE id = ?",
+		rv.Rating, rv.Text, formatTime(rv.CreatedAt), rv.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *reviewRepo) Delete(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM comments WHERE id = ?", id)
+	return err
+}
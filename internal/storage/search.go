@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+)
+
+// MaxSearchQuery — ограничение длины поискового запроса в символах.
+const MaxSearchQuery = 200
+
+// ftsQuery превращает пользовательский ввод в запрос FTS5: каждое слово берётся
+// в кавычки (операторы и спецсимволы FTS5 теряют смысл) и ищется по префиксу,
+// слова объединяются через AND. Пустой ввод даёт пустую строку.
+func ftsQuery(input string) string {
+	if r := []rune(input); len(r) > MaxSearchQuery {
+		input = string(r[:MaxSearchQuery])
+	}
+	var terms []string
+	for _, w := range strings.Fields(input) {
+		terms = append(terms, `"`+strings.ReplaceAll(w, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// searchQuery — название весит в 10 раз больше описания; %s — источник игр из pricedGames.
+const searchQuery = `
+    SELECT ` + qualifiedGameColumns + `,
+           highlight(games_fts, 0, char(2), char(3)),
+           snippet(games_fts, 1, char(2), char(3), '…', 24),
+           bm25(games_fts, 10.0, 1.0) AS rank
+    FROM games_fts
+    JOIN %s ON g.id = games_fts.rowid
+    WHERE games_fts MATCH ? AND g.published = 1
+    ORDER BY rank, g.id DESC
+    LIMIT ?`
+
+func (r *gameRepo) Search(ctx context.Context, query string, cur money.Currency, limit int) ([]models.SearchHit, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+	from, args := pricedGames(cur, priceTime(ctx))
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(searchQuery, from), append(args, match, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var hits []models.SearchHit
+	for rows.Next() {
+		var h models.SearchHit
+		var description, image, title, snippet sql.NullString
+		var price, list sql.NullInt64
+		if err := rows.Scan(&h.ID, &h.Title, &description, &price, &h.Price.Currency, &image, &h.Published, &list, &title, &snippet, &h.Rank); err != nil {
+			return nil, err
+		}
+		h.Price.Minor, h.Unavailable = price.Int64, !price.Valid
+		h.OriginalPrice = originalPrice(h.Price, list)
+		h.Description, h.ImageURL = description.String, image.String
+		h.TitleHighlight, h.Snippet = title.String, snippet.String
+		hits = append(hits, h)
+	}
+	return hits, rows.Err()
+}
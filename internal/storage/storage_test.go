@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aml-709/game-store/internal/migrations"
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+)
+
+// newTestRepos открывает пустую базу во временном каталоге теста и применяет все миграции;
+// db — для подготовки данных, которых не сделать через репозитории (например, старых дат).
+func newTestRepos(t *testing.T) (Repos, *sql.DB) {
+	t.Helper()
+	db, err := Open(filepath.Join(t.TempDir(), "games.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.Up(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return NewRepos(db), db
+}
+
+func addCustomer(t *testing.T, r Repos, username string) int {
+	t.Helper()
+	c, err := r.Customers.Create(context.Background(), username, "hash")
+	if err != nil {
+		t.Fatalf("create customer %s: %v", username, err)
+	}
+	return c.ID
+}
+
+// addGame заводит опубликованную игру с ценой в минорных единицах доллара.
+func addGame(t *testing.T, r Repos, title string, minor int64) int {
+	t.Helper()
+	g := models.Game{Title: title, Price: money.New(minor, money.USD), Published: true}
+	if err := r.Games.Create(context.Background(), &g); err != nil {
+		t.Fatalf("create game %s: %v", title, err)
+	}
+	return g.ID
+}
+
+// placeOrder кладёт личные копии игр в корзину и оформляет заказ.
+func placeOrder(t *testing.T, r Repos, userID int, gameIDs ...int) models.Order {
+	t.Helper()
+	ctx := context.Background()
+	for _, id := range gameIDs {
+		if err := r.Carts.Add(ctx, userID, id, 1, false); err != nil {
+			t.Fatalf("add game %d to cart: %v", id, err)
+		}
+	}
+	o, err := r.Orders.CreateFromCart(ctx, userID, money.USD, "", "", nil)
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	return o
+}
+
+// startPayment заводит ожидающий платёж на всю сумму заказа.
+func startPayment(t *testing.T, r Repos, o models.Order, intentID string) models.Payment {
+	t.Helper()
+	p := models.Payment{OrderID: o.ID, Provider: "fake", IntentID: intentID, Amount: o.Total}
+	if err := r.Payments.Create(context.Background(), &p, models.IdempotencyKey{}); err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	return p
+}
+
+// payOrder оплачивает заказ так же, как это делает вебхук провайдера.
+func payOrder(t *testing.T, r Repos, o models.Order) models.Payment {
+	t.Helper()
+	p := startPayment(t, r, o, "pi_"+time.Now().Format("150405.000000000"))
+	if err := r.Payments.MarkSucceeded(context.Background(), p.ID, event("evt_paid_"+p.IntentID)); err != nil {
+		t.Fatalf("mark payment %d succeeded: %v", p.ID, err)
+	}
+	return p
+}
+
+func event(id string) models.ProcessedEvent {
+	return models.ProcessedEvent{Provider: "fake", ID: id, Type: "payment.succeeded", ProcessedAt: time.Now()}
+}
+
+func owns(t *testing.T, r Repos, userID, gameID int) bool {
+	t.Helper()
+	ok, err := r.Libraries.Owns(context.Background(), userID, gameID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+func orderStatusOf(t *testing.T, r Repos, id int) models.OrderStatus {
+	t.Helper()
+	o, err := r.Orders.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o.Status
+}
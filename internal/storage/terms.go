@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+// termTables — таблицы справочника (genres, tags) и его связи с играми.
+type termTables struct {
+	table string // справочник
+	link  string // связь с games
+	fk    string // колонка связи, ссылающаяся на справочник
+}
+
+var (
+	genreTables = termTables{table: "genres", link: "game_genres", fk: "genre_id"}
+	tagTables   = termTables{table: "tags", link: "game_tags", fk: "tag_id"}
+)
+
+type termRepo struct {
+	db *sql.DB
+	t  termTables
+}
+
+func NewGenreRepo(db *sql.DB) TermRepo {
+	return &termRepo{db: db, t: genreTables}
+}
+
+func NewTagRepo(db *sql.DB) TermRepo {
+	return &termRepo{db: db, t: tagTables}
+}
+
+func scanTerms(rows *sql.Rows) ([]models.Term, error) {
+	defer rows.Close()
+	var out []models.Term
+	for rows.Next() {
+		var t models.Term
+		if err := rows.Scan(&t.ID, &t.Name, &t.Slug); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (r *termRepo) List(ctx context.Context) ([]models.Term, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id, name, slug FROM "+r.t.table+" ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	return scanTerms(rows)
+}
+
+func (r *termRepo) Create(ctx context.Context, name string) (models.Term, error) {
+	t := models.Term{Name: name, Slug: models.Slugify(name)}
+	res, err := r.db.ExecContext(ctx, "INSERT INTO "+r.t.table+" (name, slug) VALUES (?, ?)", t.Name, t.Slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return t, ErrTermExists
+		}
+		return t, err
+	}
+	id, err := res.LastInsertId()
+	t.ID = int(id)
+	return t, err
+}
+
+func (r *termRepo) Delete(ctx context.Context, id int) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+r.t.link+" WHERE "+r.t.fk+" = ?", id); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, "DELETE FROM "+r.t.table+" WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (r *termRepo) ForGame(ctx context.Context, gameID int) ([]models.Term, error) {
+	return gameTerms(ctx, r.db, r.t, gameID)
+}
+
+func gameTerms(ctx context.Context, q dbtx, t termTables, gameID int) ([]models.Term, error) {
+	rows, err := q.QueryContext(ctx, `
+        SELECT t.id, t.name, t.slug FROM `+t.table+` t
+        JOIN `+t.link+` l ON l.`+t.fk+` = t.id
+        WHERE l.game_id = ? ORDER BY t.name`, gameID)
+	if err != nil {
+		return nil, err
+	}
+	return scanTerms(rows)
+}
+
+// setGameTerms заменяет жанры (или теги) игры на terms; неизвестные id пропускаются.
+func setGameTerms(ctx context.Context, q dbtx, t termTables, gameID int, terms []models.Term) error {
+	if _, err := q.ExecContext(ctx, "DELETE FROM "+t.link+" WHERE game_id = ?", gameID); err != nil {
+		return err
+	}
+	for _, term := range terms {
+		_, err := q.ExecContext(ctx, "INSERT OR IGNORE INTO "+t.link+" (game_id, "+t.fk+") SELECT ?, id FROM "+t.table+" WHERE id = ?",
+			gameID, term.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+type tokenRepo struct {
+	db *sql.DB
+}
+
+func NewTokenRepo(db *sql.DB) TokenRepo {
+	return &tokenRepo{db: db}
+}
+
+const tokenColumns = "id, user_id, name, scopes, created_at, last_used_at, revoked_at"
+
+func scanToken(s rowScanner) (models.APIToken, error) {
+	var t models.APIToken
+	var scopes, created string
+	var used, revoked sql.NullString
+	err := s.Scan(&t.ID, &t.UserID, &t.Name, &scopes, &created, &used, &revoked)
+	if err == sql.ErrNoRows {
+		return t, ErrNotFound
+	}
+	if err != nil {
+		return t, err
+	}
+	for _, sc := range strings.Fields(scopes) {
+		t.Scopes = append(t.Scopes, models.Scope(sc))
+	}
+	t.CreatedAt = parseTime(created)
+	t.LastUsedAt = parseTime(used.String)
+	t.RevokedAt = parseTime(revoked.String)
+	return t, nil
+}
+
+func (r *tokenRepo) Create(ctx context.Context, t *models.APIToken, tokenHash string) error {
+	scopes := make([]string, len(t.Scopes))
+	for i, sc := range t.Scopes {
+		scopes[i] = string(sc)
+	}
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	res, err := r.db.ExecContext(ctx, "INSERT INTO api_tokens (user_id, name, token_hash, scopes, created_at) VALUES (?, ?, ?, ?, ?)",
+		t.UserID, t.Name, tokenHash, strings.Join(scopes, " "), formatTime(t.CreatedAt))
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	t.ID = int(id)
+	return nil
+}
+
+func (r *tokenRepo) ListByUser(ctx context.Context, userID int) ([]models.APIToken, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+tokenColumns+" FROM api_tokens WHERE user_id = ? ORDER BY revoked_at IS NOT NULL, id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.APIToken
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (r *tokenRepo) GetActiveByHash(ctx context.Context, tokenHash string) (models.APIToken, error) {
+	return scanToken(r.db.QueryRowContext(ctx,
+		"SELECT "+tokenColumns+" FROM api_tokens WHERE token_hash = ? AND revoked_at IS NULL", tokenHash))
+}
+
+func (r *tokenRepo) Touch(ctx context.Context, id int, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE api_tokens SET last_used_at = ? WHERE id = ?", formatTime(at), id)
+	return err
+}
+
+func (r *tokenRepo) Revoke(ctx context.Context, userID, id int) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		formatTime(time.Now()), id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+	"github.com/aml-709/game-store/internal/money"
+)
+
+type wishlistRepo struct {
+	db *sql.DB
+}
+
+func NewWishlistRepo(db *sql.DB) WishlistRepo {
+	return &wishlistRepo{db: db}
+}
+
+func (r *wishlistRepo) Add(ctx context.Context, userID, gameID int) error {
+	_, err := r.db.ExecContext(ctx, "INSERT OR IGNORE INTO wishlist_items (user_id, game_id, created_at) VALUES (?, ?, ?)",
+		userID, gameID, formatTime(time.Now().UTC()))
+	return err
+}
+
+func (r *wishlistRepo) Remove(ctx context.Context, userID, gameID int) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM wishlist_items WHERE user_id = ? AND game_id = ?", userID, gameID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *wishlistRepo) List(ctx context.Context, userID int, cur money.Currency) ([]models.WishlistItem, error) {
+	return wishlistItems(ctx, r.db, userID, cur, priceTime(ctx))
+}
+
+func (r *wishlistRepo) GameIDs(ctx context.Context, userID int) (map[int]bool, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT game_id FROM wishlist_items WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// scanExtra дочитывает колонки после колонок игры (см. scanGame).
+type scanExtra struct {
+	rowScanner
+	extra []any
+}
+
+func (s scanExtra) Scan(dest ...any) error { return s.rowScanner.Scan(append(dest, s.extra...)...) }
+
+// wishlistItems — список желаемого с ценами в валюте cur на момент at и распродажами,
+// которые в этот момент снижают цену копии для покупателя.
+func wishlistItems(ctx context.Context, q dbtx, userID int, cur money.Currency, at time.Time) ([]models.WishlistItem, error) {
+	from, args := pricedGames(cur, at)
+	rows, err := q.QueryContext(ctx, `
+        SELECT `+qualifiedGameColumns+`, w.created_at,
+               EXISTS(SELECT 1 FROM user_games ug WHERE ug.user_id = w.user_id AND ug.game_id = w.game_id)
+        FROM wishlist_items w
+        JOIN `+from+` ON g.id = w.game_id
+        WHERE w.user_id = ?
+        ORDER BY w.id DESC
+    `, append(args, userID)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []models.WishlistItem
+	for rows.Next() {
+		var it models.WishlistItem
+		var added string
+		if it.Game, err = scanGame(scanExtra{rows, []any{&added, &it.Owned}}); err != nil {
+			return nil, err
+		}
+		it.AddedAt = parseTime(added)
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil || len(items) == 0 {
+		return items, err
+	}
+
+	// распродажа считается так же, как в корзине с одной личной копией
+	promos, err := applicablePromotions(ctx, q, userID, "", at)
+	if err != nil {
+		return nil, err
+	}
+	for i, it := range items {
+		if it.Unavailable {
+			continue
+		}
+		line := []models.CartItem{{GameID: it.ID, Price: it.Price, Quantity: 1}}
+		if applied := models.ApplyPromotions(line, promos); len(applied) > 0 {
+			items[i].Discount, items[i].Sale, items[i].SaleID = line[0].Discount, applied[0].Name, applied[0].PromotionID
+		}
+	}
+	return items, nil
+}
+
+func (r *wishlistRepo) Notifications(ctx context.Context, userID, limit int) ([]models.Notification, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT n.id, n.user_id, n.kind, n.game_id, COALESCE(g.title, ''), COALESCE(pm.name, ''),
+               n.old_price_minor, n.new_price_minor, n.currency, n.created_at, COALESCE(n.read_at, '')
+        FROM notifications n
+        LEFT JOIN games g ON g.id = n.game_id
+        LEFT JOIN promotions pm ON pm.id = n.promotion_id
+        WHERE n.user_id = ?
+        ORDER BY n.id DESC
+        LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Notification
+	for rows.Next() {
+		var n models.Notification
+		var created, read string
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &n.GameID, &n.GameTitle, &n.Sale,
+			&n.OldPrice.Minor, &n.NewPrice.Minor, &n.NewPrice.Currency, &created, &read); err != nil {
+			return nil, err
+		}
+		n.OldPrice.Currency = n.NewPrice.Currency
+		n.CreatedAt, n.ReadAt = parseTime(created), parseTime(read)
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+func (r *wishlistRepo) UnreadCount(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL", userID).Scan(&n)
+	return n, err
+}
+
+func (r *wishlistRepo) MarkRead(ctx context.Context, userID int) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL",
+		formatTime(time.Now().UTC()), userID)
+	return err
+}
+
+func (r *wishlistRepo) CheckPrices(ctx context.Context, at time.Time) (int, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT DISTINCT w.user_id, COALESCE(c.currency, '')
+        FROM wishlist_items w JOIN customers c ON c.id = w.user_id
+        ORDER BY w.user_id`)
+	if err != nil {
+		return 0, err
+	}
+	type watcher struct {
+		id  int
+		cur money.Currency
+	}
+	var watchers []watcher
+	for rows.Next() {
+		var w watcher
+		if err := rows.Scan(&w.id, &w.cur); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !w.cur.Valid() {
+			w.cur = money.Default
+		}
+		watchers = append(watchers, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, w := range watchers {
+		var n int
+		err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+			var err error
+			n, err = checkWishlist(ctx, tx, w.id, w.cur, at)
+			return err
+		})
+		if err != nil {
+			// один покупатель не должен останавливать проверку для остальных
+			log.Printf("price watch: user %d: %v", w.id, err)
+			continue
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// checkWishlist сравнивает цены списка желаемого покупателя с ценами, о которых он знает
+// (notified_minor), и записывает уведомления о снижении. Подорожание, смена валюты или
+// первая проверка только запоминают цену: уведомление будет, когда она снова опустится.
+// Игры из библиотеки, снятые с продажи и без цены в валюте покупателя пропускаются.
+func checkWishlist(ctx context.Context, tx *sql.Tx, userID int, cur money.Currency, at time.Time) (int, error) {
+	items, err := wishlistItems(ctx, tx, userID, cur, at)
+	if err != nil {
+		return 0, err
+	}
+	type known struct {
+		minor    sql.NullInt64
+		currency money.Currency
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT game_id, notified_minor, COALESCE(currency, '') FROM wishlist_items WHERE user_id = ?", userID)
+	if err != nil {
+		return 0, err
+	}
+	prices := map[int]known{}
+	for rows.Next() {
+		var id int
+		var k known
+		if err := rows.Scan(&id, &k.minor, &k.currency); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		prices[id] = k
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	now := formatTime(at)
+	n := 0
+	for _, it := range items {
+		if it.Owned || !it.Published || it.Unavailable {
+			continue
+		}
+		price, k := it.FinalPrice(), prices[it.ID]
+		same := k.minor.Valid && k.currency == price.Currency
+		if same && price.Minor == k.minor.Int64 {
+			continue
+		}
+		if same && price.Minor < k.minor.Int64 {
+			kind := models.NotifyPriceDrop
+			if it.Sale != "" {
+				kind = models.NotifySale
+			}
+			if _, err := tx.ExecContext(ctx, `
+                INSERT INTO notifications (user_id, kind, game_id, promotion_id, old_price_minor, new_price_minor, currency, created_at)
+                VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				userID, kind, it.ID, nullable(it.SaleID), k.minor.Int64, price.Minor, price.Currency, now); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE wishlist_items SET notified_minor = ?, currency = ? WHERE user_id = ? AND game_id = ?",
+			price.Minor, price.Currency, userID, it.ID); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// StartPriceWatch в фоне раз в interval ищет снижения цен и распродажи на игры из списков
+// желаемого и записывает уведомления покупателям. Первая проверка — сразу. Возвращает функцию остановки.
+func StartPriceWatch(wishlists WishlistRepo, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			n, err := wishlists.CheckPrices(context.Background(), time.Now())
+			if err != nil {
+				log.Printf("price watch: %v", err)
+			}
+			if n > 0 {
+				log.Printf("price watch: %d new wishlist notifications", n)
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
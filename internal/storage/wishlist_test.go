@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aml-709/game-store/internal/models"
+)
+
+func TestCheckPrices(t *testing.T) {
+	r, _ := newTestRepos(t)
+	ctx := context.Background()
+	uid := addCustomer(t, r, "eve")
+	game := addGame(t, r, "Doom", 1999)
+	if err := r.Wishlists.Add(ctx, uid, game); err != nil {
+		t.Fatal(err)
+	}
+
+	// первая проверка только запоминает цену
+	if n, err := r.Wishlists.CheckPrices(ctx, time.Now()); err != nil || n != 0 {
+		t.Fatalf("first check = %d, %v; want 0", n, err)
+	}
+
+	g, err := r.Games.Get(ctx, game, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Price.Minor = 999
+	if err := r.Games.Update(ctx, g); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Wishlists.CheckPrices(ctx, time.Now()); err != nil || n != 1 {
+		t.Fatalf("check after price drop = %d, %v; want 1", n, err)
+	}
+	// о той же цене второй раз не уведомляем
+	if n, err := r.Wishlists.CheckPrices(ctx, time.Now()); err != nil || n != 0 {
+		t.Fatalf("repeated check = %d, %v; want 0", n, err)
+	}
+
+	notes, err := r.Wishlists.Notifications(ctx, uid, 10)
+	if err != nil || len(notes) != 1 {
+		t.Fatalf("Notifications = %v, %v; want one", notes, err)
+	}
+	if n := notes[0]; n.Kind != models.NotifyPriceDrop || n.OldPrice.Minor != 1999 || n.NewPrice.Minor != 999 {
+		t.Errorf("notification = %+v, want price drop 1999 → 999", n)
+	}
+	if c, err := r.Wishlists.UnreadCount(ctx, uid); err != nil || c != 1 {
+		t.Errorf("UnreadCount = %d, %v; want 1", c, err)
+	}
+}